@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"errors"
+	"marblegame/engine"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// How hard a Bot tries
+type Difficulty struct {
+	Name       string  `json:"name"`
+	Candidates int     `json:"candidates"` // how many shots it simulates before picking one
+	AimNoise   float64 `json:"aimNoise"`   // how far its shots stray, see Bot.miss
+}
+
+var (
+	Easy   = Difficulty{Name: "easy", Candidates: 6, AimNoise: 0.25}
+	Medium = Difficulty{Name: "medium", Candidates: 40, AimNoise: 0.08}
+	Hard   = Difficulty{Name: "hard", Candidates: 200, AimNoise: 0.01}
+)
+
+var Difficulties = []Difficulty{Easy, Medium, Hard}
+
+func DifficultyByName(name string) (Difficulty, error) {
+	for _, difficulty := range Difficulties {
+		if difficulty.Name == name {
+			return difficulty, nil
+		}
+	}
+	return Difficulty{}, errors.New("Unknown difficulty")
+}
+
+// A computer player, it plays through the game as a normal Player with its own UserToken
+type Bot struct {
+	UserToken  string
+	Difficulty Difficulty
+	mu         sync.Mutex // guards rand, so plans can run at the same time
+	rand       *rand.Rand
+}
+
+func NewBot(userToken string, difficulty Difficulty, seed int64) *Bot {
+	return &Bot{
+		UserToken:  userToken,
+		Difficulty: difficulty,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Picks a shot for the game's latest frame
+// it simulates Candidates random shots, keeps the one that gains it the most over its opponents, then misses it a little
+// marbleGame is only read, never changed, and the Bot can plan on several games at once
+func (b *Bot) PlanAction(marbleGame *engine.MarbleGame) (engine.Action, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	player, exists := marbleGame.Players[b.UserToken]
+	if !exists {
+		return engine.Action{}, errors.New("Bot is not in the game")
+	}
+	if len(player.Inventory) == 0 {
+		return engine.Action{}, errors.New("Bot has no marbles left")
+	}
+
+	frame := marbleGame.Frames[len(marbleGame.Frames)-1]
+
+	var best engine.Action
+	bestValue := math.MinInt
+	for range max(b.Difficulty.Candidates, 1) {
+		candidate := b.candidate(marbleGame, player, frame)
+		candidate.UserToken = b.UserToken
+		prediction, err := marbleGame.PredictAction(candidate, frame)
+		if err != nil {
+			continue
+		}
+
+		value := 0
+		for userToken, change := range prediction.ScoreChanges {
+			if userToken == b.UserToken {
+				value += change
+			} else {
+				value -= change
+			}
+		}
+
+		if value > bestValue {
+			best = candidate
+			bestValue = value
+		}
+	}
+	if bestValue == math.MinInt {
+		// the mode may rule out most of the inventory, like Bocce does until the jack is thrown
+		width, height := float64(marbleGame.Config.Width), float64(marbleGame.Config.Height)
+		for slot := range player.Inventory {
+			candidate := placeAction(slot, placeLegally(marbleGame, player, slot, vector2.Vector2{X: width / 2, Y: height / 2}, frame))
+			candidate.UserToken = b.UserToken
+			if _, err := marbleGame.PredictAction(candidate, frame); err == nil {
+				best = candidate
+				bestValue = 0
+				break
+			}
+		}
+	}
+	if bestValue == math.MinInt {
+		return engine.Action{}, errors.New("Bot found no legal shot")
+	}
+
+	action := b.miss(marbleGame, player, best, frame)
+	action.UserToken = b.UserToken
+	return action, nil
+}
+
+// A random shot, either a marble placed near a target or one fired through it
+// targets are the middle of the scoring zone or any marble already on the field
+func (b *Bot) candidate(marbleGame *engine.MarbleGame, player *engine.Player, frame engine.MarbleGameFrame) engine.Action {
+	slot := b.rand.Intn(len(player.Inventory))
+	radius := player.Inventory[slot].Radius
+	width, height := float64(marbleGame.Config.Width), float64(marbleGame.Config.Height)
+
+	target := vector2.Vector2{X: width / 2, Y: height / 2}
+	if len(frame.Marbles) > 0 && b.rand.Intn(2) == 0 {
+		target = frame.Marbles[b.rand.Intn(len(frame.Marbles))].Pos
+	}
+
+	if b.rand.Intn(3) == 0 {
+		pos := vector2.Vector2{
+			X: target.X + b.rand.NormFloat64()*2*radius,
+			Y: target.Y + b.rand.NormFloat64()*2*radius,
+		}
+		return placeAction(slot, placeLegally(marbleGame, player, slot, pos, frame))
+	}
+
+	pos := placeLegally(marbleGame, player, slot, vector2.Vector2{
+		X: radius + b.rand.Float64()*(width-2*radius),
+		Y: radius + b.rand.Float64()*(height-2*radius),
+	}, frame)
+	direction := math.Atan2(target.Y-pos.Y, target.X-pos.X)
+	maxSpeed := marbleGame.Config.PhysicsOf(player.Inventory[slot]).MaxLaunchSpeed
+	power := b.rand.Float64() * maxSpeed
+	return aimAction(slot, pos, direction, power, maxSpeed, width, height)
+}
+
+// Throws the chosen shot off by AimNoise: that many radians of aim and fraction of power (as standard deviations),
+// and placements land off by AimNoise marble diameters
+func (b *Bot) miss(marbleGame *engine.MarbleGame, player *engine.Player, action engine.Action, frame engine.MarbleGameFrame) engine.Action {
+	noise := b.Difficulty.AimNoise
+	if noise <= 0 {
+		return action
+	}
+
+	radius := player.Inventory[action.InventorySlot].Radius
+	width, height := float64(marbleGame.Config.Width), float64(marbleGame.Config.Height)
+
+	// marbles travel from Vel towards Pos
+	travel := action.Pos.Sub(&action.Vel)
+	if travel.Magnitude() == 0 {
+		pos := vector2.Vector2{
+			X: action.Pos.X + b.rand.NormFloat64()*noise*2*radius,
+			Y: action.Pos.Y + b.rand.NormFloat64()*noise*2*radius,
+		}
+		return placeAction(action.InventorySlot, placeLegally(marbleGame, player, action.InventorySlot, pos, frame))
+	}
+
+	direction := math.Atan2(travel.Y, travel.X) + b.rand.NormFloat64()*noise
+	power := travel.Magnitude() * (1 + b.rand.NormFloat64()*noise)
+	maxSpeed := marbleGame.Config.PhysicsOf(player.Inventory[action.InventorySlot]).MaxLaunchSpeed
+	return aimAction(action.InventorySlot, action.Pos, direction, power, maxSpeed, width, height)
+}
+
+// A marble placed with no power behind it
+func placeAction(slot int, pos vector2.Vector2) engine.Action {
+	return engine.Action{
+		InventorySlot: slot,
+		Pos:           pos,
+		Vel:           pos,
+	}
+}
+
+// A marble fired from pos towards direction (in radians), no faster than its type launches at
+// Action.Vel is where the player lets go of their drag, behind pos and inside the field, so power is cut short to keep it there
+func aimAction(slot int, pos vector2.Vector2, direction float64, power float64, maxSpeed float64, width float64, height float64) engine.Action {
+	power = math.Max(0, math.Min(power, maxSpeed))
+	pullX, pullY := -math.Cos(direction), -math.Sin(direction)
+
+	limit := func(from, pull, size float64) float64 {
+		switch {
+		case pull > 0:
+			return (size - from) / pull
+		case pull < 0:
+			return -from / pull
+		}
+		return math.Inf(1)
+	}
+	power = math.Min(power, limit(pos.X, pullX, width))
+	power = math.Min(power, limit(pos.Y, pullY, height))
+
+	return engine.Action{
+		InventorySlot: slot,
+		Pos:           pos,
+		Vel:           vector2.Vector2{X: pos.X + pullX*power, Y: pos.Y + pullY*power},
+	}
+}
+
+// The closest spot to pos the player can put the slot's marble down, inside their launch zone and clear of everything
+// pos is kept when there's nowhere, and the shot will just be turned down
+func placeLegally(marbleGame *engine.MarbleGame, player *engine.Player, slot int, pos vector2.Vector2, frame engine.MarbleGameFrame) vector2.Vector2 {
+	legal, err := marbleGame.ClosestPlacement(player, player.Inventory[slot], pos, frame)
+	if err != nil {
+		return pos
+	}
+	return legal
+}
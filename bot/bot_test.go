@@ -0,0 +1,200 @@
+package bot_test
+
+import (
+	"encoding/json"
+	"marblegame/bot"
+	"marblegame/engine"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func newBotGame(t *testing.T) *engine.MarbleGame {
+	t.Helper()
+	g := engine.NewMarbleGame()
+	for _, userToken := range []string{"human", "bot"} {
+		if _, err := g.AddPlayer(userToken); err != nil {
+			t.Fatalf("FAIL adding %s: %v", userToken, err)
+		}
+	}
+	return g
+}
+
+// a marble placed with no power behind it
+func place(userToken string, x, y float64) engine.Action {
+	return engine.Action{
+		InventorySlot: 0,
+		Pos:           vector2.Vector2{X: x, Y: y},
+		Vel:           vector2.Vector2{X: x, Y: y},
+		UserToken:     userToken,
+	}
+}
+
+func TestPlanActionGainsOnOpponents(t *testing.T) {
+	perfect := bot.Difficulty{Name: "perfect", Candidates: 150, AimNoise: 0}
+
+	testCases := []struct {
+		desc  string
+		setup func(g *engine.MarbleGame) error
+	}{
+		{
+			desc: "empty field",
+			setup: func(g *engine.MarbleGame) error {
+				g.ActivePlayerIndex = 1
+				return nil
+			},
+		},
+		{
+			desc: "opponent on the bullseye",
+			setup: func(g *engine.MarbleGame) error {
+				return g.PlayAction(place("human", 300, 240))
+			},
+		},
+		{
+			desc: "opponent guarding the middle",
+			setup: func(g *engine.MarbleGame) error {
+				if err := g.PlayAction(place("human", 300, 240)); err != nil {
+					return err
+				}
+				if err := g.PlayAction(place("bot", 500, 60)); err != nil {
+					return err
+				}
+				return g.PlayAction(place("human", 300, 300))
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newBotGame(t)
+			if err := tC.setup(g); err != nil {
+				t.Fatalf("FAIL setting up: %v", err)
+			}
+			margin := func() int {
+				return g.Players["bot"].Score - g.Players["human"].Score
+			}
+			before := margin()
+
+			b := bot.NewBot("bot", perfect, 1)
+			action, err := b.PlanAction(g)
+			if err != nil {
+				t.Fatalf("FAIL planning: %v", err)
+			}
+			if err := g.PlayAction(action); err != nil {
+				t.Fatalf("FAIL playing the planned action: %v", err)
+			}
+
+			if after := margin(); after <= before {
+				t.Errorf("FAIL bot should gain on its opponent: got a margin of %d, was %d", after, before)
+			}
+		})
+	}
+}
+
+func TestPlanActionLeavesGameAlone(t *testing.T) {
+	for _, difficulty := range bot.Difficulties {
+		t.Run(difficulty.Name, func(t *testing.T) {
+			g := newBotGame(t)
+			if err := g.PlayAction(place("human", 280, 250)); err != nil {
+				t.Fatalf("FAIL setting up: %v", err)
+			}
+			before, _ := json.Marshal(g)
+
+			action, err := bot.NewBot("bot", difficulty, 7).PlanAction(g)
+			if err != nil {
+				t.Fatalf("FAIL planning: %v", err)
+			}
+
+			after, _ := json.Marshal(g)
+			if string(after) != string(before) {
+				t.Errorf("FAIL planning changed the game")
+			}
+			if err := g.PlayAction(action); err != nil {
+				t.Errorf("FAIL planned action was rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestPlanActionIsSeeded(t *testing.T) {
+	g := newBotGame(t)
+	g.ActivePlayerIndex = 1
+
+	first, _ := bot.NewBot("bot", bot.Medium, 42).PlanAction(g)
+	second, _ := bot.NewBot("bot", bot.Medium, 42).PlanAction(g)
+	if first != second {
+		t.Errorf("FAIL same seed planned different shots: got %+v, want %+v", second, first)
+	}
+}
+
+func TestPlanActionErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		setup func(g *engine.MarbleGame)
+	}{
+		{
+			desc:  "not in the game",
+			setup: func(g *engine.MarbleGame) { delete(g.Players, "bot") },
+		},
+		{
+			desc:  "no marbles left",
+			setup: func(g *engine.MarbleGame) { g.Players["bot"].Inventory = nil },
+		},
+		{
+			desc:  "game over",
+			setup: func(g *engine.MarbleGame) { g.State = engine.GameStateFinished },
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newBotGame(t)
+			tC.setup(g)
+			if _, err := bot.NewBot("bot", bot.Easy, 1).PlanAction(g); err == nil {
+				t.Errorf("FAIL expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestDifficultyByName(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		name    string
+		want    bot.Difficulty
+		wantErr bool
+	}{
+		{desc: "easy", name: "easy", want: bot.Easy},
+		{desc: "medium", name: "medium", want: bot.Medium},
+		{desc: "hard", name: "hard", want: bot.Hard},
+		{desc: "unknown", name: "impossible", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := bot.DifficultyByName(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Fatalf("FAIL error: got %v, want error %v", err, tC.wantErr)
+			}
+			if got != tC.want {
+				t.Errorf("FAIL difficulty: got %+v, want %+v", got, tC.want)
+			}
+		})
+	}
+}
+
+func TestPlanActionThrowsTheJackFirst(t *testing.T) {
+	g := engine.NewMarbleGame()
+	g.Config.Mode = engine.BocceMode{}.Name()
+	g.AddPlayer("bot")
+	g.AddPlayer("player 2")
+
+	// the jack is one slot of five, so an easy bot rarely picks it by chance
+	for seed := range int64(20) {
+		b := bot.NewBot("bot", bot.Easy, seed)
+		action, err := b.PlanAction(g)
+		if err != nil {
+			t.Fatalf("FAIL seed %d: %v", seed, err)
+		}
+		if got := g.Players["bot"].Inventory[action.InventorySlot]; got != engine.Jack {
+			t.Errorf("FAIL seed %d: got %s, want %s", seed, got.Name, engine.Jack.Name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Marblesim plays batches of matches headless, to see how changes to MarbleTypes or the scoring config play out
+//
+//	go run ./cmd/marblesim -matches 2000 -strategies center,aim -seed 7 -format csv
+//	go run ./cmd/marblesim -config variant.json -label variant -strategies bot:medium,bot:medium
+//	go run ./cmd/marblesim -level bumpers -strategies aim,aim
+//
+// -config is a JSON MarbleGameConfig, any field it leaves out keeps engine.NewMarbleGame's default.
+// -level is the name of one of engine.Levels or the path to a level file, its obstacles replace the config's.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"marblegame/engine"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	matches := flag.Int("matches", 1000, "how many matches to play")
+	strategies := flag.String("strategies", "random,random", "comma separated strategy for each seat:\n"+strategyHelp)
+	seed := flag.Int64("seed", 1, "seed for every random choice, the same seed gives the same report")
+	configPath := flag.String("config", "", "JSON MarbleGameConfig to play with, on top of the defaults")
+	label := flag.String("label", "", "names the run in the report, defaults to the config file or level")
+	format := flag.String("format", "json", "json or csv")
+	header := flag.Bool("header", true, "write the CSV header row, turn off to append runs to one file")
+	workers := flag.Int("workers", runtime.NumCPU(), "matches played at once")
+	rotate := flag.Bool("rotate", true, "move the first turn along a seat every match")
+	levelName := flag.String("level", "", "level name or level file to play on")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *levelName != "" {
+		level, err := loadLevel(*levelName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		config.UseLevel(level)
+	}
+
+	if *label == "" {
+		*label = "default"
+		if *configPath != "" {
+			*label = *configPath
+		} else if *levelName != "" {
+			*label = *levelName
+		}
+	}
+
+	sim := simulation{
+		Label:      *label,
+		Config:     config,
+		Strategies: strings.Split(*strategies, ","),
+		Matches:    *matches,
+		Seed:       *seed,
+		Workers:    *workers,
+		Rotate:     *rotate,
+	}
+	report, err := sim.run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "json":
+		err = writeJSON(os.Stdout, report)
+	case "csv":
+		err = writeCSV(os.Stdout, report, *header)
+	default:
+		err = fmt.Errorf("Unknown format %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func loadConfig(path string) (engine.MarbleGameConfig, error) {
+	config := engine.NewMarbleGame().Config
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// A built in level by name, otherwise a level file
+func loadLevel(nameOrPath string) (engine.Level, error) {
+	if level, err := engine.LevelByName(nameOrPath); err == nil {
+		return level, nil
+	}
+
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return engine.Level{}, err
+	}
+	return engine.ParseLevel(data)
+}
+
+func writeJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// One row per seat, with the label and seed on each so runs can be stacked and compared
+func writeCSV(w io.Writer, report Report, header bool) error {
+	writer := csv.NewWriter(w)
+	if header {
+		writer.Write([]string{"label", "seed", "matches", "seat", "strategy", "wins", "ties", "winRate", "averageScore", "shots", "skipped", "rejected", "bullseyeRate", "averageFramesPerShot"})
+	}
+
+	formatFloat := func(f float64) string { return strconv.FormatFloat(f, 'f', 4, 64) }
+	for _, seat := range report.Seats {
+		writer.Write([]string{
+			report.Label,
+			strconv.FormatInt(report.Seed, 10),
+			strconv.Itoa(report.Matches),
+			strconv.Itoa(seat.Seat),
+			seat.Strategy,
+			strconv.Itoa(seat.Wins),
+			strconv.Itoa(seat.Ties),
+			formatFloat(seat.WinRate),
+			formatFloat(seat.AverageScore),
+			strconv.Itoa(seat.Shots),
+			strconv.Itoa(seat.Skipped),
+			strconv.Itoa(seat.Rejected),
+			formatFloat(seat.BullseyeRate),
+			formatFloat(seat.AverageFramesPerShot),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
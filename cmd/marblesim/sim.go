@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"marblegame/engine"
+	"math/rand"
+	"sync"
+)
+
+// A batch of matches, all played with the same config and strategies
+type simulation struct {
+	Label      string
+	Config     engine.MarbleGameConfig
+	Strategies []string // one per seat
+	Matches    int
+	Seed       int64
+	Workers    int
+	Rotate     bool // move the first turn along a seat every match, so no strategy always goes first
+}
+
+type Report struct {
+	Label                string                  `json:"label"`
+	Seed                 int64                   `json:"seed"`
+	Matches              int                     `json:"matches"`
+	Config               engine.MarbleGameConfig `json:"config"`
+	Seats                []SeatReport            `json:"seats"`
+	AverageFramesPerShot float64                 `json:"averageFramesPerShot"`
+}
+
+type SeatReport struct {
+	Seat                 int     `json:"seat"`
+	Strategy             string  `json:"strategy"`
+	Wins                 int     `json:"wins"`
+	Ties                 int     `json:"ties"`    // matches where this seat shared first place
+	WinRate              float64 `json:"winRate"` // outright wins per match
+	AverageScore         float64 `json:"averageScore"`
+	Shots                int     `json:"shots"`
+	Skipped              int     `json:"skipped"`      // turns passed with nowhere to place a marble
+	Rejected             int     `json:"rejected"`     // shots the engine turned down, their turns are passed too
+	BullseyeRate         float64 `json:"bullseyeRate"` // shots whose marble came to rest on the bullseye
+	AverageFramesPerShot float64 `json:"averageFramesPerShot"`
+}
+
+type seatResult struct {
+	score     int
+	won       bool
+	tied      bool
+	shots     int
+	skipped   int
+	rejected  int
+	bullseyes int
+	frames    int
+}
+
+// Plays every match across Workers goroutines
+// each match gets its own seed up front and results are added up in match order, so a seed always gives the same Report
+func (sim simulation) run() (Report, error) {
+	if len(sim.Strategies) == 0 {
+		return Report{}, errors.New("No strategies given")
+	}
+
+	seeds := make([]int64, sim.Matches)
+	r := rand.New(rand.NewSource(sim.Seed))
+	for i := range seeds {
+		seeds[i] = r.Int63()
+	}
+
+	results := make([][]seatResult, sim.Matches)
+	errs := make([]error, sim.Matches)
+
+	matches := make(chan int)
+	var wg sync.WaitGroup
+	for range max(sim.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range matches {
+				results[i], errs[i] = sim.playMatch(i, seeds[i])
+			}
+		}()
+	}
+	for i := range sim.Matches {
+		matches <- i
+	}
+	close(matches)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return Report{}, fmt.Errorf("match %d: %w", i, err)
+		}
+	}
+
+	report := Report{
+		Label:   sim.Label,
+		Seed:    sim.Seed,
+		Matches: sim.Matches,
+		Config:  sim.Config,
+		Seats:   []SeatReport{},
+	}
+	totalShots, totalFrames := 0, 0
+	for seat, strategyName := range sim.Strategies {
+		seatReport := SeatReport{Seat: seat + 1, Strategy: strategyName}
+		totalScore, bullseyes, frames := 0, 0, 0
+		for _, result := range results {
+			seatResult := result[seat]
+			if seatResult.won {
+				seatReport.Wins++
+			}
+			if seatResult.tied {
+				seatReport.Ties++
+			}
+			totalScore += seatResult.score
+			seatReport.Shots += seatResult.shots
+			seatReport.Skipped += seatResult.skipped
+			seatReport.Rejected += seatResult.rejected
+			bullseyes += seatResult.bullseyes
+			frames += seatResult.frames
+		}
+		if sim.Matches > 0 {
+			seatReport.WinRate = float64(seatReport.Wins) / float64(sim.Matches)
+			seatReport.AverageScore = float64(totalScore) / float64(sim.Matches)
+		}
+		if seatReport.Shots > 0 {
+			seatReport.BullseyeRate = float64(bullseyes) / float64(seatReport.Shots)
+			seatReport.AverageFramesPerShot = float64(frames) / float64(seatReport.Shots)
+		}
+		totalShots += seatReport.Shots
+		totalFrames += frames
+		report.Seats = append(report.Seats, seatReport)
+	}
+	if totalShots > 0 {
+		report.AverageFramesPerShot = float64(totalFrames) / float64(totalShots)
+	}
+
+	return report, nil
+}
+
+// Plays one match to the end, results are by seat rather than turn order
+func (sim simulation) playMatch(index int, seed int64) ([]seatResult, error) {
+	seats := len(sim.Strategies)
+
+	marbleGame := engine.NewMarbleGame()
+	marbleGame.Config = sim.Config
+	marbleGame.Config.PlayerLimit = seats
+
+	userTokens := make([]string, seats)
+	strategies := make(map[string]strategy)
+	seatOf := make(map[string]int)
+	for turn := range seats {
+		seat := turn
+		if sim.Rotate {
+			seat = (turn + index) % seats
+		}
+		userTokens[seat] = fmt.Sprintf("seat %d", seat+1)
+
+		s, err := newStrategy(sim.Strategies[seat], userTokens[seat], seed+int64(seat))
+		if err != nil {
+			return nil, err
+		}
+		strategies[userTokens[seat]] = s
+		seatOf[userTokens[seat]] = seat
+
+		if _, err := marbleGame.AddPlayer(userTokens[seat]); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]seatResult, seats)
+	for marbleGame.State != engine.GameStateFinished {
+		player := marbleGame.TurnOrder[marbleGame.ActivePlayerIndex]
+		result := &results[seatOf[player.UserToken]]
+		action, err := strategies[player.UserToken](marbleGame)
+		if errors.Is(err, errNowhereToPlace) {
+			result.skipped++
+			if err := marbleGame.SkipTurn(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// one bad shot shouldn't throw away the batch, the turn passes as though the clock ran out
+		marbleId := marbleGame.NextMarbleId
+		if err := marbleGame.PlayAction(action); err != nil {
+			result.rejected++
+			if err := marbleGame.SkipTurn(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		result.shots++
+		result.frames += len(marbleGame.Frames)
+		for _, m := range marbleGame.Frames[len(marbleGame.Frames)-1].Marbles {
+			if _, bullseye := marbleGame.Config.ScoreAt(m.Pos, m.Type.Radius); m.Id == marbleId && bullseye {
+				result.bullseyes++
+			}
+		}
+	}
+
+	summary := marbleGame.Summary()
+	for _, standing := range summary.Standings {
+		result := &results[seatOf[standing.UserToken]]
+		result.score = standing.Score
+		if standing.Rank == 1 {
+			result.won = !summary.IsTie
+			result.tied = summary.IsTie
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"marblegame/engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimulationIsSeeded(t *testing.T) {
+	sim := simulation{
+		Label:      "test",
+		Config:     engine.NewMarbleGame().Config,
+		Strategies: []string{"random", "center"},
+		Matches:    20,
+		Seed:       7,
+		Workers:    4,
+		Rotate:     true,
+	}
+
+	first, err := sim.run()
+	if err != nil {
+		t.Fatalf("FAIL running simulation: %v", err)
+	}
+	sim.Workers = 1
+	second, err := sim.run()
+	if err != nil {
+		t.Fatalf("FAIL running simulation: %v", err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("FAIL same seed: got %+v, want %+v", second, first)
+	}
+
+	for _, seat := range first.Seats {
+		if seat.Wins+seat.Ties > sim.Matches {
+			t.Errorf("FAIL seat %d: %d wins and %d ties in %d matches", seat.Seat, seat.Wins, seat.Ties, sim.Matches)
+		}
+		if seat.Shots == 0 {
+			t.Errorf("FAIL seat %d took no shots", seat.Seat)
+		}
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		name    string
+		wantErr bool
+	}{
+		{desc: "Random", name: "random"},
+		{desc: "Center", name: "center"},
+		{desc: "Aim", name: "aim"},
+		{desc: "Bot", name: "bot:easy"},
+		{desc: "Unknown bot difficulty", name: "bot:impossible", wantErr: true},
+		{desc: "Unknown strategy", name: "cheat", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := newStrategy(tC.name, "seat 1", 1)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimulationPlaysEveryLevel(t *testing.T) {
+	for _, level := range engine.Levels {
+		for _, strategies := range [][]string{{"random", "random"}, {"center", "center"}, {"aim", "aim"}} {
+			t.Run(level.Name+" "+strings.Join(strategies, ","), func(t *testing.T) {
+				config := engine.NewMarbleGame().Config
+				config.UseLevel(level)
+				sim := simulation{
+					Label:      level.Name,
+					Config:     config,
+					Strategies: strategies,
+					Matches:    3,
+					Seed:       3,
+					Workers:    2,
+					Rotate:     true,
+				}
+
+				report, err := sim.run()
+				if err != nil {
+					t.Fatalf("FAIL running on %s: %v", level.Name, err)
+				}
+				for _, seat := range report.Seats {
+					if seat.Shots+seat.Skipped+seat.Rejected == 0 {
+						t.Errorf("FAIL seat %d on %s never had a turn", seat.Seat, level.Name)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStrategiesLetGoInsideTheArena(t *testing.T) {
+	level, err := engine.LevelByName("hexagon")
+	if err != nil {
+		t.Fatalf("FAIL loading level: %v", err)
+	}
+	for _, name := range []string{"random", "aim"} {
+		t.Run(name, func(t *testing.T) {
+			g := engine.NewMarbleGame()
+			g.Config.UseLevel(level)
+			if _, err := g.AddPlayer("seat 1"); err != nil {
+				t.Fatalf("FAIL adding player: %v", err)
+			}
+			s, err := newStrategy(name, "seat 1", 5)
+			if err != nil {
+				t.Fatalf("FAIL building strategy: %v", err)
+			}
+
+			for range 50 {
+				action, err := s(g)
+				if err != nil {
+					t.Fatalf("FAIL planning: %v", err)
+				}
+				drag := action.Vel.Sub(&action.Pos)
+				length := drag.Magnitude()
+				if length == 0 {
+					continue
+				}
+				if got := g.Config.DragInsideArena(action.Pos, *drag.MulScalar(1 / length), length); length-got > 1e-6 {
+					t.Errorf("FAIL %s let go outside the arena at %v", name, action.Vel)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"marblegame/bot"
+	"marblegame/engine"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Picks the next shot for one seat, it's only asked on that seat's turn
+// errNowhereToPlace passes the turn, when none of the seat's marbles can be put down anywhere
+type strategy func(marbleGame *engine.MarbleGame) (engine.Action, error)
+
+var errNowhereToPlace = errors.New("Nowhere to place any marble")
+
+const strategyHelp = `random: any slot (neutral ones first), from anywhere, in any direction and power
+center: the first slot, placed by hand as close to the first scoring zone's bullseye as it can go, with no power
+aim: the first slot, fired at the first scoring zone's bullseye from anywhere with any power
+bot:easy, bot:medium, bot:hard: the bot package at that difficulty`
+
+// Builds a fresh strategy for one seat of one match, everything random in it comes from seed
+func newStrategy(name string, userToken string, seed int64) (strategy, error) {
+	r := rand.New(rand.NewSource(seed))
+
+	if difficultyName, isBot := strings.CutPrefix(name, "bot:"); isBot {
+		difficulty, err := bot.DifficultyByName(difficultyName)
+		if err != nil {
+			return nil, err
+		}
+		b := bot.NewBot(userToken, difficulty, seed)
+		return b.PlanAction, nil
+	}
+
+	switch name {
+	case "random":
+		return func(marbleGame *engine.MarbleGame) (engine.Action, error) {
+			player := marbleGame.Players[userToken]
+			width, height := float64(marbleGame.Config.Width), float64(marbleGame.Config.Height)
+			slots := r.Perm(len(player.Inventory))
+			// neutral marbles like the jack are thrown before anything else
+			if neutral := slices.IndexFunc(player.Inventory, func(t engine.MarbleType) bool { return t.Neutral }); neutral != -1 {
+				slots = []int{neutral}
+			}
+			slot, pos, err := placeNear(marbleGame, player, slots, vector2.Vector2{X: r.Float64() * width, Y: r.Float64() * height})
+			if err != nil {
+				return engine.Action{}, err
+			}
+			// let go anywhere on the field, the drag stops short at the arena's edge
+			letGo := vector2.Vector2{X: r.Float64() * width, Y: r.Float64() * height}
+			direction := math.Atan2(pos.Y-letGo.Y, pos.X-letGo.X)
+			maxSpeed := marbleGame.Config.PhysicsOf(player.Inventory[slot]).MaxLaunchSpeed
+			return engine.Action{
+				InventorySlot: slot,
+				Pos:           pos,
+				Vel:           release(&marbleGame.Config, pos, direction, pos.Distance(&letGo), maxSpeed),
+				UserToken:     userToken,
+			}, nil
+		}, nil
+	case "center":
+		return func(marbleGame *engine.MarbleGame) (engine.Action, error) {
+			// a steady hand is still off by a few units
+			target := bullseye(&marbleGame.Config)
+			player := marbleGame.Players[userToken]
+			slot, pos, err := placeNear(marbleGame, player, inOrder(player), vector2.Vector2{
+				X: target.X + r.NormFloat64()*10,
+				Y: target.Y + r.NormFloat64()*10,
+			})
+			if err != nil {
+				return engine.Action{}, err
+			}
+			return engine.Action{
+				InventorySlot: slot,
+				Pos:           pos,
+				Vel:           pos,
+				UserToken:     userToken,
+			}, nil
+		}, nil
+	case "aim":
+		return func(marbleGame *engine.MarbleGame) (engine.Action, error) {
+			width, height := float64(marbleGame.Config.Width), float64(marbleGame.Config.Height)
+			player := marbleGame.Players[userToken]
+			slot, pos, err := placeNear(marbleGame, player, inOrder(player), vector2.Vector2{X: r.Float64() * width, Y: r.Float64() * height})
+			if err != nil {
+				return engine.Action{}, err
+			}
+			target := bullseye(&marbleGame.Config)
+			direction := math.Atan2(target.Y-pos.Y, target.X-pos.X)
+			maxSpeed := marbleGame.Config.PhysicsOf(player.Inventory[slot]).MaxLaunchSpeed
+			return engine.Action{
+				InventorySlot: slot,
+				Pos:           pos,
+				Vel:           release(&marbleGame.Config, pos, direction, r.Float64()*maxSpeed, maxSpeed),
+				UserToken:     userToken,
+			}, nil
+		}, nil
+	}
+
+	return nil, errors.New("Unknown strategy " + name)
+}
+
+// The first of the slots whose marble can be put down, and the closest spot to pos it can go, everything places by hand through here
+// errNowhereToPlace when none of them fit anywhere
+func placeNear(marbleGame *engine.MarbleGame, player *engine.Player, slots []int, pos vector2.Vector2) (int, vector2.Vector2, error) {
+	frame := marbleGame.Frames[len(marbleGame.Frames)-1]
+	for _, slot := range slots {
+		if legal, err := marbleGame.ClosestPlacement(player, player.Inventory[slot], pos, frame); err == nil {
+			return slot, legal, nil
+		}
+	}
+	return 0, pos, errNowhereToPlace
+}
+
+// Where a drag from pos is let go to fire it towards direction (in radians), like bot.aimAction
+// the drag is behind pos and no longer than maxSpeed, and power is cut short to let go inside the arena
+func release(config *engine.MarbleGameConfig, pos vector2.Vector2, direction float64, power float64, maxSpeed float64) vector2.Vector2 {
+	pull := vector2.Vector2{X: -math.Cos(direction), Y: -math.Sin(direction)}
+	power = config.DragInsideArena(pos, pull, math.Min(power, maxSpeed))
+	return vector2.Vector2{X: pos.X + pull.X*power, Y: pos.Y + pull.Y*power}
+}
+
+// Every slot the player has, first to last
+func inOrder(player *engine.Player) []int {
+	slots := make([]int, len(player.Inventory))
+	for i := range slots {
+		slots[i] = i
+	}
+	return slots
+}
+
+// The middle of the first scoring zone, or of the field when there are none
+func bullseye(config *engine.MarbleGameConfig) vector2.Vector2 {
+	if len(config.ScoringZones) == 0 {
+		return vector2.Vector2{X: float64(config.Width) / 2, Y: float64(config.Height) / 2}
+	}
+	return config.ScoringZones[0].Center
+}
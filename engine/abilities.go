@@ -0,0 +1,364 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Something special a MarbleType does in the simulation, chosen by name with MarbleType.Ability
+// hooks are called from Step:
+//
+//	Impact after the marble has bounced off another marble, a wall or an obstacle
+//	Rest   every substep the marble spends at rest
+//
+// Marble.Triggered is there for abilities that only go off once
+type Ability interface {
+	Name() string
+	// Whether other marbles bump into it, ghosts on their first pass don't
+	Solid(marble *Marble) bool
+	// Whether it's stuck where it is, nothing can push it
+	Anchored(marble *Marble) bool
+	// Called once the impact is resolved, other is the index of the marble it hit or -1 for a wall or obstacle
+	Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int)
+	Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int)
+}
+
+var Abilities = []Ability{
+	ExplosiveAbility{},
+	StickyAbility{},
+	AnchorAbility{},
+	GhostAbility{},
+	SplitterAbility{},
+}
+
+// Finds an Ability by its name, ignoring case
+func AbilityByName(name string) (Ability, error) {
+	for _, ability := range Abilities {
+		if strings.EqualFold(ability.Name(), name) {
+			return ability, nil
+		}
+	}
+	return nil, errors.New("Unknown ability")
+}
+
+// The Ability the type asks for, none if it's missing or unknown
+func (marbleType *MarbleType) ability() Ability {
+	if marbleType.Ability == "" {
+		return noAbility{}
+	}
+	ability, err := AbilityByName(marbleType.Ability)
+	if err != nil {
+		return noAbility{}
+	}
+	return ability
+}
+
+var (
+	ExplosiveMarble = MarbleType{
+		Name:        "Explosive Marble",
+		Description: "Blows nearby marbles away the first time it hits one.",
+		Radius:      30,
+		Mass:        10,
+		Ability:     ExplosiveAbility{}.Name(),
+	}
+	StickyMarble = MarbleType{
+		Name:        "Sticky Marble",
+		Description: "Sticks to any marble it touches, and stops dead against walls.",
+		Radius:      30,
+		Mass:        10,
+		Ability:     StickyAbility{}.Name(),
+	}
+	AnchorMarble = MarbleType{
+		Name:        "Anchor",
+		Description: "Heavy. Once it comes to rest nothing can move it.",
+		Radius:      35,
+		Mass:        30,
+		Ability:     AnchorAbility{}.Name(),
+	}
+	GhostMarble = MarbleType{
+		Name:        "Ghost Marble",
+		Description: "Passes through other marbles until it first comes to rest.",
+		Radius:      30,
+		Mass:        10,
+		Ability:     GhostAbility{}.Name(),
+	}
+	SplitterMarble = MarbleType{
+		Name:        "Splitter",
+		Description: "Breaks into two Small Marbles when it hits anything.",
+		Radius:      30,
+		Mass:        10,
+		Ability:     SplitterAbility{}.Name(),
+	}
+)
+
+// Plain marbles, they just bounce
+type noAbility struct{}
+
+func (noAbility) Name() string                                                           { return "" }
+func (noAbility) Solid(marble *Marble) bool                                              { return true }
+func (noAbility) Anchored(marble *Marble) bool                                           { return false }
+func (noAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {}
+func (noAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int)          {}
+
+const (
+	// marbles up to this far from an explosive's edge get blown away
+	blastRange = 90.0
+	// how fast a marble touching the explosive is sent off, it falls away to nothing at blastRange
+	blastSpeed = 150.0
+)
+
+// The first marble it hits sets it off, and every marble nearby is pushed straight away from it
+type ExplosiveAbility struct{}
+
+func (ExplosiveAbility) Name() string                 { return "Explosive" }
+func (ExplosiveAbility) Solid(marble *Marble) bool    { return true }
+func (ExplosiveAbility) Anchored(marble *Marble) bool { return false }
+
+func (ExplosiveAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {
+	explosive := &frame.Marbles[self]
+	if other == -1 || explosive.Triggered {
+		return
+	}
+	explosive.Triggered = true
+
+	for i := range frame.Marbles {
+		m := &frame.Marbles[i]
+		if i == self || frame.immovable(i) {
+			continue
+		}
+		gap := m.Pos.Distance(&explosive.Pos) - m.Type.Radius - explosive.Type.Radius
+		if gap >= blastRange {
+			continue
+		}
+		away := m.Pos.Sub(&explosive.Pos).Normalize()
+		// travel is opposite to Vel
+		m.Vel = *m.Vel.Sub(away.MulScalar(blastSpeed * (1 - math.Max(gap, 0)/blastRange)))
+	}
+	for i := range frame.Marbles {
+		if frame.Marbles[i].Group != 0 {
+			frame.unify(i)
+		}
+	}
+}
+
+func (ExplosiveAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int) {}
+
+// Whatever it touches joins it, and they move as one from then on
+// walls and obstacles stop it dead, along with everything stuck to it
+type StickyAbility struct{}
+
+func (StickyAbility) Name() string                 { return "Sticky" }
+func (StickyAbility) Solid(marble *Marble) bool    { return true }
+func (StickyAbility) Anchored(marble *Marble) bool { return false }
+
+func (StickyAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {
+	if other == -1 {
+		frame.Marbles[self].Vel = vector2.Vector2{}
+		for _, i := range frame.lump(self) {
+			frame.Marbles[i].stopSpinning()
+		}
+		frame.carry(self)
+		return
+	}
+	frame.stick(self, other)
+}
+
+func (StickyAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int) {}
+
+// A heavy marble that's knocked about like any other until it first comes to rest, then it never moves again
+type AnchorAbility struct{}
+
+func (AnchorAbility) Name() string                 { return "Anchor" }
+func (AnchorAbility) Solid(marble *Marble) bool    { return true }
+func (AnchorAbility) Anchored(marble *Marble) bool { return marble.Triggered }
+
+func (AnchorAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {}
+
+func (AnchorAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int) {
+	frame.Marbles[self].Triggered = true
+}
+
+// Goes straight through other marbles on the throw, it still bounces off walls and obstacles
+// once it first comes to rest it's as solid as anything else
+type GhostAbility struct{}
+
+func (GhostAbility) Name() string                 { return "Ghost" }
+func (GhostAbility) Solid(marble *Marble) bool    { return marble.Triggered }
+func (GhostAbility) Anchored(marble *Marble) bool { return false }
+
+func (GhostAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {}
+
+func (GhostAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int) {
+	if frame.Marbles[self].Triggered {
+		return
+	}
+	frame.Marbles[self].Triggered = true
+	// it may have stopped inside another marble
+	frame.HandleCollisions(marbleGame)
+}
+
+// how far either half veers off the way the splitter was going, in radians
+const splitAngle = 20 * math.Pi / 180
+
+// Breaks into two Small Marbles on the first thing it hits, side by side inside where it was
+// they fly apart either side of its path, carrying its momentum between them
+type SplitterAbility struct{}
+
+func (SplitterAbility) Name() string                 { return "Splitter" }
+func (SplitterAbility) Solid(marble *Marble) bool    { return true }
+func (SplitterAbility) Anchored(marble *Marble) bool { return false }
+
+func (SplitterAbility) Impact(marbleGame *MarbleGame, frame *MarbleGameFrame, self, other int) {
+	splitter := frame.Marbles[self]
+	small := MarbleTypes[2]
+
+	heading := vector2.Vector2{X: 1, Y: 0}
+	speed := splitter.Vel.Magnitude()
+	if speed > 0 {
+		heading = *splitter.Vel.DivScalar(speed)
+	}
+	side := vector2.Vector2{X: -heading.Y, Y: heading.X}
+	veer := speed * math.Tan(splitAngle)
+
+	halves := [2]Marble{}
+	for i, sign := range []float64{1, -1} {
+		halves[i] = Marble{
+			Id:    marbleGame.NextMarbleId,
+			Pos:   *splitter.Pos.Add(side.MulScalar(sign * small.Radius)),
+			Vel:   *splitter.Vel.Sub(side.MulScalar(sign * veer)), // travel is opposite to Vel, so this half heads out its own side
+			Rot:   splitter.Rot,
+			Type:  small,
+			Owner: splitter.Owner,
+		}
+		marbleGame.NextMarbleId++
+	}
+
+	// the first half takes the splitter's place so every other index stays the same
+	frame.Marbles[self] = halves[0]
+	frame.Marbles = append(frame.Marbles, halves[1])
+}
+
+func (SplitterAbility) Rest(marbleGame *MarbleGame, frame *MarbleGameFrame, self int) {}
+
+// The marbles moving with marble i, stuck together in its Group, i included
+func (frame *MarbleGameFrame) lump(i int) []int {
+	group := frame.Marbles[i].Group
+	if group == 0 {
+		return []int{i}
+	}
+	lump := []int{}
+	for j := range frame.Marbles {
+		if frame.Marbles[j].Group == group {
+			lump = append(lump, j)
+		}
+	}
+	return lump
+}
+
+// Marbles stuck together push back with the whole lump's mass
+func (frame *MarbleGameFrame) massOf(i int) float64 {
+	mass := 0.0
+	for _, j := range frame.lump(i) {
+		mass += frame.Marbles[j].Type.Mass
+	}
+	return mass
+}
+
+// Whether marble i, or anything stuck to it, is anchored
+func (frame *MarbleGameFrame) immovable(i int) bool {
+	for _, j := range frame.lump(i) {
+		m := &frame.Marbles[j]
+		if m.Type.ability().Anchored(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether marbles i and j bump into each other
+func (frame *MarbleGameFrame) collides(i, j int) bool {
+	m1, m2 := &frame.Marbles[i], &frame.Marbles[j]
+	if m1.Group != 0 && m1.Group == m2.Group {
+		return false
+	}
+	return m1.Type.ability().Solid(m1) && m2.Type.ability().Solid(m2)
+}
+
+// Gives everything stuck to marble i the velocity it has
+func (frame *MarbleGameFrame) carry(i int) {
+	for _, j := range frame.lump(i) {
+		frame.Marbles[j].Vel = frame.Marbles[i].Vel
+	}
+}
+
+// Shares out the momentum of marble i's lump so it all moves at the same velocity, anchored lumps don't move at all
+func (frame *MarbleGameFrame) unify(i int) {
+	lump := frame.lump(i)
+	vel := vector2.Vector2{}
+	if !frame.immovable(i) {
+		for _, j := range lump {
+			vel = *vel.Add(frame.Marbles[j].Vel.MulScalar(frame.Marbles[j].Type.Mass))
+		}
+		vel = *vel.DivScalar(frame.massOf(i))
+	}
+	for _, j := range lump {
+		frame.Marbles[j].Vel = vel
+	}
+}
+
+// Joins marble j, and whatever it's stuck to, onto marble i's Group
+func (frame *MarbleGameFrame) stick(i, j int) {
+	group := frame.Marbles[i].Group
+	if group == 0 {
+		for _, m := range frame.Marbles {
+			group = max(group, m.Group)
+		}
+		group++
+		frame.Marbles[i].Group = group
+	}
+	for _, k := range frame.lump(j) {
+		frame.Marbles[k].Group = group
+	}
+	// spin would pull them apart, whatever's stuck together just slides
+	for _, k := range frame.lump(i) {
+		frame.Marbles[k].stopSpinning()
+	}
+	frame.unify(i)
+}
+
+// Bounces marbles i and j off each other, where normal points from j to i
+// anchored marbles act like walls, and marbles stuck together bounce as one
+func (frame *MarbleGameFrame) bounce(config *MarbleGameConfig, i, j int, normal *vector2.Vector2) {
+	fixed1, fixed2 := frame.immovable(i), frame.immovable(j)
+	restitution := frame.restitution(config, i, j)
+	switch {
+	case fixed1 && fixed2:
+		return
+	case fixed2:
+		reflectOffBoundary(&frame.Marbles[i], *normal, restitution)
+	case fixed1:
+		reflectOffBoundary(&frame.Marbles[j], *normal.MulScalar(-1), restitution)
+	default:
+		resolveElasticCollision(&frame.Marbles[i], &frame.Marbles[j], frame.massOf(i), frame.massOf(j), restitution, normal)
+	}
+	frame.carry(i)
+	frame.carry(j)
+}
+
+// Lets abilities know about marbles at rest
+func (frame *MarbleGameFrame) settle(marbleGame *MarbleGame) {
+	for i := range frame.Marbles {
+		m := &frame.Marbles[i]
+		if m.Vel.X == 0 && m.Vel.Y == 0 {
+			m.Type.ability().Rest(marbleGame, frame, i)
+		}
+	}
+}
+
+// Lets marble self's ability react to what it just hit
+func (frame *MarbleGameFrame) impacted(marbleGame *MarbleGame, self, other int) {
+	frame.Marbles[self].Type.ability().Impact(marbleGame, frame, self, other)
+}
@@ -0,0 +1,272 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"math"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func TestAbilityByName(t *testing.T) {
+	for _, marbleType := range []engine.MarbleType{engine.ExplosiveMarble, engine.StickyMarble, engine.AnchorMarble, engine.GhostMarble, engine.SplitterMarble} {
+		if _, err := engine.AbilityByName(marbleType.Ability); err != nil {
+			t.Errorf("FAIL %s ability: %v", marbleType.Name, err)
+		}
+	}
+	if _, err := engine.AbilityByName("teleport"); err == nil {
+		t.Errorf("FAIL unknown ability should error")
+	}
+}
+
+func TestExplosiveBlowsNeighboursAway(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	testCases := []struct {
+		desc      string
+		triggered bool
+		wantBlast bool
+	}{
+		{desc: "First hit sets it off", triggered: false, wantBlast: true},
+		{desc: "It only goes off once", triggered: true, wantBlast: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			explosive := movingMarble(engine.ExplosiveMarble, 100, 240, 150)
+			explosive.Triggered = tC.triggered
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+				explosive,
+				movingMarble(plain, 200, 240, 0), // in its path
+				movingMarble(plain, 200, 330, 0), // close by, out of its path
+				movingMarble(plain, 500, 90, 0),  // out of range
+			}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			final := frames[len(frames)-1]
+			if !final.Marbles[0].Triggered {
+				t.Errorf("FAIL %s: explosive should be spent", tC.desc)
+			}
+			if blasted := final.Marbles[2].Pos != frame.Marbles[2].Pos; blasted != tC.wantBlast {
+				t.Errorf("FAIL %s neighbour blown away: got %v, want %v", tC.desc, blasted, tC.wantBlast)
+			}
+			if got := final.Marbles[2].Pos; tC.wantBlast && got.Y <= 330 {
+				t.Errorf("FAIL %s: neighbour should be blown away from the explosive, got %v", tC.desc, got)
+			}
+			if got := final.Marbles[3].Pos; got != frame.Marbles[3].Pos {
+				t.Errorf("FAIL %s: marble out of range moved to %v", tC.desc, got)
+			}
+		})
+	}
+}
+
+func TestStickyMarblesMoveAsOne(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	testCases := []struct {
+		desc    string
+		shooter engine.MarbleType
+		target  engine.MarbleType
+	}{
+		{desc: "Sticky hits a marble", shooter: engine.StickyMarble, target: plain},
+		{desc: "Marble hits a sticky", shooter: plain, target: engine.StickyMarble},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+				movingMarble(tC.shooter, 100, 240, 150),
+				movingMarble(tC.target, 200, 240, 0),
+			}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			shooter, target := frames[len(frames)-1].Marbles[0], frames[len(frames)-1].Marbles[1]
+			if shooter.Group == 0 || shooter.Group != target.Group {
+				t.Errorf("FAIL %s groups: got %d and %d, want the same one", tC.desc, shooter.Group, target.Group)
+			}
+			if gap := shooter.Pos.Distance(&target.Pos) - 60; math.Abs(gap) > 1e-6 {
+				t.Errorf("FAIL %s: should stay touching, got a gap of %v", tC.desc, gap)
+			}
+			if target.Pos.X <= 200 {
+				t.Errorf("FAIL %s: target should have been carried along, got %v", tC.desc, target.Pos)
+			}
+			// once stuck they never move apart
+			for _, f := range frames {
+				if f.Marbles[0].Vel != f.Marbles[1].Vel && f.Marbles[0].Group != 0 {
+					t.Fatalf("FAIL %s: stuck marbles moving apart, %v and %v", tC.desc, f.Marbles[0].Vel, f.Marbles[1].Vel)
+				}
+			}
+		})
+	}
+
+	t.Run("Stops dead on a wall", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{movingMarble(engine.StickyMarble, 500, 240, 200)}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		if got := frames[len(frames)-1].Marbles[0].Pos.X; math.Abs(got-570) > 1e-6 {
+			t.Errorf("FAIL sticky against the wall: got %v, want %v", got, 570)
+		}
+	})
+}
+
+func TestAnchorHoldsOnceSettled(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+
+	t.Run("Settled anchor doesn't budge", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(plain, 100, 240, 200),
+			movingMarble(engine.AnchorMarble, 300, 240, 0),
+		}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		for i, f := range frames[1:] {
+			if anchor := f.Marbles[1]; anchor.Pos != frame.Marbles[1].Pos || !anchor.Triggered {
+				t.Fatalf("FAIL frame %d: anchor at %v, anchored %v", i+1, anchor.Pos, anchor.Triggered)
+			}
+		}
+		// it only gets as far as touching the anchor
+		furthest := 0.0
+		for _, f := range frames {
+			furthest = math.Max(furthest, f.Marbles[0].Pos.X)
+		}
+		if furthest > 300-65+1e-6 || frames[len(frames)-1].Marbles[0].Pos.X >= furthest {
+			t.Errorf("FAIL shooter should bounce straight back off the anchor, got as far as %v", furthest)
+		}
+	})
+
+	t.Run("Moving anchor is knocked about", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		// head on, the anchor would roll all the way to the left wall on its own
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(plain, 100, 240, 200),
+			movingMarble(engine.AnchorMarble, 300, 240, -100),
+		}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		anchor := frames[len(frames)-1].Marbles[1]
+		if anchor.Pos.X <= 250 || !anchor.Triggered {
+			t.Errorf("FAIL anchor should be knocked back right and then settle, got %v, anchored %v", anchor.Pos, anchor.Triggered)
+		}
+	})
+}
+
+func TestGhostPassesThroughOnFirstPass(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+
+	t.Run("Through a marble on the throw", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(engine.GhostMarble, 100, 240, 120),
+			movingMarble(plain, 250, 240, 0),
+		}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		for i, f := range frames {
+			if got := f.Marbles[1].Pos; got != frame.Marbles[1].Pos {
+				t.Fatalf("FAIL frame %d: marble the ghost passed through moved to %v", i, got)
+			}
+		}
+		ghost := frames[len(frames)-1].Marbles[0]
+		if ghost.Pos.X <= 310 || !ghost.Triggered {
+			t.Errorf("FAIL ghost should end up past the marble and solid, got %v, solid %v", ghost.Pos, ghost.Triggered)
+		}
+	})
+
+	t.Run("Solid once it has settled", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		ghost := movingMarble(engine.GhostMarble, 300, 240, 0)
+		ghost.Triggered = true
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(plain, 100, 240, 200),
+			ghost,
+		}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		if got := frames[len(frames)-1].Marbles[1].Pos.X; got <= 300 {
+			t.Errorf("FAIL settled ghost should be knocked on, got %v", got)
+		}
+	})
+
+	t.Run("Pushed out of a marble it stopped in", func(t *testing.T) {
+		g := newPhysicsGame(0.1, 4)
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(engine.GhostMarble, 320, 240, 0),
+			movingMarble(plain, 300, 240, 0),
+		}}
+
+		frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+		final := frames[len(frames)-1]
+		if got := final.Marbles[0].Pos.Distance(&final.Marbles[1].Pos); got < 60 {
+			t.Errorf("FAIL ghost still inside the marble, %v apart", got)
+		}
+	})
+}
+
+func TestSplitterBreaksInTwo(t *testing.T) {
+	big := engine.MarbleTypes[1]
+	small := engine.MarbleTypes[2]
+	owner := &engine.Player{UserToken: "player 1"}
+	testCases := []struct {
+		desc   string
+		others []engine.Marble
+	}{
+		{desc: "Hitting a heavier marble", others: []engine.Marble{movingMarble(big, 180, 240, 0)}},
+		{desc: "Hitting a wall", others: []engine.Marble{}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 1)
+			g.NextMarbleId = 10
+			// right up against whatever it hits
+			splitter := movingMarble(engine.SplitterMarble, 100, 240, 150)
+			if len(tC.others) == 0 {
+				splitter.Pos.X = 570
+			}
+			splitter.Id = 7
+			splitter.Owner = owner
+			frame := engine.MarbleGameFrame{Marbles: append([]engine.Marble{splitter}, tC.others...)}
+			before := momentum(frame)
+
+			frame.Step(g)
+
+			halves := []engine.Marble{frame.Marbles[0], frame.Marbles[len(frame.Marbles)-1]}
+			if len(frame.Marbles) != len(tC.others)+2 {
+				t.Fatalf("FAIL %s: got %d marbles, want %d", tC.desc, len(frame.Marbles), len(tC.others)+2)
+			}
+			for i, half := range halves {
+				if half.Type.Name != small.Name || half.Owner != owner || half.Id != 10+i {
+					t.Errorf("FAIL %s half %d: got %s #%d owned by %v", tC.desc, i, half.Type.Name, half.Id, half.Owner)
+				}
+			}
+			if g.NextMarbleId != 12 {
+				t.Errorf("FAIL %s next marble id: got %d, want %d", tC.desc, g.NextMarbleId, 12)
+			}
+			if halves[0].Vel == halves[1].Vel {
+				t.Errorf("FAIL %s: halves should fly apart, both have %v", tC.desc, halves[0].Vel)
+			}
+			// off another marble the momentum is all still there, less a step of friction
+			if len(tC.others) > 0 {
+				after := momentum(frame)
+				if want := before.MulScalar(0.96); math.Abs(after.X-want.X) > 1e-9 || math.Abs(after.Y-want.Y) > 1e-9 {
+					t.Errorf("FAIL %s momentum: got %v, want %v", tC.desc, after, *want)
+				}
+			}
+		})
+	}
+}
+
+func momentum(frame engine.MarbleGameFrame) vector2.Vector2 {
+	total := vector2.Vector2{}
+	for _, m := range frame.Marbles {
+		total = *total.Add(m.Vel.MulScalar(m.Type.Mass))
+	}
+	return total
+}
@@ -0,0 +1,43 @@
+package engine
+
+import "errors"
+
+// Why an action was turned down, the Code is for clients to go by and the Message is for players to read
+type ActionError struct {
+	Code    ActionErrorCode `json:"code"`
+	Message string          `json:"message"`
+}
+
+type ActionErrorCode string
+
+const (
+	CodeGameOver          ActionErrorCode = "gameOver"
+	CodeInvalidPlayer     ActionErrorCode = "invalidPlayer"
+	CodeNotYourTurn       ActionErrorCode = "notYourTurn"
+	CodeNoSlot            ActionErrorCode = "noSlot"
+	CodeSlotOutOfRange    ActionErrorCode = "slotOutOfRange"
+	CodeModeRule          ActionErrorCode = "modeRule" // the GameMode turned it down, like Bocce before the jack is thrown
+	CodeOutsideLaunchZone ActionErrorCode = "outsideLaunchZone"
+	CodeOverlapsWall      ActionErrorCode = "overlapsWall"
+	CodeOverlapsObstacle  ActionErrorCode = "overlapsObstacle"
+	CodeOverlapsMarble    ActionErrorCode = "overlapsMarble"
+	CodeTakebackLimit     ActionErrorCode = "takebackLimit"
+	CodeNothingToTakeBack ActionErrorCode = "nothingToTakeBack"
+)
+
+func (err *ActionError) Error() string {
+	return err.Message
+}
+
+func actionError(code ActionErrorCode, message string) *ActionError {
+	return &ActionError{Code: code, Message: message}
+}
+
+// The code an action was turned down with, "" for errors that aren't ActionErrors
+func ActionErrorCodeOf(err error) ActionErrorCode {
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		return actionErr.Code
+	}
+	return ""
+}
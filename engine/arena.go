@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"errors"
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// The boundary marbles are kept inside, it fits in the Width x Height field:
+// a rectangle fills it, a circle is as big as fits in the middle of it,
+// a stadium is straight along the longer side with round ends, and a polygon is whatever the Points close off
+type Arena struct {
+	Shape  ArenaShape        `json:"shape"`
+	Points []vector2.Vector2 `json:"points"` // polygon corners in order, it can be concave but mustn't cross itself
+}
+
+type ArenaShape string
+
+const (
+	ArenaRectangle ArenaShape = "rectangle"
+	ArenaCircle    ArenaShape = "circle"
+	ArenaStadium   ArenaShape = "stadium"
+	ArenaPolygon   ArenaShape = "polygon"
+)
+
+// The field every match used before arenas
+var RectangleArena = Arena{Shape: ArenaRectangle, Points: []vector2.Vector2{}}
+
+// Rectangles are the Width x Height field itself, and what a config without an arena gets
+func (arena *Arena) isRectangle() bool {
+	return arena.Shape == ArenaRectangle || arena.Shape == ""
+}
+
+func (arena *Arena) validate() error {
+	switch arena.Shape {
+	case ArenaRectangle, ArenaCircle, ArenaStadium:
+		return nil
+	case ArenaPolygon:
+		if len(arena.Points) < 3 {
+			return errors.New("Arenas need at least three corners")
+		}
+		if signedArea(arena.Points) == 0 {
+			return errors.New("Arenas need some room inside")
+		}
+		for i := range arena.Points {
+			for j := i + 2; j < len(arena.Points); j++ {
+				if i == 0 && j == len(arena.Points)-1 {
+					continue // neighbours around the end
+				}
+				a1, a2 := arena.Points[i], arena.Points[i+1]
+				b1, b2 := arena.Points[j], arena.Points[(j+1)%len(arena.Points)]
+				if segmentsCross(a1, a2, b1, b2) {
+					return errors.New("Arena edges can't cross")
+				}
+			}
+		}
+		return nil
+	}
+	return errors.New("Unknown arena shape")
+}
+
+// Circles and stadiums are everything within a radius of a line down the middle of the field, a circle's line is a point
+func (config *MarbleGameConfig) arenaCapsule() (vector2.Vector2, vector2.Vector2, float64) {
+	width, height := float64(config.Width), float64(config.Height)
+	center := vector2.Vector2{X: width / 2, Y: height / 2}
+	radius := math.Min(width, height) / 2
+	if config.Arena.Shape == ArenaCircle {
+		return center, center, radius
+	}
+	if width >= height {
+		return vector2.Vector2{X: radius, Y: center.Y}, vector2.Vector2{X: width - radius, Y: center.Y}, radius
+	}
+	return vector2.Vector2{X: center.X, Y: radius}, vector2.Vector2{X: center.X, Y: height - radius}, radius
+}
+
+// Where the point is on or inside the arena, points outside are moved to the nearest spot on the boundary
+func (config *MarbleGameConfig) clampInsideArena(point vector2.Vector2) vector2.Vector2 {
+	switch config.Arena.Shape {
+	case ArenaCircle, ArenaStadium:
+		a, b, radius := config.arenaCapsule()
+		spine := closestPointOnSegment(point, a, b)
+		if distance := point.Distance(&spine); distance > radius {
+			return *spine.Add(point.Sub(&spine).MulScalar(radius / distance))
+		}
+		return point
+	case ArenaPolygon:
+		if pointInPolygon(point, config.Arena.Points) {
+			return point
+		}
+		closest, _ := closestPointOnPolygon(point, config.Arena.Points)
+		return closest
+	}
+	return vector2.Vector2{
+		X: math.Min(math.Max(point.X, 0), float64(config.Width)),
+		Y: math.Min(math.Max(point.Y, 0), float64(config.Height)),
+	}
+}
+
+// How far a drag from pos can pull along pull (a unit vector) and still be let go inside the arena, at most power
+// pos should be inside, a drag crossing out of a concave arena is cut short at one of the edges it crosses
+func (config *MarbleGameConfig) DragInsideArena(pos vector2.Vector2, pull vector2.Vector2, power float64) float64 {
+	inside := func(distance float64) bool {
+		point := vector2.Vector2{X: pos.X + pull.X*distance, Y: pos.Y + pull.Y*distance}
+		return config.clampInsideArena(point) == point
+	}
+	if power <= 0 || inside(power) {
+		return math.Max(power, 0)
+	}
+	// low stays inside and high outside, halving the gap until it's far finer than a pixel
+	low, high := 0.0, power
+	for range 40 {
+		middle := (low + high) / 2
+		if inside(middle) {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return low
+}
+
+// When a marble first touches the boundary, for everything but rectangles which wallTimeOfImpact handles
+func (config *MarbleGameConfig) arenaTimeOfImpact(marble *Marble) (float64, bool) {
+	travel := marble.Vel.MulScalar(-1)
+	radius := marble.Type.Radius
+
+	if config.Arena.Shape == ArenaPolygon {
+		earliest := math.Inf(1)
+		points := config.Arena.Points
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if t, ok := segmentTimeOfImpact(marble.Pos, *travel, radius, a, b); ok && t < earliest {
+				earliest = t
+			}
+			// corners poking into the arena are hit like bumpers with no size
+			if t, ok := sweptTimeOfImpact(marble.Pos.Sub(&a), travel, radius); ok && t < earliest {
+				earliest = t
+			}
+		}
+		return earliest, !math.IsInf(earliest, 1)
+	}
+
+	a, b, arenaRadius := config.arenaCapsule()
+	return capsuleExitTime(marble.Pos, *travel, a, b, arenaRadius-radius)
+}
+
+// How far a marble pokes out of the boundary, and the normal pointing back in
+// a negative depth is the room it has left
+func (config *MarbleGameConfig) arenaContact(pos vector2.Vector2, radius float64) (vector2.Vector2, float64) {
+	if config.Arena.Shape == ArenaPolygon {
+		closest, edge := closestPointOnPolygon(pos, config.Arena.Points)
+		distance := pos.Distance(&closest)
+		if distance == 0 {
+			return inwardNormal(edge, config.Arena.Points), radius
+		}
+		if pointInPolygon(pos, config.Arena.Points) {
+			return *pos.Sub(&closest).DivScalar(distance), radius - distance
+		}
+		return *closest.Sub(&pos).DivScalar(distance), radius + distance
+	}
+
+	a, b, arenaRadius := config.arenaCapsule()
+	spine := closestPointOnSegment(pos, a, b)
+	distance := pos.Distance(&spine)
+	if distance == 0 {
+		return vector2.Vector2{X: 0, Y: 1}, radius - arenaRadius
+	}
+	return *spine.Sub(&pos).DivScalar(distance), distance + radius - arenaRadius
+}
+
+// Pushes a marble poking out of the boundary back in, and turns it round if it's still heading out
+// polygons check every edge, so a marble wedged in a corner comes out of both sides
+func (config *MarbleGameConfig) keepInsideArena(marble *Marble) {
+	restitution := config.PhysicsOf(marble.Type).Restitution
+	normal, depth := config.arenaContact(marble.Pos, marble.Type.Radius)
+	if depth > contactEpsilon {
+		marble.Pos = *marble.Pos.Add(normal.MulScalar(depth))
+		reflectOffBoundary(marble, normal, restitution)
+	}
+
+	if config.Arena.Shape != ArenaPolygon {
+		return
+	}
+	points := config.Arena.Points
+	for i := range points {
+		closest := closestPointOnSegment(marble.Pos, points[i], points[(i+1)%len(points)])
+		distance := marble.Pos.Distance(&closest)
+		if distance == 0 || distance >= marble.Type.Radius-contactEpsilon {
+			continue
+		}
+		normal := *marble.Pos.Sub(&closest).DivScalar(distance)
+		marble.Pos = *closest.Add(normal.MulScalar(marble.Type.Radius))
+		reflectOffBoundary(marble, normal, restitution)
+	}
+}
+
+// Mirrors the marble's velocity off the boundary if it's heading out (travel is opposite to Vel)
+// normal points into the arena, and restitution is the share of speed into it that comes back out
+func reflectOffBoundary(marble *Marble, normal vector2.Vector2, restitution float64) {
+	out := marble.Vel.Dot(&normal)
+	if out <= 0 {
+		return
+	}
+	marble.Vel = *marble.Vel.Sub(normal.MulScalar((1 + restitution) * out))
+}
+
+// The earliest t >= 0 where a point moving along travel from inside gets radius away from the segment a-b
+// the straight sides and the round ends are solved separately
+func capsuleExitTime(pos, travel, a, b vector2.Vector2, radius float64) (float64, bool) {
+	if travel.X == 0 && travel.Y == 0 {
+		return 0, false
+	}
+	spine := closestPointOnSegment(pos, a, b)
+	if pos.Distance(&spine) > radius+contactEpsilon {
+		// already outside, that's for keepInsideArena
+		return 0, false
+	}
+
+	earliest := math.Inf(1)
+
+	edge := b.Sub(&a)
+	length := edge.Magnitude()
+	if length > 0 {
+		along := *edge.DivScalar(length)
+		normal := vector2.Vector2{X: -along.Y, Y: along.X}
+		offset := pos.Sub(&a).Dot(&normal)
+		speed := travel.Dot(&normal)
+		if speed != 0 {
+			side := radius
+			if speed < 0 {
+				side = -radius
+			}
+			t := math.Max((side-offset)/speed, 0)
+			exit := pos.Add(travel.MulScalar(t))
+			if projected := exit.Sub(&a).Dot(&along); projected >= 0 && projected <= length {
+				earliest = t
+			}
+		}
+	}
+
+	for _, end := range []vector2.Vector2{a, b} {
+		p := pos.Sub(&end)
+		qa := travel.Dot(&travel)
+		qb := 2 * p.Dot(&travel)
+		qc := p.Dot(p) - radius*radius
+		discriminant := qb*qb - 4*qa*qc
+		if discriminant < 0 {
+			continue
+		}
+		t := math.Max((-qb+math.Sqrt(discriminant))/(2*qa), 0)
+		exit := pos.Add(travel.MulScalar(t))
+		// only the half of the circle past the end of the spine is boundary
+		if length > 0 {
+			projected := exit.Sub(&a).Dot(edge) / length
+			if (end == a && projected > 0) || (end == b && projected < length) {
+				continue
+			}
+		}
+		earliest = math.Min(earliest, t)
+	}
+
+	return earliest, !math.IsInf(earliest, 1)
+}
+
+// Counts how many edges a ray to the right crosses, so it works for concave polygons too
+func pointInPolygon(point vector2.Vector2, points []vector2.Vector2) bool {
+	inside := false
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		if (a.Y > point.Y) != (b.Y > point.Y) {
+			crossingX := a.X + (point.Y-a.Y)/(b.Y-a.Y)*(b.X-a.X)
+			if point.X < crossingX {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// The nearest point on the polygon's outline, and the index of the edge it's on
+func closestPointOnPolygon(point vector2.Vector2, points []vector2.Vector2) (vector2.Vector2, int) {
+	var closest vector2.Vector2
+	closestEdge := 0
+	distance := math.Inf(1)
+	for i := range points {
+		candidate := closestPointOnSegment(point, points[i], points[(i+1)%len(points)])
+		if d := point.Distance(&candidate); d < distance {
+			closest, closestEdge, distance = candidate, i, d
+		}
+	}
+	return closest, closestEdge
+}
+
+// The normal of the polygon's edge i pointing inside, whichever way round the corners go
+func inwardNormal(i int, points []vector2.Vector2) vector2.Vector2 {
+	a, b := points[i], points[(i+1)%len(points)]
+	edge := b.Sub(&a).Normalize()
+	normal := vector2.Vector2{X: -edge.Y, Y: edge.X}
+	if signedArea(points) < 0 {
+		normal = *normal.MulScalar(-1)
+	}
+	return normal
+}
+
+// Positive when the corners go anticlockwise in maths terms, clockwise on screen where Y points down
+func signedArea(points []vector2.Vector2) float64 {
+	area := 0.0
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		area += cross(&a, &b)
+	}
+	return area / 2
+}
+
+// Whether the segments a1-a2 and b1-b2 cross or touch
+func segmentsCross(a1, a2, b1, b2 vector2.Vector2) bool {
+	side := func(p, q, r vector2.Vector2) float64 {
+		return cross(q.Sub(&p), r.Sub(&p))
+	}
+	d1, d2 := side(b1, b2, a1), side(b1, b2, a2)
+	d3, d4 := side(a1, a2, b1), side(a1, a2, b2)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	onSegment := func(p, q, r vector2.Vector2) bool {
+		return math.Min(p.X, q.X) <= r.X && r.X <= math.Max(p.X, q.X) && math.Min(p.Y, q.Y) <= r.Y && r.Y <= math.Max(p.Y, q.Y)
+	}
+	return (d1 == 0 && onSegment(b1, b2, a1)) || (d2 == 0 && onSegment(b1, b2, a2)) ||
+		(d3 == 0 && onSegment(a1, a2, b1)) || (d4 == 0 && onSegment(a1, a2, b2))
+}
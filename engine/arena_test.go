@@ -0,0 +1,247 @@
+package engine_test
+
+import (
+	"fmt"
+	"marblegame/engine"
+	"math"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/ungerik/go3d/float64/quaternion"
+)
+
+var (
+	hexagonArena = engine.Arena{Shape: engine.ArenaPolygon, Points: []vector2.Vector2{
+		{X: 530, Y: 240}, {X: 415, Y: 439}, {X: 185, Y: 439}, {X: 70, Y: 240}, {X: 185, Y: 41}, {X: 415, Y: 41},
+	}}
+	// an L, the corner at (300, 240) pokes into the arena
+	concaveArena = engine.Arena{Shape: engine.ArenaPolygon, Points: []vector2.Vector2{
+		{X: 0, Y: 0}, {X: 600, Y: 0}, {X: 600, Y: 240}, {X: 300, Y: 240}, {X: 300, Y: 480}, {X: 0, Y: 480},
+	}}
+)
+
+func distanceToSegment(p, a, b vector2.Vector2) float64 {
+	edge := b.Sub(&a)
+	along := math.Min(math.Max(p.Sub(&a).Dot(edge)/edge.Dot(edge), 0), 1)
+	return p.Distance(a.Add(edge.MulScalar(along)))
+}
+
+// whether a marble at pos is entirely inside the default 600x480 field's arena
+func insideArena(arena engine.Arena, pos vector2.Vector2, radius float64) bool {
+	const slack = 1e-6
+	switch arena.Shape {
+	case engine.ArenaCircle:
+		return pos.Distance(&vector2.Vector2{X: 300, Y: 240})+radius <= 240+slack
+	case engine.ArenaStadium:
+		return distanceToSegment(pos, vector2.Vector2{X: 240, Y: 240}, vector2.Vector2{X: 360, Y: 240})+radius <= 240+slack
+	case engine.ArenaPolygon:
+		inside := false
+		for i := range arena.Points {
+			a, b := arena.Points[i], arena.Points[(i+1)%len(arena.Points)]
+			if distanceToSegment(pos, a, b) < radius-slack {
+				return false
+			}
+			if (a.Y > pos.Y) != (b.Y > pos.Y) && pos.X < a.X+(pos.Y-a.Y)/(b.Y-a.Y)*(b.X-a.X) {
+				inside = !inside
+			}
+		}
+		return inside
+	}
+	return pos.X-radius >= -slack && pos.X+radius <= 600+slack && pos.Y-radius >= -slack && pos.Y+radius <= 480+slack
+}
+
+func TestNoTunnelingThroughArena(t *testing.T) {
+	arenas := map[string]engine.Arena{
+		"circle":  {Shape: engine.ArenaCircle},
+		"stadium": {Shape: engine.ArenaStadium},
+		"hexagon": hexagonArena,
+		"concave": concaveArena,
+	}
+	// every direction, including straight at the concave corner
+	starts := []vector2.Vector2{{X: 200, Y: 200}, {X: 200, Y: 330}}
+	for name, arena := range arenas {
+		for _, sampling := range samplings {
+			for angle := 0.0; angle < 360; angle += 22.5 {
+				for _, start := range starts {
+					t.Run(fmt.Sprintf("%s %s at %v from %v", name, sampling.desc, angle, start), func(t *testing.T) {
+						g := newPhysicsGame(sampling.timeStep, sampling.substeps)
+						g.Config.Arena = arena
+						small := engine.MarbleTypes[2]
+						direction := vector2.Vector2{X: math.Cos(angle * math.Pi / 180), Y: math.Sin(angle * math.Pi / 180)}
+						frame := engine.MarbleGameFrame{Marbles: []engine.Marble{{
+							Pos:   start,
+							Vel:   *direction.MulScalar(-maxShotSpeed),
+							Rot:   quaternion.Ident,
+							Type:  small,
+							Owner: &engine.Player{},
+						}}}
+
+						frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+						for i, f := range frames {
+							if m := f.Marbles[0]; !insideArena(arena, m.Pos, m.Type.Radius) {
+								t.Fatalf("FAIL frame %d: marble at %v left the %s", i, m.Pos, name)
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestArenaReflectsOffBoundaryNormal(t *testing.T) {
+	// every frame keeps this much velocity to friction, with one step per frame
+	const friction = 0.96
+	// the hexagon's bottom right edge, from (530, 240) to (415, 439)
+	slant := vector2.Vector2{X: 199, Y: 115}
+	slant = *slant.Normalize() // pointing inside
+	in := vector2.Vector2{X: -100, Y: -20}
+	testCases := []struct {
+		desc    string
+		arena   engine.Arena
+		pos     vector2.Vector2 // where the marble touches the boundary
+		vel     vector2.Vector2 // travel is opposite to Vel
+		wantVel vector2.Vector2 // before friction
+	}{
+		{
+			desc:    "Straight into a circle comes straight back",
+			arena:   engine.Arena{Shape: engine.ArenaCircle},
+			pos:     vector2.Vector2{X: 540 - 15, Y: 240},
+			vel:     vector2.Vector2{X: -100},
+			wantVel: vector2.Vector2{X: 100},
+		},
+		{
+			desc:    "Along a stadium's straight side",
+			arena:   engine.Arena{Shape: engine.ArenaStadium},
+			pos:     vector2.Vector2{X: 300, Y: 15},
+			vel:     vector2.Vector2{X: -60, Y: 80},
+			wantVel: vector2.Vector2{X: -60, Y: -80},
+		},
+		{
+			desc:    "Off a stadium's round end",
+			arena:   engine.Arena{Shape: engine.ArenaStadium},
+			pos:     vector2.Vector2{X: 600 - 15, Y: 240},
+			vel:     vector2.Vector2{X: -100},
+			wantVel: vector2.Vector2{X: 100},
+		},
+		{
+			desc:    "Off a slanted polygon edge",
+			arena:   hexagonArena,
+			pos:     *vector2.New(472.5, 339.5).Add(slant.MulScalar(15)),
+			vel:     in,
+			wantVel: *in.Sub(slant.MulScalar(2 * in.Dot(&slant))),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 1)
+			g.Config.Arena = tC.arena
+			small := engine.MarbleTypes[2]
+			// it hits halfway through the frame
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{{
+				Pos:   *tC.pos.Add(tC.vel.MulScalar(0.05)),
+				Vel:   tC.vel,
+				Rot:   quaternion.Ident,
+				Type:  small,
+				Owner: &engine.Player{},
+			}}}
+
+			frame.Step(g)
+
+			got := frame.Marbles[0].Vel
+			want := tC.wantVel.MulScalar(friction)
+			if math.Abs(got.X-want.X) > 1e-6 || math.Abs(got.Y-want.Y) > 1e-6 {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, got, *want)
+			}
+		})
+	}
+}
+
+func TestLaunchClampFollowsArena(t *testing.T) {
+	// placed at (450, 240) and released way off the right of the field
+	testCases := []struct {
+		desc  string
+		arena engine.Arena
+		want  float64 // launch speed, the clamped release point is this far right of the marble
+	}{
+		{desc: "Rectangle", arena: engine.RectangleArena, want: 150},
+		{desc: "Circle", arena: engine.Arena{Shape: engine.ArenaCircle}, want: 90},
+		{desc: "Stadium", arena: engine.Arena{Shape: engine.ArenaStadium}, want: 150},
+		{desc: "Polygon", arena: hexagonArena, want: 80},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 1)
+			g.Config.Arena = tC.arena
+			action := shoot("player 1", 450, 240)
+			action.Vel = vector2.Vector2{X: 800, Y: 240}
+
+			frame, err := g.ValidateGameAction(action, g.Frames[len(g.Frames)-1])
+			if err != nil {
+				t.Fatalf("FAIL validating: %v", err)
+			}
+
+			// Vel points back at the release point, the marble travels the other way
+			if got := frame.Marbles[0].Vel; math.Abs(got.X-tC.want) > 1e-9 || got.Y != 0 {
+				t.Errorf("FAIL %s launch: got %v, want %v", tC.desc, got, vector2.Vector2{X: tC.want})
+			}
+		})
+	}
+}
+
+func TestDragInsideArena(t *testing.T) {
+	// dragged from (450, 240) towards the right of the field
+	testCases := []struct {
+		desc  string
+		arena engine.Arena
+		power float64
+		want  float64
+	}{
+		{desc: "Short drag", arena: hexagonArena, power: 40, want: 40},
+		{desc: "Rectangle", arena: engine.RectangleArena, power: 1000, want: 150},
+		{desc: "Circle", arena: engine.Arena{Shape: engine.ArenaCircle}, power: 1000, want: 90},
+		{desc: "Stadium", arena: engine.Arena{Shape: engine.ArenaStadium}, power: 1000, want: 150},
+		{desc: "Polygon", arena: hexagonArena, power: 1000, want: 80},
+		{desc: "No power", arena: engine.RectangleArena, power: -5, want: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := engine.NewMarbleGame().Config
+			config.Arena = tC.arena
+
+			got := config.DragInsideArena(vector2.Vector2{X: 450, Y: 240}, vector2.Vector2{X: 1}, tC.power)
+			if got > tC.want || tC.want-got > 1e-6 {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestMarbleOutsideArenaIsPulledIn(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		arena engine.Arena
+		pos   vector2.Vector2
+	}{
+		{desc: "Circle's corner", arena: engine.Arena{Shape: engine.ArenaCircle}, pos: vector2.Vector2{X: 20, Y: 20}},
+		{desc: "Stadium's corner", arena: engine.Arena{Shape: engine.ArenaStadium}, pos: vector2.Vector2{X: 580, Y: 460}},
+		{desc: "Off the polygon", arena: hexagonArena, pos: vector2.Vector2{X: 40, Y: 40}},
+		{desc: "In the concave notch", arena: concaveArena, pos: vector2.Vector2{X: 320, Y: 260}},
+		{desc: "Half over a polygon edge", arena: hexagonArena, pos: vector2.Vector2{X: 300, Y: 45}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			g.Config.Arena = tC.arena
+			big := engine.MarbleTypes[1]
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{movingMarble(big, tC.pos.X, tC.pos.Y, 0)}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			if got := frames[len(frames)-1].Marbles[0].Pos; !insideArena(tC.arena, got, big.Radius) {
+				t.Errorf("FAIL %s: marble left at %v", tC.desc, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+// Thrown to start every Bocce end, everyone scores by how close they get to it
+var Jack = MarbleType{
+	Name:        "Jack",
+	Description: "Neutral. Thrown first, everyone scores by how close they get to it.",
+	Radius:      12,
+	Mass:        4,
+	Neutral:     true,
+}
+
+// Marbles each player throws in a Bocce end
+const bocceMarblesPerEnd = 4
+
+// Every end the jack is thrown first, then whoever isn't closest to it throws next.
+// When everyone is out of marbles only the closest player scores, a point for every marble nearer than anyone else's best.
+// The jack can be knocked about, and the scoring follows it.
+type BocceMode struct{}
+
+func (BocceMode) Name() string { return "Bocce" }
+
+func (BocceMode) Description() string {
+	return "Throw the jack, then land closer to it than anyone else."
+}
+
+// Everyone gets the same marbles, and the first player seated throws the first jack
+func (BocceMode) Setup(marbleGame *MarbleGame, player *Player) {
+	player.Inventory = bocceInventory()
+	if len(marbleGame.TurnOrder) == 0 {
+		player.Inventory = append([]MarbleType{Jack}, player.Inventory...)
+	}
+}
+
+func (BocceMode) ValidateAction(marbleGame *MarbleGame, action Action, player *Player) error {
+	if holdsJack(player) && !player.Inventory[action.InventorySlot].Neutral {
+		return errors.New("Throw the jack first")
+	}
+	return nil
+}
+
+func (BocceMode) ScoreFrame(marbleGame *MarbleGame, frame *MarbleGameFrame) {
+	for userToken, total := range marbleGame.EndTotals() {
+		marbleGame.Players[userToken].Score = total
+	}
+
+	frame.scoreAroundJack()
+	for _, m := range frame.Marbles {
+		if m.Owner != nil {
+			m.Owner.Score += m.Score
+		}
+	}
+}
+
+// Once everyone has thrown, the end is banked and the jack goes to whoever won it
+func (mode BocceMode) EndTurn(marbleGame *MarbleGame, frame *MarbleGameFrame) {
+	if !marbleGame.isEndOver() {
+		return
+	}
+
+	end := marbleGame.finishEnd(frame)
+	if mode.IsGameOver(marbleGame) {
+		return
+	}
+	marbleGame.startNextEnd(frame, bocceInventory)
+
+	// nobody scored, so the jack moves on round the table
+	next := marbleGame.TurnOrder[(marbleGame.ActivePlayerIndex+1)%len(marbleGame.TurnOrder)]
+	if winner, exists := marbleGame.Players[end.Winner]; exists {
+		next = winner
+	}
+	next.Inventory = append([]MarbleType{Jack}, next.Inventory...)
+}
+
+// Whoever holds the jack starts the end, then it's whoever is farthest from it with marbles left,
+// players with nothing on the field count as farthest of all
+func (BocceMode) NextPlayer(marbleGame *MarbleGame) int {
+	for i, player := range marbleGame.TurnOrder {
+		if holdsJack(player) {
+			return i
+		}
+	}
+
+	closest := marbleGame.Frames[len(marbleGame.Frames)-1].closestToJack()
+
+	next := -1
+	farthest := -1.0
+	for offset := range marbleGame.TurnOrder {
+		// starting from the active player, so the jack thrower keeps going until someone has a marble down
+		i := (marbleGame.ActivePlayerIndex + offset) % len(marbleGame.TurnOrder)
+		player := marbleGame.TurnOrder[i]
+		if len(player.Inventory) == 0 {
+			continue
+		}
+		distance, onField := closest[player]
+		if !onField {
+			distance = math.Inf(1)
+		}
+		if distance > farthest {
+			next = i
+			farthest = distance
+		}
+	}
+
+	if next == -1 {
+		return marbleGame.nextPlayerWithMarbles()
+	}
+	return next
+}
+
+// Points only count towards the TargetScore once their end is banked
+func (BocceMode) IsGameOver(marbleGame *MarbleGame) bool {
+	return marbleGame.areEndsOver(marbleGame.EndTotals())
+}
+
+func bocceInventory() []MarbleType {
+	inventory := []MarbleType{}
+	for range bocceMarblesPerEnd {
+		inventory = append(inventory, MarbleTypes[0])
+	}
+	return inventory
+}
+
+func holdsJack(player *Player) bool {
+	return slices.ContainsFunc(player.Inventory, func(marbleType MarbleType) bool { return marbleType.Neutral })
+}
+
+func (frame *MarbleGameFrame) jack() *Marble {
+	for i := range frame.Marbles {
+		if frame.Marbles[i].Type.Neutral {
+			return &frame.Marbles[i]
+		}
+	}
+	return nil
+}
+
+// The gap between a marble's edge and the jack's
+func distanceToJack(m *Marble, jack *Marble) float64 {
+	return m.Pos.Distance(&jack.Pos) - m.Type.Radius - jack.Type.Radius
+}
+
+// Each player's nearest marble to the jack, players with no marbles on the field are left out
+func (frame *MarbleGameFrame) closestToJack() map[*Player]float64 {
+	closest := make(map[*Player]float64)
+	jack := frame.jack()
+	if jack == nil {
+		return closest
+	}
+	for i := range frame.Marbles {
+		m := &frame.Marbles[i]
+		if m.Owner == nil {
+			continue
+		}
+		distance := distanceToJack(m, jack)
+		if best, exists := closest[m.Owner]; !exists || distance < best {
+			closest[m.Owner] = distance
+		}
+	}
+	return closest
+}
+
+// Gives a point to each of the closest player's marbles that's nearer the jack than everyone else's best
+// players tied for closest both score nothing
+func (frame *MarbleGameFrame) scoreAroundJack() {
+	for i := range frame.Marbles {
+		frame.Marbles[i].Score = 0
+		frame.Marbles[i].HighlightColor = "#12121200"
+	}
+
+	jack := frame.jack()
+	if jack == nil {
+		return
+	}
+	jack.HighlightColor = "#ffffffff"
+
+	var leader *Player
+	leaderDistance, runnerUpDistance := math.Inf(1), math.Inf(1)
+	for player, distance := range frame.closestToJack() {
+		if distance < leaderDistance {
+			leader, leaderDistance, runnerUpDistance = player, distance, leaderDistance
+		} else if distance < runnerUpDistance {
+			runnerUpDistance = distance
+		}
+	}
+
+	for i := range frame.Marbles {
+		m := &frame.Marbles[i]
+		if m.Owner == leader && m.Owner != nil && distanceToJack(m, jack) < runnerUpDistance {
+			m.Score = 1
+			m.HighlightColor = "#ffffff80"
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"reflect"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func newBocceGame(t *testing.T) *engine.MarbleGame {
+	t.Helper()
+	g := engine.NewMarbleGame()
+	g.Config.Mode = engine.BocceMode{}.Name()
+	for _, userToken := range []string{"player 1", "player 2"} {
+		if _, err := g.AddPlayer(userToken); err != nil {
+			t.Fatalf("FAIL adding %s: %v", userToken, err)
+		}
+	}
+	return g
+}
+
+func TestBocceScoring(t *testing.T) {
+	// marbles are placed along the x axis from the jack at 300, so x is how far away they are
+	type placed struct {
+		owner string
+		x     float64
+	}
+	testCases := []struct {
+		desc    string
+		marbles []placed
+		noJack  bool
+		want    map[string]int
+	}{
+		{
+			desc:    "Nothing but the jack",
+			marbles: []placed{},
+			want:    map[string]int{"player 1": 0, "player 2": 0},
+		},
+		{
+			desc:    "Only one player has thrown",
+			marbles: []placed{{"player 1", 400}, {"player 1", 200}},
+			want:    map[string]int{"player 1": 2, "player 2": 0},
+		},
+		{
+			desc:    "Closest player scores the marbles nearer than the other's best",
+			marbles: []placed{{"player 1", 360}, {"player 1", 240}, {"player 1", 500}, {"player 2", 420}},
+			want:    map[string]int{"player 1": 2, "player 2": 0},
+		},
+		{
+			desc:    "The other player can hold the point",
+			marbles: []placed{{"player 1", 400}, {"player 2", 350}, {"player 2", 160}, {"player 2", 240}},
+			want:    map[string]int{"player 1": 0, "player 2": 2},
+		},
+		{
+			desc:    "Tied for closest, nobody scores",
+			marbles: []placed{{"player 1", 360}, {"player 2", 240}},
+			want:    map[string]int{"player 1": 0, "player 2": 0},
+		},
+		{
+			desc:    "No jack, nobody scores",
+			marbles: []placed{{"player 1", 360}},
+			noJack:  true,
+			want:    map[string]int{"player 1": 0, "player 2": 0},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newBocceGame(t)
+
+			frame := engine.MarbleGameFrame{}
+			if !tC.noJack {
+				frame.Marbles = append(frame.Marbles, engine.Marble{Pos: vector2.Vector2{X: 300, Y: 240}, Type: engine.Jack})
+			}
+			for i, m := range tC.marbles {
+				frame.Marbles = append(frame.Marbles, engine.Marble{
+					Id:    i + 1,
+					Pos:   vector2.Vector2{X: m.x, Y: 240},
+					Type:  engine.MarbleTypes[0],
+					Owner: g.Players[m.owner],
+				})
+			}
+
+			g.Mode().ScoreFrame(g, &frame)
+
+			scores := map[string]int{}
+			for userToken, player := range g.Players {
+				scores[userToken] = player.Score
+			}
+			if !reflect.DeepEqual(scores, tC.want) {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, scores, tC.want)
+			}
+		})
+	}
+}
+
+func TestBocceJackIsThrownFirst(t *testing.T) {
+	g := newBocceGame(t)
+
+	if g.Players["player 1"].Inventory[0] != engine.Jack {
+		t.Fatalf("FAIL player 1 should start with the jack: got %v", g.Players["player 1"].Inventory)
+	}
+	if got := len(g.Players["player 2"].Inventory); got != 4 {
+		t.Errorf("FAIL player 2 inventory: got %d, want %d", got, 4)
+	}
+
+	marbleFirst := shoot("player 1", 300, 240)
+	marbleFirst.InventorySlot = 1
+	if err := g.PlayAction(marbleFirst); err == nil {
+		t.Errorf("FAIL throwing a marble before the jack should error")
+	}
+
+	if err := g.PlayAction(shoot("player 1", 300, 240)); err != nil {
+		t.Fatalf("FAIL throwing the jack: %v", err)
+	}
+	jack := g.Frames[len(g.Frames)-1].Marbles[0]
+	if jack.Owner != nil {
+		t.Errorf("FAIL the jack should have no owner: got %v", jack.Owner.UserToken)
+	}
+
+	// the jack thrower throws the first marble too
+	if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; got != "player 1" {
+		t.Errorf("FAIL after the jack: got %s's turn, want %s's", got, "player 1")
+	}
+	if err := g.PlayAction(shoot("player 1", 360, 240)); err != nil {
+		t.Fatalf("FAIL player 1 marble: %v", err)
+	}
+
+	// player 1 holds the point, so player 2 keeps throwing until they take it
+	if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; got != "player 2" {
+		t.Errorf("FAIL after player 1 holds the point: got %s's turn, want %s's", got, "player 2")
+	}
+	if err := g.PlayAction(shoot("player 2", 300, 400)); err != nil {
+		t.Fatalf("FAIL player 2 marble: %v", err)
+	}
+	if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; got != "player 2" {
+		t.Errorf("FAIL player 2 still farther: got %s's turn, want %s's", got, "player 2")
+	}
+}
+
+func TestBocceEnds(t *testing.T) {
+	g := newBocceGame(t)
+	g.Config.Ends = 2
+
+	// whoever's up throws the jack to the middle, player 1 rings it and player 2 is out in the corners
+	ring := []vector2.Vector2{{X: 360, Y: 240}, {X: 240, Y: 240}, {X: 300, Y: 300}, {X: 300, Y: 180}}
+	corners := []vector2.Vector2{{X: 40, Y: 40}, {X: 560, Y: 40}, {X: 40, Y: 440}, {X: 560, Y: 440}}
+	playEnd := func() {
+		endsBefore := len(g.Ends)
+		thrown := map[string]int{}
+		for len(g.Ends) == endsBefore {
+			player := g.TurnOrder[g.ActivePlayerIndex]
+			pos := corners[thrown[player.UserToken]]
+			if player.UserToken == "player 1" {
+				pos = ring[thrown[player.UserToken]]
+			}
+			if player.Inventory[0] == engine.Jack {
+				pos = vector2.Vector2{X: 300, Y: 240}
+			} else {
+				thrown[player.UserToken]++
+			}
+			if err := g.PlayAction(shoot(player.UserToken, pos.X, pos.Y)); err != nil {
+				t.Fatalf("FAIL %s shot: %v", player.UserToken, err)
+			}
+		}
+	}
+
+	playEnd()
+	if len(g.Ends) != 1 {
+		t.Fatalf("FAIL ends after the first: got %d, want %d", len(g.Ends), 1)
+	}
+	if want := map[string]int{"player 1": 4, "player 2": 0}; !reflect.DeepEqual(g.Ends[0].Scores, want) {
+		t.Errorf("FAIL first end scores: got %v, want %v", g.Ends[0].Scores, want)
+	}
+	if got := g.Players["player 1"].Score; got != 4 {
+		t.Errorf("FAIL player 1 score carried over: got %d, want %d", got, 4)
+	}
+	if g.State == engine.GameStateFinished {
+		t.Fatalf("FAIL the match should go on to a second end")
+	}
+	// the winner of the end throws the next jack
+	if got := g.Players["player 1"].Inventory[0]; got != engine.Jack {
+		t.Errorf("FAIL player 1 should hold the jack: got %v", got)
+	}
+	if got := len(g.Players["player 2"].Inventory); got != 4 {
+		t.Errorf("FAIL player 2 marbles handed back: got %d, want %d", got, 4)
+	}
+
+	playEnd()
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL state after %d ends: got %s, want %s", g.Config.Ends, g.State, engine.GameStateFinished)
+	}
+	if want := map[string]int{"player 1": 8, "player 2": 0}; !reflect.DeepEqual(g.EndTotals(), want) {
+		t.Errorf("FAIL totals: got %v, want %v", g.EndTotals(), want)
+	}
+
+	// the ends come back out of a replay the same
+	rebuilt, err := g.Replay().Rebuild()
+	if err != nil {
+		t.Fatalf("FAIL rebuilding: %v", err)
+	}
+	if !reflect.DeepEqual(rebuilt.Ends, g.Ends) {
+		t.Errorf("FAIL rebuilt ends: got %v, want %v", rebuilt.Ends, g.Ends)
+	}
+}
+
+func TestTargetScoringIgnoresOwnerlessMarbles(t *testing.T) {
+	g := newTwoPlayerGame(t, 1)
+	frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+		{Pos: vector2.Vector2{X: 300, Y: 240}, Type: engine.Jack},
+	}}
+
+	frame.HandleScoring(g)
+
+	if got := frame.Marbles[0].Score; got != g.Config.ScoringZones[0].BullseyeScore {
+		t.Errorf("FAIL ownerless marble score: got %d, want %d", got, g.Config.ScoringZones[0].BullseyeScore)
+	}
+}
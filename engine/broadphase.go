@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// A uniform grid that buckets marbles by the cells their bounding boxes cover,
+// so only marbles sharing a cell get checked against each other
+// the cells are a sorted list of (cell, marble) entries rather than a map, which is much cheaper to build every substep
+type spatialHash struct {
+	cellSize float64
+	entries  []cellEntry
+	boxes    []boundingBox
+}
+
+// below this many marbles, checking every pair is cheaper than building the grid
+const broadphaseMinMarbles = 32
+
+type cellEntry struct {
+	cell  int64
+	index int
+}
+
+type boundingBox struct {
+	minX, minY, maxX, maxY float64
+}
+
+func newSpatialHash(cellSize float64, marbleCount int) *spatialHash {
+	return &spatialHash{
+		cellSize: cellSize,
+		entries:  make([]cellEntry, 0, 4*marbleCount),
+		boxes:    make([]boundingBox, 0, marbleCount),
+	}
+}
+
+// Cells are one marble diameter wide, so a resting marble never covers more than 4 cells
+func (frame *MarbleGameFrame) broadphaseCellSize() float64 {
+	largestRadius := 0.0
+	for _, marbleType := range MarbleTypes {
+		largestRadius = math.Max(largestRadius, marbleType.Radius)
+	}
+	for _, m := range frame.Marbles {
+		largestRadius = math.Max(largestRadius, m.Type.Radius)
+	}
+	if largestRadius <= 0 {
+		largestRadius = 1
+	}
+	return 2 * largestRadius
+}
+
+func (h *spatialHash) cellCoords(x, y float64) (int32, int32) {
+	return int32(math.Floor(x / h.cellSize)), int32(math.Floor(y / h.cellSize))
+}
+
+// Packs cell coordinates into one sortable key
+func cellKey(x, y int32) int64 {
+	return int64(x)<<32 | int64(uint32(y))
+}
+
+// Adds the next marble to every cell its bounding box touches, marbles must be inserted in index order
+func (h *spatialHash) insert(box boundingBox) {
+	index := len(h.boxes)
+	h.boxes = append(h.boxes, box)
+
+	minX, minY := h.cellCoords(box.minX, box.minY)
+	maxX, maxY := h.cellCoords(box.maxX, box.maxY)
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			h.entries = append(h.entries, cellEntry{cell: cellKey(x, y), index: index})
+		}
+	}
+}
+
+// Every pair of marbles whose bounding boxes overlap, each pair once with the lower index first
+// sorted so collisions always resolve in the same order
+func (h *spatialHash) pairs() [][2]int {
+	slices.SortFunc(h.entries, func(a, b cellEntry) int {
+		if a.cell != b.cell {
+			return cmp.Compare(a.cell, b.cell)
+		}
+		return a.index - b.index
+	})
+
+	pairs := [][2]int{}
+	for start := 0; start < len(h.entries); {
+		end := start + 1
+		for end < len(h.entries) && h.entries[end].cell == h.entries[start].cell {
+			end++
+		}
+		cell := h.entries[start].cell
+
+		for a := start; a < end; a++ {
+			boxA := h.boxes[h.entries[a].index]
+			for b := a + 1; b < end; b++ {
+				boxB := h.boxes[h.entries[b].index]
+				if boxA.maxX < boxB.minX || boxB.maxX < boxA.minX || boxA.maxY < boxB.minY || boxB.maxY < boxA.minY {
+					continue
+				}
+
+				// a pair shares every cell their boxes' overlap covers, only report it from the first one
+				if cellKey(h.cellCoords(math.Max(boxA.minX, boxB.minX), math.Max(boxA.minY, boxB.minY))) != cell {
+					continue
+				}
+
+				pairs = append(pairs, [2]int{h.entries[a].index, h.entries[b].index})
+			}
+		}
+
+		start = end
+	}
+
+	slices.SortFunc(pairs, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return a[0] - b[0]
+		}
+		return a[1] - b[1]
+	})
+
+	return pairs
+}
+
+// Every pair of marbles, in the order the broadphase would sort them
+func (frame *MarbleGameFrame) allPairs() [][2]int {
+	pairs := [][2]int{}
+	for i := range frame.Marbles {
+		for j := i + 1; j < len(frame.Marbles); j++ {
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+	return pairs
+}
+
+// Pairs of marbles close enough to be overlapping right now
+func (frame *MarbleGameFrame) overlapCandidates() [][2]int {
+	if len(frame.Marbles) < broadphaseMinMarbles {
+		return frame.allPairs()
+	}
+	return frame.hashedOverlapCandidates()
+}
+
+// overlapCandidates through the grid, however few marbles there are
+func (frame *MarbleGameFrame) hashedOverlapCandidates() [][2]int {
+	h := newSpatialHash(frame.broadphaseCellSize(), len(frame.Marbles))
+	for _, m := range frame.Marbles {
+		r := m.Type.Radius
+		h.insert(boundingBox{m.Pos.X - r, m.Pos.Y - r, m.Pos.X + r, m.Pos.Y + r})
+	}
+	return h.pairs()
+}
+
+// Pairs of marbles that could touch somewhere along their paths over the next dt
+func (frame *MarbleGameFrame) sweepCandidates(dt float64) [][2]int {
+	if len(frame.Marbles) < broadphaseMinMarbles {
+		return frame.allPairs()
+	}
+
+	h := newSpatialHash(frame.broadphaseCellSize(), len(frame.Marbles))
+	for _, m := range frame.Marbles {
+		r := m.Type.Radius
+		endX := m.Pos.X - m.Vel.X*dt // travel is opposite to Vel
+		endY := m.Pos.Y - m.Vel.Y*dt
+		h.insert(boundingBox{
+			math.Min(m.Pos.X, endX) - r, math.Min(m.Pos.Y, endY) - r,
+			math.Max(m.Pos.X, endX) + r, math.Max(m.Pos.Y, endY) + r,
+		})
+	}
+	return h.pairs()
+}
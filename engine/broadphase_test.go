@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/ungerik/go3d/float64/quaternion"
+)
+
+// Scatters n marbles of random types over an arena that grows with n, so the density stays about the same
+func randomFrame(n int, seed int64) MarbleGameFrame {
+	r := rand.New(rand.NewSource(seed))
+	side := 100 * math.Sqrt(float64(n))
+
+	frame := MarbleGameFrame{}
+	for range n {
+		frame.Marbles = append(frame.Marbles, Marble{
+			Pos:   vector2.Vector2{X: r.Float64() * side, Y: r.Float64() * side},
+			Vel:   vector2.Vector2{X: r.Float64()*200 - 100, Y: r.Float64()*200 - 100},
+			Rot:   quaternion.Ident,
+			Type:  MarbleTypes[r.Intn(len(MarbleTypes))],
+			Owner: &Player{},
+		})
+	}
+	return frame
+}
+
+// The O(n²) pair loop the broadphase replaced
+func (frame *MarbleGameFrame) bruteForceCollisions(config *MarbleGameConfig) {
+	for i := range frame.Marbles {
+		for j := i + 1; j < len(frame.Marbles); j++ {
+			frame.collideIfOverlapping(config, i, j)
+		}
+	}
+}
+
+func TestBroadphaseFindsEveryOverlap(t *testing.T) {
+	for _, n := range []int{10, 100, 1000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			frame := randomFrame(n, int64(n))
+
+			candidates := make(map[[2]int]bool)
+			for _, pair := range frame.overlapCandidates() {
+				candidates[pair] = true
+			}
+			sweepCandidates := make(map[[2]int]bool)
+			for _, pair := range frame.sweepCandidates(0.1) {
+				sweepCandidates[pair] = true
+			}
+
+			for i := range frame.Marbles {
+				for j := i + 1; j < len(frame.Marbles); j++ {
+					m1, m2 := &frame.Marbles[i], &frame.Marbles[j]
+					if m1.Pos.Distance(&m2.Pos) < m1.Type.Radius+m2.Type.Radius && !candidates[[2]int{i, j}] {
+						t.Errorf("FAIL overlapping marbles %d and %d missing from the broadphase", i, j)
+					}
+					if _, ok := marbleTimeOfImpact(m1, m2); ok && !sweepCandidates[[2]int{i, j}] {
+						if toi, _ := marbleTimeOfImpact(m1, m2); toi <= 0.1 {
+							t.Errorf("FAIL marbles %d and %d meet within the sweep but are missing from the broadphase", i, j)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// Just the marble pairs, the grid against checking every pair, with the grid used at every size
+func BenchmarkMarbleCollisions(b *testing.B) {
+	config := NewMarbleGame().Config
+
+	for _, n := range []int{10, 100, 1000} {
+		frame := randomFrame(n, 1)
+
+		b.Run(fmt.Sprintf("spatialHash/%d", n), func(b *testing.B) {
+			for range b.N {
+				f := MarbleGameFrame{Marbles: append([]Marble{}, frame.Marbles...)}
+				for _, pair := range f.hashedOverlapCandidates() {
+					f.collideIfOverlapping(&config, pair[0], pair[1])
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("bruteForce/%d", n), func(b *testing.B) {
+			for range b.N {
+				f := MarbleGameFrame{Marbles: append([]Marble{}, frame.Marbles...)}
+				f.bruteForceCollisions(&config)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"slices"
+)
+
+// Every match is played in ends: an end is over once everyone has thrown their marbles,
+// its points are banked in Ends, then the field is cleared and everyone gets a fresh inventory for the next.
+// A match of one end (the default) is the classic game.
+
+// Every player's points from the finished ends, by userToken
+func (marbleGame *MarbleGame) EndTotals() map[string]int {
+	totals := make(map[string]int)
+	for userToken := range marbleGame.Players {
+		totals[userToken] = 0
+	}
+	for _, end := range marbleGame.Ends {
+		for userToken, score := range end.Scores {
+			totals[userToken] += score
+		}
+	}
+	return totals
+}
+
+// How many ends each player has won outright, by userToken
+func (marbleGame *MarbleGame) EndsWon() map[string]int {
+	won := make(map[string]int)
+	for userToken := range marbleGame.Players {
+		won[userToken] = 0
+	}
+	for _, end := range marbleGame.Ends {
+		if end.Winner != "" {
+			won[end.Winner]++
+		}
+	}
+	return won
+}
+
+// The end being played, counting from 1, or the last one played once the match is over
+func (marbleGame *MarbleGame) Round() int {
+	if marbleGame.State == GameStateFinished && len(marbleGame.Ends) > 0 {
+		return len(marbleGame.Ends)
+	}
+	return len(marbleGame.Ends) + 1
+}
+
+// The end is over once nobody has a marble left to throw, an empty game hasn't started one
+func (marbleGame *MarbleGame) isEndOver() bool {
+	return len(marbleGame.TurnOrder) > 0 && !slices.ContainsFunc(marbleGame.TurnOrder, func(player *Player) bool {
+		return len(player.Inventory) > 0
+	})
+}
+
+// Nobody has thrown yet in the end being played
+func (marbleGame *MarbleGame) isNewEnd() bool {
+	if len(marbleGame.Ends) == 0 {
+		return len(marbleGame.ActionLog) == 0
+	}
+	return marbleGame.Ends[len(marbleGame.Ends)-1].Actions == len(marbleGame.ActionLog)
+}
+
+// Banks the settled frame's marble scores as an End
+// it's called from EndTurn, before the shot that finished the end is logged
+func (marbleGame *MarbleGame) finishEnd(frame *MarbleGameFrame) End {
+	end := End{
+		Scores:  make(map[string]int),
+		Actions: len(marbleGame.ActionLog) + 1,
+	}
+	for userToken := range marbleGame.Players {
+		end.Scores[userToken] = 0
+	}
+	for _, m := range frame.Marbles {
+		if m.Owner != nil {
+			end.Scores[m.Owner.UserToken] += m.Score
+		}
+	}
+
+	best := 0
+	for _, player := range marbleGame.TurnOrder {
+		score := end.Scores[player.UserToken]
+		if score > best {
+			end.Winner, best = player.UserToken, score
+		} else if score == best {
+			// nobody wins a tied end
+			end.Winner = ""
+		}
+	}
+
+	marbleGame.Ends = append(marbleGame.Ends, end)
+	return end
+}
+
+// Clears the field and hands everyone a fresh inventory for the next end
+func (marbleGame *MarbleGame) startNextEnd(frame *MarbleGameFrame, inventory func() []MarbleType) {
+	frame.Marbles = []Marble{}
+	for _, player := range marbleGame.TurnOrder {
+		player.Inventory = inventory()
+	}
+}
+
+// The hammer (throwing last) goes to whoever took the fewest points in the end
+// it stays put if everyone took the same, like a blank end in curling
+func (marbleGame *MarbleGame) passHammer(end End) {
+	loser := marbleGame.TurnOrder[0].UserToken
+	tied := true
+	for _, player := range marbleGame.TurnOrder {
+		if end.Scores[player.UserToken] != end.Scores[loser] {
+			tied = false
+		}
+		if end.Scores[player.UserToken] < end.Scores[loser] {
+			loser = player.UserToken
+		}
+	}
+	if !tied {
+		marbleGame.Hammer = loser
+	}
+}
+
+// Who opens an end, the player after the hammer so they throw last
+func (marbleGame *MarbleGame) firstThrower() int {
+	i := slices.IndexFunc(marbleGame.TurnOrder, func(player *Player) bool { return player.UserToken == marbleGame.Hammer })
+	if i == -1 {
+		return 0
+	}
+	return (i + 1) % len(marbleGame.TurnOrder)
+}
+
+// Over once someone has reached the TargetScore, won the majority of a BestOf match, or all the ends are played
+// a BestOf match replays blank ends, so it's all the ends someone won
+// scores are by userToken, modes pick whether that's points banked or points on the field too
+func (marbleGame *MarbleGame) areEndsOver(scores map[string]int) bool {
+	if len(marbleGame.TurnOrder) == 0 {
+		return false
+	}
+
+	if marbleGame.Config.TargetScore > 0 {
+		for _, score := range scores {
+			if score >= marbleGame.Config.TargetScore {
+				return true
+			}
+		}
+	}
+
+	ends := max(marbleGame.Config.Ends, 1)
+	played := len(marbleGame.Ends)
+	if marbleGame.Config.BestOf {
+		played = 0
+		for _, won := range marbleGame.EndsWon() {
+			if won*2 > ends {
+				return true
+			}
+			// blank ends don't count, they're played again
+			played += won
+		}
+	}
+
+	return marbleGame.isEndOver() && played >= ends
+}
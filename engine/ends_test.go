@@ -0,0 +1,178 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"marblegame/engine"
+	"reflect"
+	"testing"
+)
+
+// Plays out the end, the winner puts their first marble on the bullseye and every other shot goes off the field
+func playEnd(t *testing.T, g *engine.MarbleGame, winner string) {
+	t.Helper()
+	endsBefore := len(g.Ends)
+	hitBullseye := false
+	for len(g.Ends) == endsBefore && g.State != engine.GameStateFinished {
+		player := g.TurnOrder[g.ActivePlayerIndex]
+		action := shootNear(t, g, 40, 40)
+		if player.UserToken == winner && !hitBullseye {
+			action = shootNear(t, g, 300, 240)
+			hitBullseye = true
+		}
+		if err := g.PlayAction(action); err != nil {
+			t.Fatalf("FAIL %s shot in end %d: %v", player.UserToken, g.Round(), err)
+		}
+	}
+}
+
+func TestEnds(t *testing.T) {
+	g := newTwoPlayerGame(t, 11)
+	g.Config.Ends = 3
+	bullseye := g.Config.ScoringZones[0].BullseyeScore
+
+	if g.Round() != 1 {
+		t.Errorf("FAIL first round: got %d, want %d", g.Round(), 1)
+	}
+
+	playEnd(t, g, "player 2")
+
+	if g.State == engine.GameStateFinished {
+		t.Fatalf("FAIL the match should go on after the first of %d ends", g.Config.Ends)
+	}
+	want := engine.End{Scores: map[string]int{"player 1": 0, "player 2": bullseye}, Winner: "player 2", Actions: 22}
+	if !reflect.DeepEqual(g.Ends, []engine.End{want}) {
+		t.Errorf("FAIL first end: got %+v, want %+v", g.Ends, []engine.End{want})
+	}
+	if got := len(g.Frames[len(g.Frames)-1].Marbles); got != 0 {
+		t.Errorf("FAIL the field should be cleared: got %d marbles", got)
+	}
+	for userToken, player := range g.Players {
+		if len(player.Inventory) != len(engine.StartingInventory()) {
+			t.Errorf("FAIL %s inventory: got %d, want a fresh %d", userToken, len(player.Inventory), len(engine.StartingInventory()))
+		}
+	}
+	// player 1 lost the end, so they take the hammer and player 2 opens
+	if g.Hammer != "player 1" {
+		t.Errorf("FAIL hammer: got %q, want %q", g.Hammer, "player 1")
+	}
+	if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; got != "player 2" {
+		t.Errorf("FAIL opening the second end: got %s, want %s", got, "player 2")
+	}
+	if g.Round() != 2 {
+		t.Errorf("FAIL second round: got %d, want %d", g.Round(), 2)
+	}
+
+	playEnd(t, g, "player 1")
+	playEnd(t, g, "player 1")
+
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL state after %d ends: got %s, want %s", g.Config.Ends, g.State, engine.GameStateFinished)
+	}
+	if g.Round() != 3 {
+		t.Errorf("FAIL last round: got %d, want %d", g.Round(), 3)
+	}
+	// the last end's marbles stay on the field to look at
+	if got := len(g.Frames[len(g.Frames)-1].Marbles); got != 1 {
+		t.Errorf("FAIL the final field: got %d marbles, want %d", got, 1)
+	}
+	wantTotals := map[string]int{"player 1": 2 * bullseye, "player 2": bullseye}
+	if !reflect.DeepEqual(g.EndTotals(), wantTotals) {
+		t.Errorf("FAIL totals: got %v, want %v", g.EndTotals(), wantTotals)
+	}
+	if got := g.Players["player 1"].Score; got != 2*bullseye {
+		t.Errorf("FAIL player 1 score: got %d, want %d", got, 2*bullseye)
+	}
+	if summary := g.Summary(); !reflect.DeepEqual(summary.Winners, []string{"player 1"}) {
+		t.Errorf("FAIL winners: got %v, want %v", summary.Winners, []string{"player 1"})
+	}
+
+	// the client gets the round, every end and the totals
+	marshalled, _ := json.Marshal(g.EncodeWire())
+	var wire struct {
+		Round  int            `json:"round"`
+		Ends   []engine.End   `json:"ends"`
+		Totals map[string]int `json:"totals"`
+	}
+	if err := json.Unmarshal(marshalled, &wire); err != nil {
+		t.Fatalf("FAIL unmarshalling wire game: %v", err)
+	}
+	if wire.Round != 3 || len(wire.Ends) != 3 || !reflect.DeepEqual(wire.Totals, wantTotals) {
+		t.Errorf("FAIL wire round, ends and totals: got %d, %v, %v", wire.Round, wire.Ends, wire.Totals)
+	}
+}
+
+func TestMatchFormats(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		ends        int
+		bestOf      bool
+		targetScore int
+		winners     []string // of each end, "" for a blank end
+		wantEnds    int      // ends played when the match finishes
+		wantWinners []string
+	}{
+		{
+			desc:        "Most points over every end",
+			ends:        3,
+			winners:     []string{"player 2", "player 1", "player 1"},
+			wantEnds:    3,
+			wantWinners: []string{"player 1"},
+		},
+		{
+			desc:        "Best of finishes once the majority is won",
+			ends:        3,
+			bestOf:      true,
+			winners:     []string{"player 2", "player 2", "player 1"},
+			wantEnds:    2,
+			wantWinners: []string{"player 2"},
+		},
+		{
+			desc:        "Best of is won on ends, not points",
+			ends:        3,
+			bestOf:      true,
+			winners:     []string{"player 1", "", "player 2", "player 2"},
+			wantEnds:    4,
+			wantWinners: []string{"player 2"},
+		},
+		{
+			desc:        "First to a score stops as soon as it's on the field",
+			ends:        5,
+			targetScore: 80,
+			winners:     []string{"player 1", "player 1"},
+			wantEnds:    1,
+			wantWinners: []string{"player 1"},
+		},
+		{
+			desc:        "Blank ends are tied",
+			ends:        2,
+			winners:     []string{"", ""},
+			wantEnds:    2,
+			wantWinners: []string{"player 1", "player 2"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 11)
+			g.Config.Ends = tC.ends
+			g.Config.BestOf = tC.bestOf
+			g.Config.TargetScore = tC.targetScore
+
+			for _, winner := range tC.winners {
+				if g.State == engine.GameStateFinished {
+					break
+				}
+				playEnd(t, g, winner)
+			}
+
+			if g.State != engine.GameStateFinished {
+				t.Fatalf("FAIL %s: match didn't finish", tC.desc)
+			}
+			if len(g.Ends) != tC.wantEnds {
+				t.Errorf("FAIL %s ends played: got %d, want %d", tC.desc, len(g.Ends), tC.wantEnds)
+			}
+			if summary := g.Summary(); !reflect.DeepEqual(summary.Winners, tC.wantWinners) {
+				t.Errorf("FAIL %s winners: got %v, want %v", tC.desc, summary.Winners, tC.wantWinners)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"errors"
+	"math/rand"
 
 	"github.com/deeean/go-vector/vector2"
 	"github.com/ungerik/go3d/float64/quaternion"
@@ -27,40 +28,153 @@ var MarbleTypes = []MarbleType{
 		Radius:      15,
 		Mass:        5,
 	},
+	ExplosiveMarble,
+	StickyMarble,
+	AnchorMarble,
+	GhostMarble,
+	SplitterMarble,
+	RubberMarble,
+	SteelMarble,
 }
 
+var (
+	RubberMarble = MarbleType{
+		Name:        "Rubber Marble",
+		Description: "Flies off the hand and bounces off everything, but drags along the ground.",
+		Radius:      30,
+		Mass:        8,
+		Physics:     Physics{Restitution: 1, RollingFriction: 0.9, MaxLaunchSpeed: 260},
+	}
+	SteelMarble = MarbleType{
+		Name:        "Steel Marble",
+		Description: "Heavy and hard to throw far. Barely bounces, but rolls a long way.",
+		Radius:      30,
+		Mass:        30,
+		Physics:     Physics{Restitution: 0.5, RollingFriction: 0.98, MaxLaunchSpeed: 160},
+	}
+)
+
 func NewMarbleGame() *MarbleGame {
-	return &MarbleGame{
+	marbleGame := &MarbleGame{
 		Players: make(map[string]*Player),
 		Frames:  []MarbleGameFrame{{Marbles: []Marble{}}},
 		Config: MarbleGameConfig{
+			Mode:                                TargetMode{}.Name(),
 			PlayerLimit:                         2,
-			ScoringZoneRadius:                   150.0,
-			ScoringZoneMaxScore:                 20,
-			ScoringZoneMinScore:                 5,
-			BullseyeZoneRadius:                  15.0,
-			BullseyeZoneScore:                   40,
 			Width:                               600,
 			Height:                              480,
 			RemoveMarblesFromOutsideScoringZone: true,
+			TargetScore:                         0,
+			Ends:                                1,
+			BestOf:                              false,
+			TimeStep:                            0.1,
+			Substeps:                            4,
+			PreviewFrames:                       15,
+			Level:                               OpenField.Name,
+			Obstacles:                           []Obstacle{},
+			LaunchZones:                         []LaunchZone{},
+			Arena:                               RectangleArena,
+			Physics:                             DefaultPhysics,
+			LeaveGrace:                          30,
+			LeaverMarbles:                       LeaverMarblesNeutral,
+			TakebacksPerMatch:                   1,
 		},
 		TurnOrder:         []*Player{},
 		ActivePlayerIndex: 0,
+		State:             GameStateWaiting,
+		ActionLog:         []LoggedAction{},
+		JoinLog:           []LoggedJoin{},
+		Ends:              []End{},
+	}
+	// the target sits in the middle of the field
+	center := vector2.Vector2{X: float64(marbleGame.Config.Width) / 2, Y: float64(marbleGame.Config.Height) / 2}
+	marbleGame.Config.ScoringZones = []ScoringZone{TargetZone(center)}
+	return marbleGame
+}
+
+// Creates a fresh player with the starting inventory
+func NewPlayer(userToken string) *Player {
+	displayName := userToken
+	if len(displayName) > 4 {
+		displayName = displayName[:4]
+	}
+	return &Player{
+		UserToken:         userToken,
+		DisplayName:       displayName,
+		Score:             0,
+		Hue:               int(rand.Int31n(256)),
+		ShouldSkipMyTurns: false,
+		TurnsTaken:        0,
+		Inventory:         StartingInventory(),
 	}
 }
 
+// The marbles every player starts a Target end with
+func StartingInventory() []MarbleType {
+	return []MarbleType{
+		MarbleTypes[0],
+		MarbleTypes[0],
+		MarbleTypes[1],
+		MarbleTypes[0],
+		MarbleTypes[2],
+		MarbleTypes[1],
+		MarbleTypes[0],
+		MarbleTypes[0],
+		MarbleTypes[2],
+		MarbleTypes[0],
+		MarbleTypes[0],
+	}
+}
+
+// Adds a player to the game and the end of the turn order
+// returns the existing player if they already joined
+func (marbleGame *MarbleGame) AddPlayer(userToken string) (*Player, error) {
+	if player, exists := marbleGame.Players[userToken]; exists {
+		if player.Left {
+			return nil, errors.New("Player left the match")
+		}
+		return player, nil
+	}
+
+	if marbleGame.State == GameStateFinished {
+		return nil, errors.New("Game is over")
+	}
+
+	if len(marbleGame.TurnOrder) >= marbleGame.Config.PlayerLimit {
+		return nil, errors.New("Player limit reached")
+	}
+
+	player := NewPlayer(userToken)
+	player.Id = len(marbleGame.JoinLog)
+	marbleGame.Mode().Setup(marbleGame, player)
+	marbleGame.Players[userToken] = player
+	marbleGame.TurnOrder = append(marbleGame.TurnOrder, player)
+	marbleGame.JoinLog = append(marbleGame.JoinLog, LoggedJoin{
+		UserToken:   userToken,
+		JoinedAfter: len(marbleGame.ActionLog),
+	})
+	// taking a shot back can't take back the seat too
+	marbleGame.history = nil
+
+	return player, nil
+}
+
 // Handles validating a legal game action
 // returns an error if invalid
 // if it's valid it will send a new MarbleGameFrame with the new Marble
 func (marbleGame *MarbleGame) ValidateGameAction(action Action, frame MarbleGameFrame) (MarbleGameFrame, error) {
+	if marbleGame.State == GameStateFinished {
+		return MarbleGameFrame{}, actionError(CodeGameOver, "Game is over")
+	}
+
 	player, exists := marbleGame.Players[action.UserToken]
 	if !exists {
-		return MarbleGameFrame{}, errors.New("Invalid Player")
+		return MarbleGameFrame{}, actionError(CodeInvalidPlayer, "Invalid Player")
 	}
 
 	// check if it's the players turn
-	if marbleGame.TurnOrder[marbleGame.ActivePlayerIndex] != player {
-		return MarbleGameFrame{}, errors.New("Not your turn")
+	if len(marbleGame.TurnOrder) == 0 || marbleGame.TurnOrder[marbleGame.ActivePlayerIndex] != player {
+		return MarbleGameFrame{}, actionError(CodeNotYourTurn, "Not your turn")
 	}
 
 	// check if the player has it in their inventory
@@ -69,9 +183,22 @@ func (marbleGame *MarbleGame) ValidateGameAction(action Action, frame MarbleGame
 		newMarbleType = player.Inventory[action.InventorySlot]
 	} else {
 		if action.InventorySlot == -1 {
-			return MarbleGameFrame{}, errors.New("No Inventory Slot selected")
+			return MarbleGameFrame{}, actionError(CodeNoSlot, "No Inventory Slot selected")
 		}
-		return MarbleGameFrame{}, errors.New("Inventory Slot out of range")
+		return MarbleGameFrame{}, actionError(CodeSlotOutOfRange, "Inventory Slot out of range")
+	}
+
+	// anything else is up to the mode
+	if err := marbleGame.Mode().ValidateAction(marbleGame, action, player); err != nil {
+		if ActionErrorCodeOf(err) == "" {
+			err = actionError(CodeModeRule, err.Error())
+		}
+		return MarbleGameFrame{}, err
+	}
+
+	// check if the ball fits
+	if err := marbleGame.CheckPlacement(player, newMarbleType, action.Pos, frame); err != nil {
+		return MarbleGameFrame{}, err
 	}
 
 	// remove it from inventory
@@ -84,35 +211,22 @@ func (marbleGame *MarbleGame) ValidateGameAction(action Action, frame MarbleGame
 	}
 	player.Inventory = newInventory
 
-	// check if the ball fits
-
-	// check if the velocity is not too large, and clamp if so
-
-	// adjust player's inventory
-
-	// success, add the new ball
-	velClampedInsideGameField := action.Vel.Copy()
-	if velClampedInsideGameField.X < 0 {
-		velClampedInsideGameField.X = 0
-	}
-	if velClampedInsideGameField.X > float64(marbleGame.Config.Width) {
-		velClampedInsideGameField.X = float64(marbleGame.Config.Width)
-	}
-	if velClampedInsideGameField.Y < 0 {
-		velClampedInsideGameField.Y = 0
-	}
-	if velClampedInsideGameField.Y > float64(marbleGame.Config.Height) {
-		velClampedInsideGameField.Y = float64(marbleGame.Config.Height)
-	}
-	vel := action.Pos.Sub(velClampedInsideGameField).MulScalar(-1.0)
+	// success, add the new ball, no faster than its type launches at
+	velClampedInsideGameField := marbleGame.Config.clampInsideArena(action.Vel)
+	vel := action.Pos.Sub(&velClampedInsideGameField).MulScalar(-1.0)
 	velNormal := vel.Normalize()
 	velMagnitude := vel.Magnitude()
-	maxMagnitude := 215.0
-	if velMagnitude > maxMagnitude {
-		vel = velNormal.MulScalar(maxMagnitude)
+	if maxLaunchSpeed := marbleGame.Config.PhysicsOf(newMarbleType).MaxLaunchSpeed; velMagnitude > maxLaunchSpeed {
+		vel = velNormal.MulScalar(maxLaunchSpeed)
+	}
+
+	owner := player
+	if newMarbleType.Neutral {
+		owner = nil
 	}
 
 	newMarble := Marble{
+		Id:             marbleGame.NextMarbleId,
 		Pos:            action.Pos,
 		Vel:            *vel,
 		Rot:            quaternion.Ident, // identity quaternion
@@ -120,8 +234,12 @@ func (marbleGame *MarbleGame) ValidateGameAction(action Action, frame MarbleGame
 		Type:           newMarbleType,
 		Collided:       false,
 		HighlightColor: "",
-		Owner:          player,
+		Owner:          owner,
 	}
+	action.SideSpin, action.TopSpin = clampSpin(action.SideSpin), clampSpin(action.TopSpin)
+	newMarble.addSpin(action)
+	marbleGame.NextMarbleId++
+
 	var newFrame MarbleGameFrame
 	for _, m := range frame.Marbles {
 		newFrame.Marbles = append(newFrame.Marbles, m)
@@ -133,6 +251,7 @@ func (marbleGame *MarbleGame) ValidateGameAction(action Action, frame MarbleGame
 
 func (marbleGame *MarbleGame) GenerateNewGameFrames(action *Action, frame *MarbleGameFrame) []MarbleGameFrame {
 	previousFrame := frame
+	mode := marbleGame.Mode()
 
 	var newGameFrames []MarbleGameFrame
 	newGameFrames = append(newGameFrames, *previousFrame) // cheeky, add the previous frame bcuz
@@ -143,17 +262,8 @@ func (marbleGame *MarbleGame) GenerateNewGameFrames(action *Action, frame *Marbl
 			newFrame.Marbles = append(newFrame.Marbles, m)
 		}
 
-		for i := range newFrame.Marbles {
-			m := &newFrame.Marbles[i]
-			m.Pos = *m.Pos.Add(m.Vel.MulScalar(-0.1))
-			m.Vel = *m.Vel.MulScalar(0.96) // friction
-			if m.Vel.Magnitude() < 1 {
-				m.Vel = vector2.Vector2{X: 0, Y: 0}
-			}
-		}
-
-		newFrame.HandleCollisions(marbleGame)
-		newFrame.HandleScoring(marbleGame)
+		newFrame.Step(marbleGame)
+		mode.ScoreFrame(marbleGame, &newFrame)
 
 		newGameFrames = append(newGameFrames, newFrame)
 		if newFrame.AreMarblesSettled() {
@@ -166,34 +276,7 @@ func (marbleGame *MarbleGame) GenerateNewGameFrames(action *Action, frame *Marbl
 
 	finalFrame.ResetRotations()
 
-	if marbleGame.Config.RemoveMarblesFromOutsideScoringZone {
-		removeMeByIndex := []int{}
-
-		// first pass, mark for removal
-		for i, m := range finalFrame.Marbles {
-			distanceToCenter := m.Pos.Distance(&vector2.Vector2{X: float64(marbleGame.Config.Width) / 2, Y: float64(marbleGame.Config.Height) / 2})
-			if distanceToCenter-m.Type.Radius > marbleGame.Config.ScoringZoneRadius {
-				removeMeByIndex = append(removeMeByIndex, i)
-			}
-		}
-
-		// second pass, remove em
-		safeMarbles := []Marble{}
-		for i, m := range finalFrame.Marbles {
-			toBeRemoved := false
-			for _, j := range removeMeByIndex {
-				if i == j {
-					toBeRemoved = true
-					break
-				}
-			}
-			if !toBeRemoved {
-				safeMarbles = append(safeMarbles, m)
-			}
-		}
-
-		finalFrame.Marbles = safeMarbles
-	}
+	mode.EndTurn(marbleGame, finalFrame)
 
 	finalFrame.ResetCollidedFlags()
 
@@ -214,8 +297,8 @@ func (frame *MarbleGameFrame) ResetRotations() {
 	}
 }
 
-func (frame *MarbleGameFrame) HandleCollisions(marbleGame *MarbleGame) {
-	// handle rotating the marbles
+// Accumulates the display-only rolling rotation of every marble
+func (frame *MarbleGameFrame) RotateMarbles() {
 	for i := range frame.Marbles {
 		marble := &frame.Marbles[i]
 
@@ -236,81 +319,102 @@ func (frame *MarbleGameFrame) HandleCollisions(marbleGame *MarbleGame) {
 		marble.Rot = qFinal
 		// marble.Rot += 0.01
 	}
+}
 
-	// reset Collided flags
-	frame.ResetCollidedFlags()
+// Shoves apart marbles that are already overlapping, and pushes marbles out of obstacles and back inside the walls
+// impacts while moving are caught earlier by the sweep in Step
+func (frame *MarbleGameFrame) HandleCollisions(marbleGame *MarbleGame) {
+	// collisions between marbles, only checking pairs the broadphase says are close
+	for _, pair := range frame.overlapCandidates() {
+		frame.collideIfOverlapping(&marbleGame.Config, pair[0], pair[1])
+	}
 
-	// collisions between marbles
+	// marbles stuck in obstacles
 	for i := range frame.Marbles {
-		marble1 := &frame.Marbles[i]
-		for j := i + 1; j < len(frame.Marbles); j++ {
-			marble2 := &frame.Marbles[j]
-
-			centersDistance := vector2.Distance(&marble1.Pos, &marble2.Pos)
-			minDistance := marble1.Type.Radius + marble2.Type.Radius
-
-			if centersDistance < minDistance {
-				// Mark these as collided
-				marble1.Collided = true
-				marble2.Collided = true
-
-				// Resolve overlap (shove them apart)
-				overlap := minDistance - centersDistance
-				separationDir := marble1.Pos.Sub(&marble2.Pos).Normalize()
-				marble1.Pos = *marble1.Pos.Add(separationDir.MulScalar((overlap / 2) + 1))
-				marble2.Pos = *marble2.Pos.Sub(separationDir.MulScalar((overlap / 2) + 1))
-
-				// Compute new velocities using 2D elastic collision formula
-				m1, m2 := marble1.Type.Mass, marble2.Type.Mass
-				v1, v2 := marble1.Vel, marble2.Vel
-
-				normal := separationDir
-				tangent := vector2.Vector2{X: -normal.Y, Y: normal.X} // Perpendicular vector
-
-				// Decompose velocities into normal and tangential components
-				v1n := normal.Dot(&v1)
-				v1t := tangent.Dot(&v1)
-				v2n := normal.Dot(&v2)
-				v2t := tangent.Dot(&v2)
-
-				// Compute new normal velocities using 1D elastic collision formula
-				v1nFinal := (v1n*(m1-m2) + 2*m2*v2n) / (m1 + m2)
-				v2nFinal := (v2n*(m2-m1) + 2*m1*v1n) / (m1 + m2)
-
-				// Convert back to 2D velocity
-				marble1.Vel = *normal.MulScalar(v1nFinal).Add(tangent.MulScalar(v1t))
-				marble2.Vel = *normal.MulScalar(v2nFinal).Add(tangent.MulScalar(v2t))
-			}
+		for j := range marbleGame.Config.Obstacles {
+			marbleGame.Config.Obstacles[j].pushOut(&frame.Marbles[i], marbleGame.Config.PhysicsOf(frame.Marbles[i].Type).Restitution)
 		}
 	}
 
+	// other arena shapes keep marbles in themselves
+	if !marbleGame.Config.Arena.isRectangle() {
+		for i := range frame.Marbles {
+			marbleGame.Config.keepInsideArena(&frame.Marbles[i])
+		}
+		return
+	}
+
 	// collisions on border walls
 	for i := range frame.Marbles {
 		marble := &frame.Marbles[i]
+		restitution := marbleGame.Config.PhysicsOf(marble.Type).Restitution
 		isInLeftWall := marble.Pos.X-marble.Type.Radius < 0
 		isInRightWall := marble.Pos.X+marble.Type.Radius > float64(marbleGame.Config.Width)
 		isInTopWall := marble.Pos.Y-marble.Type.Radius < 0
 		isInBottomWall := marble.Pos.Y+marble.Type.Radius > float64(marbleGame.Config.Height)
 
+		// push marble out of wall, then reverse momentum if it's still heading in (travel is opposite to Vel)
 		if isInLeftWall {
-			// push marble out of wall, then reverse momentum
 			marble.Pos.X = 0 + marble.Type.Radius
-			marble.Vel.X = -marble.Vel.X
+			if marble.Vel.X > 0 {
+				marble.Vel.X = -marble.Vel.X * restitution
+			}
 		}
 		if isInRightWall {
-			// push marble out of wall, then reverse momentum
 			marble.Pos.X = float64(marbleGame.Config.Width) - marble.Type.Radius
-			marble.Vel.X = -marble.Vel.X
+			if marble.Vel.X < 0 {
+				marble.Vel.X = -marble.Vel.X * restitution
+			}
 		}
 		if isInTopWall {
-			// push marble out of wall, then reverse momentum
 			marble.Pos.Y = 0 + marble.Type.Radius
-			marble.Vel.Y = -marble.Vel.Y
+			if marble.Vel.Y > 0 {
+				marble.Vel.Y = -marble.Vel.Y * restitution
+			}
 		}
 		if isInBottomWall {
-			// push marble out of wall, then reverse momentum
 			marble.Pos.Y = float64(marbleGame.Config.Height) - marble.Type.Radius
-			marble.Vel.Y = -marble.Vel.Y
+			if marble.Vel.Y < 0 {
+				marble.Vel.Y = -marble.Vel.Y * restitution
+			}
+		}
+	}
+}
+
+// The narrowphase: shoves marbles i and j apart and bounces them if they overlap
+// an anchored marble stays put and the other takes the whole shove
+func (frame *MarbleGameFrame) collideIfOverlapping(config *MarbleGameConfig, i, j int) {
+	if !frame.collides(i, j) {
+		return
+	}
+	marble1, marble2 := &frame.Marbles[i], &frame.Marbles[j]
+	centersDistance := vector2.Distance(&marble1.Pos, &marble2.Pos)
+	minDistance := marble1.Type.Radius + marble2.Type.Radius
+
+	if centersDistance < minDistance-contactEpsilon {
+		// Mark these as collided
+		marble1.Collided = true
+		marble2.Collided = true
+
+		// Resolve overlap (shove them apart)
+		overlap := minDistance - centersDistance
+		shove1, shove2 := (overlap/2)+1, (overlap/2)+1
+		switch fixed1, fixed2 := frame.immovable(i), frame.immovable(j); {
+		case fixed1 && fixed2:
+			shove1, shove2 = 0, 0
+		case fixed1:
+			shove1, shove2 = 0, overlap+2
+		case fixed2:
+			shove1, shove2 = overlap+2, 0
+		}
+		separationDir := marble1.Pos.Sub(&marble2.Pos).Normalize()
+		marble1.Pos = *marble1.Pos.Add(separationDir.MulScalar(shove1))
+		marble2.Pos = *marble2.Pos.Sub(separationDir.MulScalar(shove2))
+
+		// only bounce them if they're still heading into each other (travel is opposite to Vel)
+		relativeVel := marble1.Vel.Sub(&marble2.Vel)
+		if relativeVel.Dot(separationDir) > 0 {
+			frame.bounce(config, i, j, separationDir)
 		}
 	}
 }
@@ -338,43 +442,28 @@ func CalculateRotationQuaternion(vx, vy, radius float64) quaternion.T {
 	return q
 }
 
+// Target scoring, marbles score more the closer they get to the middle of a scoring zone and the most on its bullseye
 func (frame *MarbleGameFrame) HandleScoring(marbleGame *MarbleGame) {
 	// reset scoring to 0
 	for _, v := range marbleGame.Players {
 		v.Score = 0
 	}
 
-	// 1st pass: base scoring
 	for i := range frame.Marbles {
 		marble1 := &frame.Marbles[i]
-		distanceToCenter := marble1.Pos.Distance(&vector2.Vector2{X: 300, Y: 240})
-
-		score := 0
-		scoringZoneRadius := marbleGame.Config.ScoringZoneRadius
-		scoringZoneMaxScore := marbleGame.Config.ScoringZoneMaxScore
-		scoringZoneMinScore := marbleGame.Config.ScoringZoneMinScore
-		bullseyeZoneRadius := marbleGame.Config.BullseyeZoneRadius
-		bullseyeZoneScore := marbleGame.Config.BullseyeZoneScore
-
-		isInScoringZone := distanceToCenter <= scoringZoneRadius+marble1.Type.Radius
-		isInBullseyeZone := distanceToCenter <= bullseyeZoneRadius+marble1.Type.Radius
-
-		if isInScoringZone {
-			if isInBullseyeZone {
-				score = bullseyeZoneScore
-				marble1.HighlightColor = "#ffffffff"
-			} else {
-				distanceToBullseyeZone := distanceToCenter - marble1.Type.Radius - bullseyeZoneRadius
-				distanceFromBullseyeToScoringZone := scoringZoneRadius - bullseyeZoneRadius
-				percentage := distanceToBullseyeZone / distanceFromBullseyeToScoringZone
-				score = scoringZoneMinScore + int((1-percentage)*float64(scoringZoneMaxScore-scoringZoneMinScore+1))
-				marble1.HighlightColor = "#ffffff80"
-			}
-		} else {
+		score, bullseye := marbleGame.Config.ScoreAt(marble1.Pos, marble1.Type.Radius)
+		switch {
+		case bullseye:
+			marble1.HighlightColor = "#ffffffff"
+		case marbleGame.Config.zoneAt(marble1.Pos, marble1.Type.Radius) != nil:
+			marble1.HighlightColor = "#ffffff80"
+		default:
 			marble1.HighlightColor = "#12121200"
 		}
 		marble1.Score = score
-		marble1.Owner.Score += score
+		if marble1.Owner != nil {
+			marble1.Owner.Score += score
+		}
 	}
 }
 
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+)
+
+// The rules of a match, chosen by name with MarbleGameConfig.Mode
+// hooks are called on the game's own goroutine, in this order over a match:
+//
+//	Setup          as each player takes their seat
+//	ValidateAction once the action is known to be the active player's, before their marble is taken
+//	ScoreFrame     on every simulated frame
+//	EndTurn        on the final frame, once every marble has settled
+//	IsGameOver     after the action is logged
+//	NextPlayer     if the game isn't over
+type GameMode interface {
+	Name() string
+	Description() string
+	// Readies a player as they're seated, e.g. their inventory
+	Setup(marbleGame *MarbleGame, player *Player)
+	// Rejects actions the mode doesn't allow, the basic checks in ValidateGameAction have already passed
+	ValidateAction(marbleGame *MarbleGame, action Action, player *Player) error
+	// Sets every marble's Score and every player's Score for the frame
+	ScoreFrame(marbleGame *MarbleGame, frame *MarbleGameFrame)
+	// Tidies up the settled frame at the end of a shot, e.g. taking marbles off the field
+	EndTurn(marbleGame *MarbleGame, frame *MarbleGameFrame)
+	// Returns the index into TurnOrder of who throws next
+	NextPlayer(marbleGame *MarbleGame) int
+	IsGameOver(marbleGame *MarbleGame) bool
+}
+
+var GameModes = []GameMode{
+	TargetMode{},
+	BocceMode{},
+}
+
+// Finds a GameMode by its name, ignoring case
+func GameModeByName(name string) (GameMode, error) {
+	for _, mode := range GameModes {
+		if strings.EqualFold(mode.Name(), name) {
+			return mode, nil
+		}
+	}
+	return nil, errors.New("Unknown game mode")
+}
+
+// The GameMode the config asks for, Target if it's missing or unknown
+func (marbleGame *MarbleGame) Mode() GameMode {
+	mode, err := GameModeByName(marbleGame.Config.Mode)
+	if err != nil {
+		return TargetMode{}
+	}
+	return mode
+}
+
+// The original rules: marbles score by how close they land to the center of the field,
+// and everyone throws in turn until the marbles run out or someone reaches the TargetScore
+// over more than one end, the hammer goes to whoever took the fewest points in the last
+type TargetMode struct{}
+
+func (TargetMode) Name() string { return "Target" }
+
+func (TargetMode) Description() string {
+	return "Score by landing marbles near the bullseye."
+}
+
+func (TargetMode) Setup(marbleGame *MarbleGame, player *Player) {}
+
+func (TargetMode) ValidateAction(marbleGame *MarbleGame, action Action, player *Player) error {
+	return nil
+}
+
+func (TargetMode) ScoreFrame(marbleGame *MarbleGame, frame *MarbleGameFrame) {
+	frame.HandleScoring(marbleGame)
+	for userToken, total := range marbleGame.EndTotals() {
+		marbleGame.Players[userToken].Score += total
+	}
+}
+
+func (mode TargetMode) EndTurn(marbleGame *MarbleGame, frame *MarbleGameFrame) {
+	if marbleGame.Config.RemoveMarblesFromOutsideScoringZone {
+		frame.RemoveMarblesOutsideScoringZone(marbleGame)
+	}
+
+	if !marbleGame.isEndOver() {
+		return
+	}
+
+	end := marbleGame.finishEnd(frame)
+	if mode.IsGameOver(marbleGame) {
+		return
+	}
+	marbleGame.passHammer(end)
+	marbleGame.startNextEnd(frame, StartingInventory)
+}
+
+func (TargetMode) NextPlayer(marbleGame *MarbleGame) int {
+	if marbleGame.isNewEnd() {
+		return marbleGame.firstThrower()
+	}
+	return marbleGame.nextPlayerWithMarbles()
+}
+
+// Scores on the field count towards the TargetScore straight away
+func (TargetMode) IsGameOver(marbleGame *MarbleGame) bool {
+	scores := make(map[string]int)
+	for userToken, player := range marbleGame.Players {
+		scores[userToken] = player.Score
+	}
+	return marbleGame.areEndsOver(scores)
+}
+
+// Takes marbles that ended up outside every scoring zone off the field
+func (frame *MarbleGameFrame) RemoveMarblesOutsideScoringZone(marbleGame *MarbleGame) {
+	safeMarbles := []Marble{}
+	for _, m := range frame.Marbles {
+		if marbleGame.Config.zoneAt(m.Pos, m.Type.Radius) != nil {
+			safeMarbles = append(safeMarbles, m)
+		}
+	}
+
+	frame.Marbles = safeMarbles
+}
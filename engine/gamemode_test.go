@@ -0,0 +1,128 @@
+package engine_test
+
+import (
+	"errors"
+	"marblegame/engine"
+	"reflect"
+	"testing"
+)
+
+// Every marble scores 1, only the first slot can be thrown, player 1 always throws and it's over after 3 shots
+type oneSlotMode struct {
+	engine.TargetMode
+}
+
+func (oneSlotMode) Name() string { return "One Slot" }
+
+func (oneSlotMode) Setup(marbleGame *engine.MarbleGame, player *engine.Player) {
+	player.Inventory = player.Inventory[:5]
+}
+
+func (oneSlotMode) ValidateAction(marbleGame *engine.MarbleGame, action engine.Action, player *engine.Player) error {
+	if action.InventorySlot != 0 {
+		return errors.New("Only the first slot")
+	}
+	return nil
+}
+
+func (oneSlotMode) ScoreFrame(marbleGame *engine.MarbleGame, frame *engine.MarbleGameFrame) {
+	for _, player := range marbleGame.Players {
+		player.Score = 0
+	}
+	for i := range frame.Marbles {
+		frame.Marbles[i].Score = 1
+		frame.Marbles[i].Owner.Score++
+	}
+}
+
+func (oneSlotMode) EndTurn(marbleGame *engine.MarbleGame, frame *engine.MarbleGameFrame) {}
+
+func (oneSlotMode) NextPlayer(marbleGame *engine.MarbleGame) int { return 0 }
+
+func (oneSlotMode) IsGameOver(marbleGame *engine.MarbleGame) bool {
+	return len(marbleGame.ActionLog) >= 3
+}
+
+func TestGameModeByName(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		name    string
+		want    engine.GameMode
+		wantErr bool
+	}{
+		{desc: "Target", name: "Target", want: engine.TargetMode{}},
+		{desc: "Any case", name: "target", want: engine.TargetMode{}},
+		{desc: "Unknown", name: "golf", wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			mode, err := engine.GameModeByName(tC.name)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if mode != tC.want {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, mode, tC.want)
+			}
+		})
+	}
+}
+
+func TestModeDefaultsToTarget(t *testing.T) {
+	for _, name := range []string{"", "golf"} {
+		g := engine.NewMarbleGame()
+		g.Config.Mode = name
+		if g.Mode() != (engine.TargetMode{}) {
+			t.Errorf("FAIL mode %q: got %v, want %v", name, g.Mode(), engine.TargetMode{})
+		}
+	}
+}
+
+func TestGameModeHooks(t *testing.T) {
+	engine.GameModes = append(engine.GameModes, oneSlotMode{})
+	t.Cleanup(func() { engine.GameModes = engine.GameModes[:len(engine.GameModes)-1] })
+
+	g := engine.NewMarbleGame()
+	g.Config.Mode = "one slot"
+	g.AddPlayer("player 1")
+	g.AddPlayer("player 2")
+
+	if got := len(g.Players["player 2"].Inventory); got != 5 {
+		t.Errorf("FAIL Setup inventory: got %d, want %d", got, 5)
+	}
+
+	badSlot := shoot("player 1", 300, 240)
+	badSlot.InventorySlot = 1
+	if err := g.PlayAction(badSlot); err == nil {
+		t.Errorf("FAIL ValidateAction should reject slot 1")
+	}
+	if got := len(g.Players["player 1"].Inventory); got != 5 {
+		t.Errorf("FAIL a rejected action took a marble: got %d, want %d", got, 5)
+	}
+
+	// marbles out on the edge would be taken off the field in Target
+	for _, x := range []float64{40, 560, 40} {
+		if err := g.PlayAction(shootNear(t, g, x, 40)); err != nil {
+			t.Fatalf("FAIL shot at %v: %v", x, err)
+		}
+	}
+
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL IsGameOver: got %s, want %s", g.State, engine.GameStateFinished)
+	}
+	if got := len(g.Frames[len(g.Frames)-1].Marbles); got != 3 {
+		t.Errorf("FAIL EndTurn kept marbles: got %d, want %d", got, 3)
+	}
+	scores := map[string]int{"player 1": g.Players["player 1"].Score, "player 2": g.Players["player 2"].Score}
+	if want := map[string]int{"player 1": 3, "player 2": 0}; !reflect.DeepEqual(scores, want) {
+		t.Errorf("FAIL ScoreFrame: got %v, want %v", scores, want)
+	}
+
+	// the mode is in the config, so replays play by it too
+	rebuilt, err := g.Replay().Rebuild()
+	if err != nil {
+		t.Fatalf("FAIL rebuilding: %v", err)
+	}
+	if rebuilt.Mode() != (oneSlotMode{}) {
+		t.Errorf("FAIL rebuilt mode: got %v, want %v", rebuilt.Mode(), oneSlotMode{})
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// A player who leaves mid-match gives up their seat for good: they're taken out of TurnOrder and forfeit the
+// marbles they hadn't thrown. They stay in Players, so their points and the ends they played still add up.
+// Whoever runs the game decides when someone has left, e.g. once they've been disconnected for Config.LeaveGrace.
+
+// What happens to a leaver's marbles on the field, see Config.LeaverMarbles
+const (
+	LeaverMarblesKeep    = "keep"    // they stay put and keep scoring for the leaver
+	LeaverMarblesNeutral = "neutral" // they stay put, but score for nobody
+	LeaverMarblesRemove  = "remove"  // they're taken off the field
+)
+
+var LeaverMarbleRules = []string{LeaverMarblesKeep, LeaverMarblesNeutral, LeaverMarblesRemove}
+
+// Takes the player out of the match, fixing up the turn order around their seat
+// it's logged so a Replay takes them out at the same point
+func (marbleGame *MarbleGame) RemovePlayer(userToken string) error {
+	if marbleGame.State == GameStateFinished {
+		return errors.New("Game is over")
+	}
+	player, exists := marbleGame.Players[userToken]
+	if !exists {
+		return errors.New("Player isn't in the match")
+	}
+	seat := slices.Index(marbleGame.TurnOrder, player)
+	if seat == -1 {
+		return errors.New("Player already left")
+	}
+
+	wasTheirTurn := seat == marbleGame.ActivePlayerIndex
+	marbleGame.history = nil
+	heldJack := holdsJack(player)
+	player.Left = true
+	player.ShouldSkipMyTurns = false
+	player.Inventory = []MarbleType{}
+	marbleGame.TurnOrder = slices.Delete(marbleGame.TurnOrder, seat, seat+1)
+	if marbleGame.Hammer == userToken {
+		marbleGame.Hammer = ""
+	}
+
+	switch {
+	case len(marbleGame.TurnOrder) == 0:
+		marbleGame.ActivePlayerIndex = 0
+	case seat < marbleGame.ActivePlayerIndex:
+		marbleGame.ActivePlayerIndex--
+	case wasTheirTurn:
+		// back one seat, so the turn passes to whoever sat after them
+		marbleGame.ActivePlayerIndex = (seat - 1 + len(marbleGame.TurnOrder)) % len(marbleGame.TurnOrder)
+	}
+	// the jack can't leave with them, it goes to whoever sat after them
+	if heldJack && len(marbleGame.TurnOrder) > 0 {
+		next := marbleGame.TurnOrder[seat%len(marbleGame.TurnOrder)]
+		next.Inventory = append([]MarbleType{Jack}, next.Inventory...)
+	}
+
+	frame := marbleGame.adoptFrame(marbleGame.Frames[len(marbleGame.Frames)-1])
+	switch marbleGame.Config.LeaverMarbles {
+	case LeaverMarblesNeutral:
+		for i := range frame.Marbles {
+			if frame.Marbles[i].Owner == player {
+				frame.Marbles[i].Owner = nil
+			}
+		}
+	case LeaverMarblesRemove:
+		frame.Marbles = slices.DeleteFunc(frame.Marbles, func(m Marble) bool { return m.Owner == player })
+	}
+	marbleGame.Mode().ScoreFrame(marbleGame, &frame)
+
+	// they might have been the last with marbles to throw this end
+	endsBefore := len(marbleGame.Ends)
+	if len(marbleGame.TurnOrder) > 0 {
+		marbleGame.Mode().EndTurn(marbleGame, &frame)
+	}
+	marbleGame.Frames = []MarbleGameFrame{frame}
+
+	marbleGame.ActionLog = append(marbleGame.ActionLog, LoggedAction{
+		Action: Action{UserToken: userToken},
+		Scores: marbleGame.scores(),
+		Left:   true,
+	})
+
+	if len(marbleGame.TurnOrder) == 0 || marbleGame.IsGameOver() {
+		marbleGame.State = GameStateFinished
+		marbleGame.TurnDeadline = time.Time{}
+		return nil
+	}
+
+	if wasTheirTurn || len(marbleGame.Ends) != endsBefore {
+		marbleGame.AdvanceTurn()
+	}
+
+	return nil
+}
+
+// Whether the rule is one of LeaverMarbleRules
+func ValidLeaverMarbles(rule string) bool {
+	return slices.Contains(LeaverMarbleRules, rule)
+}
@@ -0,0 +1,216 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"reflect"
+	"testing"
+)
+
+func newThreePlayerGame(t *testing.T) *engine.MarbleGame {
+	t.Helper()
+	g := engine.NewMarbleGame()
+	g.Config.PlayerLimit = 3
+	for _, userToken := range []string{"player 1", "player 2", "player 3"} {
+		if _, err := g.AddPlayer(userToken); err != nil {
+			t.Fatalf("FAIL adding %s: %v", userToken, err)
+		}
+	}
+	return g
+}
+
+func TestRemovePlayerFixesTurnOrder(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		active     int
+		leaver     string
+		wantOrder  []string
+		wantActive string
+	}{
+		{desc: "Before the active player", active: 1, leaver: "player 1", wantOrder: []string{"player 2", "player 3"}, wantActive: "player 2"},
+		{desc: "The active player", active: 1, leaver: "player 2", wantOrder: []string{"player 1", "player 3"}, wantActive: "player 3"},
+		{desc: "The active player at the end", active: 2, leaver: "player 3", wantOrder: []string{"player 1", "player 2"}, wantActive: "player 1"},
+		{desc: "After the active player", active: 0, leaver: "player 3", wantOrder: []string{"player 1", "player 2"}, wantActive: "player 1"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newThreePlayerGame(t)
+			for i := range tC.active {
+				if err := g.PlayAction(shoot(g.TurnOrder[i].UserToken, 100, 100+float64(i)*80)); err != nil {
+					t.Fatalf("FAIL playing: %v", err)
+				}
+			}
+
+			if err := g.RemovePlayer(tC.leaver); err != nil {
+				t.Fatalf("FAIL removing %s: %v", tC.leaver, err)
+			}
+
+			got := []string{}
+			for _, player := range g.TurnOrder {
+				got = append(got, player.UserToken)
+			}
+			if len(got) != len(tC.wantOrder) || got[0] != tC.wantOrder[0] || got[1] != tC.wantOrder[1] {
+				t.Errorf("FAIL %s turn order: got %v, want %v", tC.desc, got, tC.wantOrder)
+			}
+			if active := g.TurnOrder[g.ActivePlayerIndex].UserToken; active != tC.wantActive {
+				t.Errorf("FAIL %s active player: got %s, want %s", tC.desc, active, tC.wantActive)
+			}
+			leaver := g.Players[tC.leaver]
+			if !leaver.Left || len(leaver.Inventory) != 0 {
+				t.Errorf("FAIL %s: leaver should have left with no marbles, got left %v with %d", tC.desc, leaver.Left, len(leaver.Inventory))
+			}
+			if last := g.ActionLog[len(g.ActionLog)-1]; !last.Left || last.Action.UserToken != tC.leaver {
+				t.Errorf("FAIL %s logged leave: got %+v", tC.desc, last)
+			}
+		})
+	}
+}
+
+func TestLeaverMarbles(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		rule        string
+		wantMarbles int
+		wantOwned   bool
+		wantScore   bool
+	}{
+		{desc: "Keep", rule: engine.LeaverMarblesKeep, wantMarbles: 2, wantOwned: true, wantScore: true},
+		{desc: "Neutral", rule: engine.LeaverMarblesNeutral, wantMarbles: 2, wantOwned: false, wantScore: false},
+		{desc: "Remove", rule: engine.LeaverMarblesRemove, wantMarbles: 1, wantOwned: false, wantScore: false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 2)
+			g.Config.LeaverMarbles = tC.rule
+			// both on the target
+			for _, action := range []engine.Action{shoot("player 1", 300, 240), shoot("player 2", 300, 180)} {
+				if err := g.PlayAction(action); err != nil {
+					t.Fatalf("FAIL playing: %v", err)
+				}
+			}
+			leaver := g.Players["player 1"]
+			if leaver.Score == 0 {
+				t.Fatalf("FAIL %s: player 1 should be scoring before they leave", tC.desc)
+			}
+
+			if err := g.RemovePlayer("player 1"); err != nil {
+				t.Fatalf("FAIL removing: %v", err)
+			}
+
+			marbles := g.Frames[len(g.Frames)-1].Marbles
+			if len(marbles) != tC.wantMarbles {
+				t.Errorf("FAIL %s marbles on the field: got %d, want %d", tC.desc, len(marbles), tC.wantMarbles)
+			}
+			owned := false
+			for _, m := range marbles {
+				owned = owned || m.Owner == leaver
+			}
+			if owned != tC.wantOwned {
+				t.Errorf("FAIL %s leaver still owns marbles: got %v, want %v", tC.desc, owned, tC.wantOwned)
+			}
+			if scoring := leaver.Score > 0; scoring != tC.wantScore {
+				t.Errorf("FAIL %s leaver scoring: got %d points, want scoring %v", tC.desc, leaver.Score, tC.wantScore)
+			}
+			if g.Players["player 2"].Score == 0 {
+				t.Errorf("FAIL %s: player 2 should still be scoring", tC.desc)
+			}
+		})
+	}
+}
+
+func TestRemovePlayer(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	if err := g.RemovePlayer("player 3"); err == nil {
+		t.Errorf("FAIL removing someone who never joined should error")
+	}
+	if err := g.PlayAction(shoot("player 1", 100, 100)); err != nil {
+		t.Fatalf("FAIL playing: %v", err)
+	}
+	if err := g.RemovePlayer("player 2"); err != nil {
+		t.Fatalf("FAIL removing: %v", err)
+	}
+	if err := g.RemovePlayer("player 2"); err == nil {
+		t.Errorf("FAIL removing twice should error")
+	}
+	if _, err := g.AddPlayer("player 2"); err == nil {
+		t.Errorf("FAIL a leaver shouldn't get their seat back")
+	}
+	if g.State == engine.GameStateFinished {
+		t.Fatalf("FAIL the last player left should get to finish their marbles")
+	}
+
+	// player 1 plays out the match alone, then a Replay takes player 2 out at the same point
+	if err := g.PlayAction(shoot("player 1", 100, 400)); err != nil {
+		t.Fatalf("FAIL playing on alone: %v", err)
+	}
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL state: got %s, want %s", g.State, engine.GameStateFinished)
+	}
+	rebuilt, err := g.Replay().Rebuild()
+	if err != nil {
+		t.Fatalf("FAIL rebuilding: %v", err)
+	}
+	if !rebuilt.Players["player 2"].Left || len(rebuilt.TurnOrder) != 1 {
+		t.Errorf("FAIL rebuilt leaver: got left %v with %d seated", rebuilt.Players["player 2"].Left, len(rebuilt.TurnOrder))
+	}
+
+	t.Run("Everyone leaving finishes the match", func(t *testing.T) {
+		g := newTwoPlayerGame(t, 2)
+		for _, userToken := range []string{"player 1", "player 2"} {
+			if err := g.RemovePlayer(userToken); err != nil {
+				t.Fatalf("FAIL removing %s: %v", userToken, err)
+			}
+		}
+		if g.State != engine.GameStateFinished {
+			t.Errorf("FAIL state: got %s, want %s", g.State, engine.GameStateFinished)
+		}
+	})
+}
+
+func TestLeaverHandsOnTheJack(t *testing.T) {
+	g := newBocceGame(t)
+	if g.Players["player 1"].Inventory[0].Name != engine.Jack.Name {
+		t.Fatalf("FAIL player 1 should open with the jack")
+	}
+
+	if err := g.RemovePlayer("player 1"); err != nil {
+		t.Fatalf("FAIL removing: %v", err)
+	}
+
+	player2 := g.Players["player 2"]
+	if player2.Inventory[0].Name != engine.Jack.Name {
+		t.Errorf("FAIL player 2 should get the jack, got %s first", player2.Inventory[0].Name)
+	}
+	if active := g.TurnOrder[g.ActivePlayerIndex]; active != player2 {
+		t.Errorf("FAIL active player: got %s, want %s", active.UserToken, player2.UserToken)
+	}
+}
+
+func TestLeaversStayInTheStandings(t *testing.T) {
+	g := newThreePlayerGame(t)
+	if err := g.RemovePlayer("player 2"); err != nil {
+		t.Fatalf("FAIL removing player 2: %v", err)
+	}
+	// leaving rescores the field, so the scores go in afterwards
+	for userToken, score := range map[string]int{"player 1": 10, "player 2": 40, "player 3": 20} {
+		g.Players[userToken].Score = score
+	}
+
+	summary := g.Summary()
+	got := []string{}
+	for _, standing := range summary.Standings {
+		got = append(got, standing.UserToken)
+		if standing.Left != (standing.UserToken == "player 2") {
+			t.Errorf("FAIL %s left: got %v", standing.UserToken, standing.Left)
+		}
+	}
+	// the leaver keeps their score but ranks last
+	if want := []string{"player 3", "player 1", "player 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FAIL standings: got %v, want %v", got, want)
+	}
+	if leaver := summary.Standings[2]; leaver.Score != 40 || leaver.Rank != 3 {
+		t.Errorf("FAIL leaver: got score %d rank %d, want score 40 rank 3", leaver.Score, leaver.Rank)
+	}
+	if !reflect.DeepEqual(summary.Winners, []string{"player 3"}) {
+		t.Errorf("FAIL winners: got %v, want [player 3]", summary.Winners)
+	}
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// A layout of obstacles and the arena around them, read from a JSON level file:
+//
+//	{
+//	  "name": "Bumpers",
+//	  "description": "...",
+//	  "obstacles": [
+//	    {"kind": "bumper", "pos": {"X": 130, "Y": 90}, "radius": 20, "restitution": 0.9},
+//	    {"kind": "wall", "points": [{"X": 100, "Y": 140}, {"X": 100, "Y": 340}]},
+//	    {"kind": "polygon", "points": [{"X": 60, "Y": 205}, {"X": 95, "Y": 240}, {"X": 60, "Y": 275}]}
+//	  ],
+//	  "arena": {"shape": "circle"},
+//	  "scoringZones": [
+//	    {"shape": "ring", "center": {"X": 300, "Y": 240}, "radius": 150, "curve": "stepped", "steps": 4, "maxScore": 20, "minScore": 5}
+//	  ]
+//	}
+//
+// restitution can be left out for a perfect bounce, 0 stops marbles dead,
+// the arena can be left out for the plain rectangle and the scoring zones for the usual target in the middle
+type Level struct {
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	Obstacles    []Obstacle    `json:"obstacles"`
+	Arena        Arena         `json:"arena"`
+	ScoringZones []ScoringZone `json:"scoringZones"` // empty keeps the config's
+	LaunchZones  []LaunchZone  `json:"launchZones"`  // empty to place anywhere
+}
+
+// The field with nothing on it, what every match used before levels
+var OpenField = Level{
+	Name:         "Open",
+	Description:  "Nothing in the way.",
+	Obstacles:    []Obstacle{},
+	Arena:        RectangleArena,
+	ScoringZones: []ScoringZone{},
+	LaunchZones:  []LaunchZone{},
+}
+
+//go:embed levels/*.json
+var levelFiles embed.FS
+
+// The levels rooms can pick, the open field and then every file in levels/
+var Levels = append([]Level{OpenField}, loadLevels()...)
+
+func loadLevels() []Level {
+	entries, err := levelFiles.ReadDir("levels")
+	if err != nil {
+		panic(err)
+	}
+	levels := []Level{}
+	for _, entry := range entries {
+		data, err := levelFiles.ReadFile(path.Join("levels", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		level, err := ParseLevel(data)
+		if err != nil {
+			panic(entry.Name() + ": " + err.Error())
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// Finds a Level by its name, ignoring case
+func LevelByName(name string) (Level, error) {
+	for _, level := range Levels {
+		if strings.EqualFold(level.Name, name) {
+			return level, nil
+		}
+	}
+	return Level{}, errors.New("Unknown level")
+}
+
+// Reads a level file, checking every obstacle can be played on
+func ParseLevel(data []byte) (Level, error) {
+	level := Level{Obstacles: []Obstacle{}, Arena: RectangleArena, ScoringZones: []ScoringZone{}, LaunchZones: []LaunchZone{}}
+	if err := json.Unmarshal(data, &level); err != nil {
+		return Level{}, err
+	}
+	if level.Name == "" {
+		return Level{}, errors.New("A level needs a name")
+	}
+	for _, obstacle := range level.Obstacles {
+		if err := obstacle.validate(); err != nil {
+			return Level{}, err
+		}
+	}
+	if err := level.Arena.validate(); err != nil {
+		return Level{}, err
+	}
+	for _, zone := range level.ScoringZones {
+		if err := zone.validate(); err != nil {
+			return Level{}, err
+		}
+	}
+	for _, zone := range level.LaunchZones {
+		if err := zone.validate(); err != nil {
+			return Level{}, err
+		}
+	}
+	return level, nil
+}
+
+// Puts the level's arena, obstacles, scoring and launch zones on the field
+func (config *MarbleGameConfig) UseLevel(level Level) {
+	config.Level = level.Name
+	config.Obstacles = level.Obstacles
+	config.Arena = level.Arena
+	config.LaunchZones = level.LaunchZones
+	if len(level.ScoringZones) > 0 {
+		config.ScoringZones = level.ScoringZones
+	}
+}
+
+func (obstacle *Obstacle) validate() error {
+	if obstacle.Restitution < 0 || obstacle.Restitution > 1 {
+		return errors.New("Restitution must be between 0 and 1")
+	}
+
+	switch obstacle.Kind {
+	case ObstacleBumper:
+		if obstacle.Radius <= 0 {
+			return errors.New("Bumpers need a radius")
+		}
+	case ObstacleWall:
+		if len(obstacle.Points) != 2 || obstacle.Points[0] == obstacle.Points[1] {
+			return errors.New("Walls need two different ends")
+		}
+	case ObstaclePolygon:
+		if len(obstacle.Points) < 3 {
+			return errors.New("Polygons need at least three corners")
+		}
+		if !isConvex(obstacle.Points) {
+			return errors.New("Polygons must be convex")
+		}
+	default:
+		return errors.New("Unknown obstacle kind")
+	}
+	return nil
+}
+
+// Every corner turns the same way, and all the turns add up to once around
+func isConvex(points []vector2.Vector2) bool {
+	sign := 0.0
+	turned := 0.0
+	for i := range points {
+		a, b, c := points[i], points[(i+1)%len(points)], points[(i+2)%len(points)]
+		edge1, edge2 := b.Sub(&a), c.Sub(&b)
+		turn := cross(edge1, edge2)
+		if turn == 0 || turn*sign < 0 {
+			return false
+		}
+		sign = turn
+		turned += math.Atan2(turn, edge1.Dot(edge2))
+	}
+	return math.Abs(math.Abs(turned)-2*math.Pi) < 1e-6
+}
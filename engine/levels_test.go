@@ -0,0 +1,151 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"marblegame/engine"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		json    string
+		wantErr bool
+	}{
+		{desc: "Empty level", json: `{"name": "Empty", "obstacles": []}`},
+		{desc: "Every kind", json: `{"name": "All", "obstacles": [
+			{"kind": "bumper", "pos": {"X": 100, "Y": 100}, "radius": 20, "restitution": 1},
+			{"kind": "wall", "points": [{"X": 0, "Y": 0}, {"X": 50, "Y": 0}], "restitution": 0},
+			{"kind": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 50, "Y": 0}, {"X": 25, "Y": 40}]}
+		]}`},
+		{desc: "No name", json: `{"obstacles": []}`, wantErr: true},
+		{desc: "Not JSON", json: `{"name": `, wantErr: true},
+		{desc: "Unknown kind", json: `{"name": "x", "obstacles": [{"kind": "hole"}]}`, wantErr: true},
+		{desc: "Bumper without a radius", json: `{"name": "x", "obstacles": [{"kind": "bumper", "pos": {"X": 1, "Y": 1}}]}`, wantErr: true},
+		{desc: "Wall with one end", json: `{"name": "x", "obstacles": [{"kind": "wall", "points": [{"X": 1, "Y": 1}]}]}`, wantErr: true},
+		{desc: "Wall with no length", json: `{"name": "x", "obstacles": [{"kind": "wall", "points": [{"X": 1, "Y": 1}, {"X": 1, "Y": 1}]}]}`, wantErr: true},
+		{desc: "Polygon with two corners", json: `{"name": "x", "obstacles": [{"kind": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 1, "Y": 1}]}]}`, wantErr: true},
+		{desc: "Concave polygon", json: `{"name": "x", "obstacles": [{"kind": "polygon", "points": [
+			{"X": 0, "Y": 0}, {"X": 40, "Y": 0}, {"X": 20, "Y": 10}, {"X": 40, "Y": 40}, {"X": 0, "Y": 40}
+		]}]}`, wantErr: true},
+		{desc: "Star polygon", json: `{"name": "x", "obstacles": [{"kind": "polygon", "points": [
+			{"X": 0, "Y": -10}, {"X": 6, "Y": 8}, {"X": -9, "Y": -3}, {"X": 9, "Y": -3}, {"X": -6, "Y": 8}
+		]}]}`, wantErr: true},
+		{desc: "Negative restitution", json: `{"name": "x", "obstacles": [{"kind": "bumper", "radius": 5, "restitution": -1}]}`, wantErr: true},
+		{desc: "Too much restitution", json: `{"name": "x", "obstacles": [{"kind": "bumper", "radius": 5, "restitution": 1.2}]}`, wantErr: true},
+		{desc: "Circle arena", json: `{"name": "x", "obstacles": [], "arena": {"shape": "circle"}}`},
+		{desc: "Concave arena", json: `{"name": "x", "obstacles": [], "arena": {"shape": "polygon", "points": [
+			{"X": 0, "Y": 0}, {"X": 600, "Y": 0}, {"X": 600, "Y": 240}, {"X": 300, "Y": 240}, {"X": 300, "Y": 480}, {"X": 0, "Y": 480}
+		]}}`},
+		{desc: "Unknown arena", json: `{"name": "x", "obstacles": [], "arena": {"shape": "triangle"}}`, wantErr: true},
+		{desc: "Arena with two corners", json: `{"name": "x", "obstacles": [], "arena": {"shape": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 9, "Y": 9}]}}`, wantErr: true},
+		{desc: "Flat arena", json: `{"name": "x", "obstacles": [], "arena": {"shape": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 5, "Y": 5}, {"X": 9, "Y": 9}]}}`, wantErr: true},
+		{desc: "Arena crossing itself", json: `{"name": "x", "obstacles": [], "arena": {"shape": "polygon", "points": [
+			{"X": 0, "Y": 0}, {"X": 600, "Y": 480}, {"X": 600, "Y": 0}, {"X": 0, "Y": 480}
+		]}}`, wantErr: true},
+		{desc: "Every zone shape", json: `{"name": "x", "obstacles": [], "scoringZones": [
+			{"shape": "ring", "center": {"X": 100, "Y": 100}, "radius": 50, "bullseyeRadius": 10, "bullseyeScore": 40, "maxScore": 20, "minScore": 5},
+			{"shape": "rectangle", "center": {"X": 300, "Y": 240}, "size": {"X": 100, "Y": 60}, "curve": "stepped", "steps": 3, "maxScore": 9, "minScore": 3},
+			{"shape": "polygon", "center": {"X": 500, "Y": 100}, "points": [{"X": 450, "Y": 150}, {"X": 500, "Y": 50}, {"X": 550, "Y": 150}], "curve": "table", "table": [5, 1]}
+		]}`},
+		{desc: "Unknown zone shape", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "star", "radius": 5}]}`, wantErr: true},
+		{desc: "Ring without a radius", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "ring"}]}`, wantErr: true},
+		{desc: "Flat rectangle zone", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "rectangle", "size": {"X": 10, "Y": 0}}]}`, wantErr: true},
+		{desc: "Concave zone", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "polygon", "center": {"X": 5, "Y": 30}, "points": [
+			{"X": 0, "Y": 0}, {"X": 40, "Y": 0}, {"X": 20, "Y": 10}, {"X": 40, "Y": 40}, {"X": 0, "Y": 40}
+		]}]}`, wantErr: true},
+		{desc: "Zone centered outside itself", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "polygon", "center": {"X": 90, "Y": 90}, "points": [{"X": 0, "Y": 0}, {"X": 40, "Y": 0}, {"X": 0, "Y": 40}]}]}`, wantErr: true},
+		{desc: "Bullseye bigger than its zone", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "rectangle", "center": {"X": 50, "Y": 50}, "size": {"X": 100, "Y": 20}, "bullseyeRadius": 10}]}`, wantErr: true},
+		{desc: "Unknown point curve", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "ring", "radius": 5, "curve": "cubic"}]}`, wantErr: true},
+		{desc: "Stepped zone without steps", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "ring", "radius": 5, "curve": "stepped"}]}`, wantErr: true},
+		{desc: "Table zone without scores", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "ring", "radius": 5, "curve": "table"}]}`, wantErr: true},
+		{desc: "Every launch zone shape", json: `{"name": "x", "obstacles": [], "launchZones": [
+			{"shape": "strip", "edge": "left", "depth": 80},
+			{"shape": "arc", "center": {"X": 300, "Y": 240}, "radius": 150, "depth": 60, "from": 45, "to": 135},
+			{"shape": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 100, "Y": 0}, {"X": 0, "Y": 100}]}
+		]}`},
+		{desc: "Unknown launch zone shape", json: `{"name": "x", "obstacles": [], "launchZones": [{"shape": "star"}]}`, wantErr: true},
+		{desc: "Strip without an edge", json: `{"name": "x", "obstacles": [], "launchZones": [{"shape": "strip", "depth": 80}]}`, wantErr: true},
+		{desc: "Strip without a depth", json: `{"name": "x", "obstacles": [], "launchZones": [{"shape": "strip", "edge": "top"}]}`, wantErr: true},
+		{desc: "Arc without a depth", json: `{"name": "x", "obstacles": [], "launchZones": [{"shape": "arc", "radius": 100}]}`, wantErr: true},
+		{desc: "Launch polygon with two corners", json: `{"name": "x", "obstacles": [], "launchZones": [{"shape": "polygon", "points": [{"X": 0, "Y": 0}, {"X": 1, "Y": 1}]}]}`, wantErr: true},
+		{desc: "Zone scoring more at the edge", json: `{"name": "x", "obstacles": [], "scoringZones": [{"shape": "ring", "radius": 5, "maxScore": 1, "minScore": 9}]}`, wantErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := engine.ParseLevel([]byte(tC.json))
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s: got error %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestitutionDefaultsToPerfectBounce(t *testing.T) {
+	level, err := engine.ParseLevel([]byte(`{"name": "x", "obstacles": [
+		{"kind": "bumper", "radius": 5},
+		{"kind": "bumper", "radius": 5, "restitution": 0}
+	]}`))
+	if err != nil {
+		t.Fatalf("FAIL parsing level: %v", err)
+	}
+	if got := level.Obstacles[0].Restitution; got != 1 {
+		t.Errorf("FAIL left out restitution: got %v, want %v", got, 1)
+	}
+	if got := level.Obstacles[1].Restitution; got != 0 {
+		t.Errorf("FAIL dead restitution: got %v, want %v", got, 0)
+	}
+
+	// and a dead obstacle stays dead through the config the client and replays get
+	g := engine.NewMarbleGame()
+	g.Config.UseLevel(level)
+	marshalled, _ := json.Marshal(g.Config)
+	var config engine.MarbleGameConfig
+	if err := json.Unmarshal(marshalled, &config); err != nil {
+		t.Fatalf("FAIL unmarshalling config: %v", err)
+	}
+	if config.Level != "x" || config.Obstacles[1].Restitution != 0 {
+		t.Errorf("FAIL config round trip: got %s with %v", config.Level, config.Obstacles)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	if engine.Levels[0].Name != engine.OpenField.Name {
+		t.Errorf("FAIL first level: got %s, want %s", engine.Levels[0].Name, engine.OpenField.Name)
+	}
+	for _, name := range []string{"open", "Bumpers", "gates", "PILLARS", "ring", "stadium", "hexagon", "islands"} {
+		if _, err := engine.LevelByName(name); err != nil {
+			t.Errorf("FAIL finding level %s: %v", name, err)
+		}
+	}
+	if _, err := engine.LevelByName("moon"); err == nil {
+		t.Errorf("FAIL unknown level should error")
+	}
+
+	// levels without scoring zones keep the usual target
+	for name, want := range map[string]int{"open": 1, "islands": 4} {
+		level, _ := engine.LevelByName(name)
+		g := engine.NewMarbleGame()
+		g.Config.UseLevel(level)
+		if got := len(g.Config.ScoringZones); got != want {
+			t.Errorf("FAIL %s scoring zones: got %d, want %d", name, got, want)
+		}
+	}
+
+	// every shipped level can be played through
+	for _, level := range engine.Levels {
+		g := newTwoPlayerGame(t, 2)
+		g.Config.UseLevel(level)
+		for _, pos := range [][2]float64{{300, 240}, {150, 100}, {450, 380}, {300, 420}} {
+			player := g.TurnOrder[g.ActivePlayerIndex]
+			action := shootNear(t, g, pos[0], pos[1])
+			action.Vel.X += 120
+			if err := g.PlayAction(action); err != nil {
+				t.Fatalf("FAIL %s shot on %s: %v", player.UserToken, level.Name, err)
+			}
+		}
+		if g.State != engine.GameStateFinished {
+			t.Errorf("FAIL %s: match didn't finish", level.Name)
+		}
+	}
+}
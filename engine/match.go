@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"slices"
+	"time"
+)
+
+// Validates and simulates an action, then hands the turn to the next player
+// the match is finished here once IsGameOver says so
+func (marbleGame *MarbleGame) PlayAction(action Action) error {
+	var before turnSnapshot
+	if marbleGame.Config.TakebacksPerMatch > 0 {
+		before = marbleGame.snapshot(action.UserToken)
+	}
+
+	latestFrame := marbleGame.Frames[len(marbleGame.Frames)-1]
+	validatedFrame, err := marbleGame.ValidateGameAction(action, latestFrame)
+	if err != nil {
+		return err
+	}
+
+	if marbleGame.State == GameStateWaiting {
+		marbleGame.State = GameStateInProgress
+	}
+	marbleGame.PlayerIsBack(action.UserToken)
+
+	marbleGame.Frames = marbleGame.GenerateNewGameFrames(&action, &validatedFrame)
+
+	// add to the played turns on player
+	marbleGame.TurnOrder[marbleGame.ActivePlayerIndex].TurnsTaken++
+	marbleGame.updateBestMarbleScores()
+	marbleGame.logAction(action)
+	if before.game != nil {
+		marbleGame.remember(before)
+	}
+
+	if marbleGame.IsGameOver() {
+		marbleGame.State = GameStateFinished
+		marbleGame.TurnDeadline = time.Time{}
+		return nil
+	}
+
+	marbleGame.AdvanceTurn()
+
+	return nil
+}
+
+// Hands the turn to whoever the mode says is next
+func (marbleGame *MarbleGame) AdvanceTurn() {
+	marbleGame.ActivePlayerIndex = marbleGame.Mode().NextPlayer(marbleGame)
+}
+
+func (marbleGame *MarbleGame) IsGameOver() bool {
+	return marbleGame.Mode().IsGameOver(marbleGame)
+}
+
+// The index of the next player in TurnOrder that still has marbles to throw, round robin
+func (marbleGame *MarbleGame) nextPlayerWithMarbles() int {
+	next := marbleGame.ActivePlayerIndex
+	for range marbleGame.TurnOrder {
+		next++
+		if next >= len(marbleGame.TurnOrder) {
+			next = 0
+		}
+		if len(marbleGame.TurnOrder[next].Inventory) > 0 {
+			return next
+		}
+	}
+	return next
+}
+
+// Ranks every player by Score (or ends won in a BestOf match), tied players share a rank
+// players who left keep their score, but leaving forfeits their place so they rank after everyone still seated
+func (marbleGame *MarbleGame) Standings() []Standing {
+	endsWon := marbleGame.EndsWon()
+	leavers := []*Player{}
+	for _, player := range marbleGame.Players {
+		if player.Left {
+			leavers = append(leavers, player)
+		}
+	}
+	// in the order they joined, as Players is a map
+	slices.SortFunc(leavers, func(a, b *Player) int { return a.Id - b.Id })
+
+	standings := []Standing{}
+	for _, player := range append(slices.Clone(marbleGame.TurnOrder), leavers...) {
+		standings = append(standings, Standing{
+			UserToken:       player.UserToken,
+			DisplayName:     player.DisplayName,
+			Score:           player.Score,
+			TurnsTaken:      player.TurnsTaken,
+			BestMarbleScore: player.BestMarbleScore,
+			EndsWon:         endsWon[player.UserToken],
+			Left:            player.Left,
+		})
+	}
+
+	// best of matches are won on ends, and points only break ties
+	compare := func(a, b Standing) int {
+		if a.Left != b.Left {
+			if a.Left {
+				return 1
+			}
+			return -1
+		}
+		if marbleGame.Config.BestOf && a.EndsWon != b.EndsWon {
+			return b.EndsWon - a.EndsWon
+		}
+		return b.Score - a.Score
+	}
+
+	// stable so tied players keep their turn order
+	slices.SortStableFunc(standings, compare)
+
+	for i := range standings {
+		if i > 0 && compare(standings[i], standings[i-1]) == 0 {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+
+	return standings
+}
+
+func (marbleGame *MarbleGame) Summary() MatchSummary {
+	standings := marbleGame.Standings()
+
+	winners := []string{}
+	for _, standing := range standings {
+		if standing.Rank == 1 {
+			winners = append(winners, standing.UserToken)
+		}
+	}
+
+	return MatchSummary{
+		Standings: standings,
+		Winners:   winners,
+		IsTie:     len(winners) > 1,
+	}
+}
+
+func (marbleGame *MarbleGame) updateBestMarbleScores() {
+	finalFrame := marbleGame.Frames[len(marbleGame.Frames)-1]
+	for _, m := range finalFrame.Marbles {
+		if m.Owner != nil && m.Score > m.Owner.BestMarbleScore {
+			m.Owner.BestMarbleScore = m.Score
+		}
+	}
+}
+
+func (marbleGame *MarbleGame) logAction(action Action) {
+	marbleGame.ActionLog = append(marbleGame.ActionLog, LoggedAction{
+		Action: action,
+		Scores: marbleGame.scores(),
+	})
+}
+
+// Every player's score, by userToken
+func (marbleGame *MarbleGame) scores() map[string]int {
+	scores := make(map[string]int)
+	for userToken, player := range marbleGame.Players {
+		scores[userToken] = player.Score
+	}
+	return scores
+}
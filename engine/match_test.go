@@ -0,0 +1,149 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"reflect"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func newTwoPlayerGame(t *testing.T, inventorySize int) *engine.MarbleGame {
+	t.Helper()
+	g := engine.NewMarbleGame()
+	for _, userToken := range []string{"player 1", "player 2"} {
+		p, err := g.AddPlayer(userToken)
+		if err != nil {
+			t.Fatalf("FAIL adding %s: %v", userToken, err)
+		}
+		p.Inventory = p.Inventory[:inventorySize]
+	}
+	return g
+}
+
+// places a marble with no power behind it, so it stays where it was placed
+func shoot(userToken string, x, y float64) engine.Action {
+	return engine.Action{
+		InventorySlot: 0,
+		Pos:           vector2.Vector2{X: x, Y: y},
+		Vel:           vector2.Vector2{X: x, Y: y},
+		UserToken:     userToken,
+	}
+}
+
+// like shoot, but moved to the closest spot the active player can legally place their first marble
+func shootNear(t *testing.T, g *engine.MarbleGame, x, y float64) engine.Action {
+	t.Helper()
+	player := g.TurnOrder[g.ActivePlayerIndex]
+	pos, err := g.ClosestPlacement(player, player.Inventory[0], vector2.Vector2{X: x, Y: y}, g.Frames[len(g.Frames)-1])
+	if err != nil {
+		t.Fatalf("FAIL placing near %v, %v: %v", x, y, err)
+	}
+	return shoot(player.UserToken, pos.X, pos.Y)
+}
+
+func TestGameLifecycle(t *testing.T) {
+	g := newTwoPlayerGame(t, 1)
+
+	if g.State != engine.GameStateWaiting {
+		t.Errorf("FAIL new game state: got %s, want %s", g.State, engine.GameStateWaiting)
+	}
+
+	if err := g.PlayAction(shoot("player 1", 300, 240)); err != nil {
+		t.Fatalf("FAIL player 1 shot: %v", err)
+	}
+	if g.State != engine.GameStateInProgress {
+		t.Errorf("FAIL state after first shot: got %s, want %s", g.State, engine.GameStateInProgress)
+	}
+
+	if err := g.PlayAction(shoot("player 2", 50, 50)); err != nil {
+		t.Fatalf("FAIL player 2 shot: %v", err)
+	}
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL state after every inventory is empty: got %s, want %s", g.State, engine.GameStateFinished)
+	}
+
+	if err := g.PlayAction(shoot("player 1", 300, 240)); err == nil {
+		t.Errorf("FAIL playing after the game is over should error")
+	}
+	if _, err := g.AddPlayer("player 3"); err == nil {
+		t.Errorf("FAIL joining after the game is over should error")
+	}
+}
+
+func TestTargetScore(t *testing.T) {
+	g := newTwoPlayerGame(t, 3)
+	g.Config.TargetScore = g.Config.ScoringZones[0].BullseyeScore
+
+	if err := g.PlayAction(shoot("player 1", 300, 240)); err != nil {
+		t.Fatalf("FAIL player 1 shot: %v", err)
+	}
+	if g.State != engine.GameStateFinished {
+		t.Errorf("FAIL bullseye should reach the target score: got %s, want %s", g.State, engine.GameStateFinished)
+	}
+
+	summary := g.Summary()
+	if !reflect.DeepEqual(summary.Winners, []string{"player 1"}) {
+		t.Errorf("FAIL winners: got %v, want %v", summary.Winners, []string{"player 1"})
+	}
+	if summary.Standings[0].BestMarbleScore != g.Config.ScoringZones[0].BullseyeScore {
+		t.Errorf("FAIL best marble score: got %d, want %d", summary.Standings[0].BestMarbleScore, g.Config.ScoringZones[0].BullseyeScore)
+	}
+	if summary.Standings[0].TurnsTaken != 1 {
+		t.Errorf("FAIL turns taken: got %d, want %d", summary.Standings[0].TurnsTaken, 1)
+	}
+}
+
+func TestStandings(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		scores    []int
+		wantRanks []int
+		wantTie   bool
+	}{
+		{
+			desc:      "Clear winner",
+			scores:    []int{10, 30, 20},
+			wantRanks: []int{1, 2, 3},
+			wantTie:   false,
+		},
+		{
+			desc:      "Tie for first",
+			scores:    []int{30, 30, 20},
+			wantRanks: []int{1, 1, 3},
+			wantTie:   true,
+		},
+		{
+			desc:      "Tie for second",
+			scores:    []int{5, 20, 5},
+			wantRanks: []int{1, 2, 2},
+			wantTie:   false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := engine.NewMarbleGame()
+			g.Config.PlayerLimit = len(tC.scores)
+			for i, score := range tC.scores {
+				p, _ := g.AddPlayer(string(rune('a' + i)))
+				p.Score = score
+			}
+
+			summary := g.Summary()
+
+			ranks := []int{}
+			for i, standing := range summary.Standings {
+				ranks = append(ranks, standing.Rank)
+				if i > 0 && standing.Score > summary.Standings[i-1].Score {
+					t.Errorf("FAIL %s: standings not sorted by score", tC.desc)
+				}
+			}
+			if !reflect.DeepEqual(ranks, tC.wantRanks) {
+				t.Errorf("FAIL %s: got ranks %v, want %v", tC.desc, ranks, tC.wantRanks)
+			}
+			if summary.IsTie != tC.wantTie {
+				t.Errorf("FAIL %s: got tie %v, want %v", tC.desc, summary.IsTie, tC.wantTie)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"time"
+
 	"github.com/deeean/go-vector/vector2"
 	"github.com/ungerik/go3d/float64/quaternion"
 )
@@ -11,18 +13,79 @@ type MarbleGame struct {
 	Config            MarbleGameConfig   `json:"config"`
 	TurnOrder         []*Player          `json:"turnOrder"`
 	ActivePlayerIndex int                `json:"activePlayerIndex"` // index from TurnOrder, whose turn it is
+	State             GameState          `json:"state"`
+	ActionLog         []LoggedAction     `json:"actionLog"`
+	JoinLog           []LoggedJoin       `json:"joinLog"`
+	NextMarbleId      int                `json:"nextMarbleId"`
+	Ends              []End              `json:"ends"`         // finished ends, see ends.go
+	Hammer            string             `json:"hammer"`       // userToken of who throws last this end, "" for the last in TurnOrder
+	TurnDeadline      time.Time          `json:"turnDeadline"` // when the active player's turn runs out, zero with no clock running, see turnclock.go
+	history           []turnSnapshot     // from before the latest shots, oldest first, see takeback.go
+}
+
+// One finished end of a match, the field is cleared and everyone's marbles handed back after each
+type End struct {
+	Scores  map[string]int `json:"scores"`  // by userToken, the points each player took in the end
+	Winner  string         `json:"winner"`  // userToken of who took the most points, "" for a tie
+	Actions int            `json:"actions"` // how many actions had been played when it finished
+}
+
+// A validated action, kept in the order it was played
+type LoggedAction struct {
+	Action  Action         `json:"action"`
+	Scores  map[string]int `json:"scores"`  // every player's score once the action settled
+	Skipped bool           `json:"skipped"` // the player's turn was skipped, only Action.UserToken is set
+	Left    bool           `json:"left"`    // the player left the match, only Action.UserToken is set
+}
+
+// When a player took their seat, so a replay can rebuild the same turn order
+type LoggedJoin struct {
+	UserToken   string `json:"userToken"`
+	JoinedAfter int    `json:"joinedAfter"` // how many actions were already logged
 }
 
+// Where the match is in its lifecycle: waiting -> inProgress -> finished
+type GameState string
+
+const (
+	GameStateWaiting    GameState = "waiting"
+	GameStateInProgress GameState = "inProgress"
+	GameStateFinished   GameState = "finished"
+)
+
 type MarbleGameConfig struct {
-	PlayerLimit                         int     `json:"playerLimit"`
-	ScoringZoneRadius                   float64 `json:"scoringZoneRadius"`
-	ScoringZoneMaxScore                 int     `json:"scoringZoneMaxScore"`
-	ScoringZoneMinScore                 int     `json:"scoringZoneMinScore"`
-	BullseyeZoneRadius                  float64 `json:"bullseyeZoneRadius"`
-	BullseyeZoneScore                   int     `json:"bullseyeZoneScore"`
-	Width                               int     `json:"width"`
-	Height                              int     `json:"height"`
-	RemoveMarblesFromOutsideScoringZone bool    `json:"removeMarblesFromOutsideScoringZone"`
+	Mode                                string        `json:"mode"` // name of the GameMode, see GameModes
+	PlayerLimit                         int           `json:"playerLimit"`
+	ScoringZones                        []ScoringZone `json:"scoringZones"` // where marbles score, the first a marble touches counts
+	LaunchZones                         []LaunchZone  `json:"launchZones"`  // where each seat places its marbles, empty for anywhere, see placement.go
+	Width                               int           `json:"width"`
+	Height                              int           `json:"height"`
+	RemoveMarblesFromOutsideScoringZone bool          `json:"removeMarblesFromOutsideScoringZone"`
+	TargetScore                         int           `json:"targetScore"`       // ends the match once reached, 0 to disable
+	Ends                                int           `json:"ends"`              // how many ends a match lasts, it can finish sooner on TargetScore or BestOf
+	BestOf                              bool          `json:"bestOf"`            // won on ends rather than points, over once someone has won most of the Ends
+	TimeStep                            float64       `json:"timeStep"`          // simulated time per emitted frame
+	Substeps                            int           `json:"substeps"`          // physics steps per emitted frame
+	PreviewFrames                       int           `json:"previewFrames"`     // how much of a shot previews show, 0 for the whole outcome (practice mode)
+	Level                               string        `json:"level"`             // name of the Level the obstacles came from
+	Obstacles                           []Obstacle    `json:"obstacles"`         // fixed geometry marbles bounce off, besides the walls
+	Arena                               Arena         `json:"arena"`             // the shape of the walls round the field
+	TurnTime                            float64       `json:"turnTime"`          // seconds each turn lasts before it's skipped, 0 for no clock
+	MissedTurnsToAway                   int           `json:"missedTurnsToAway"` // missed turns in a row before a player's turns are skipped right away, 0 for never
+	LeaveGrace                          float64       `json:"leaveGrace"`        // seconds a disconnected player keeps their seat, 0 to forfeit it straight away
+	LeaverMarbles                       string        `json:"leaverMarbles"`     // what happens to a leaver's marbles on the field, see LeaverMarbleRules
+	TakebacksPerMatch                   int           `json:"takebacksPerMatch"` // shots each player can take back, 0 for none, see takeback.go
+	Physics                             Physics       `json:"physics"`           // how every marble moves, unless its MarbleType says otherwise
+}
+
+// How a marble bounces, slows down and gets launched.
+// On a MarbleType any field left at 0 falls back to the config's.
+type Physics struct {
+	Restitution     float64 `json:"restitution"`     // share of speed kept bouncing off anything, from 0 to 1
+	RollingFriction float64 `json:"rollingFriction"` // share of speed kept every 0.1 time units
+	SlidingFriction float64 `json:"slidingFriction"` // speed lost every time unit, on top of the rolling friction
+	RestThreshold   float64 `json:"restThreshold"`   // marbles slower than this come to rest
+	MaxLaunchSpeed  float64 `json:"maxLaunchSpeed"`  // launches are clamped to this speed
 }
 
 // A game frame is sent as a representation of the entire game state.
@@ -33,23 +96,50 @@ type MarbleGameFrame struct {
 
 // A struct represeting the player.
 type Player struct {
+	Id                int          `json:"id"` // stable for the whole match, in the order players joined
 	UserToken         string       `json:"userToken"`
 	DisplayName       string       `json:"displayName"`
 	Score             int          `json:"score"`
 	Hue               int          `json:"hue"`
-	ShouldSkipMyTurns bool         `json:"shouldSkipMyTurns"`
+	ShouldSkipMyTurns bool         `json:"shouldSkipMyTurns"` // they're away, their turns are skipped until they're back
+	MissedTurns       int          `json:"missedTurns"`       // turns in a row they ran out of time on
+	Left              bool         `json:"left"`              // they left the match, they're kept for their score but have no seat in TurnOrder
+	Takebacks         int          `json:"takebacks"`         // shots they've taken back this match
 	TurnsTaken        int          `json:"turnsTaken"`
+	BestMarbleScore   int          `json:"bestMarbleScore"`
 	Inventory         []MarbleType `json:"inventory"`
 }
 
+// A player's final placing in a finished match
+type Standing struct {
+	Rank            int    `json:"rank"` // tied players share the same rank
+	UserToken       string `json:"userToken"`
+	DisplayName     string `json:"displayName"`
+	Score           int    `json:"score"`
+	TurnsTaken      int    `json:"turnsTaken"`
+	BestMarbleScore int    `json:"bestMarbleScore"`
+	EndsWon         int    `json:"endsWon"`
+	Left            bool   `json:"left"` // they left the match, see Standings
+}
+
+// The end-of-match summary sent to every client
+type MatchSummary struct {
+	Standings []Standing `json:"standings"`
+	Winners   []string   `json:"winners"` // userTokens of everyone ranked first
+	IsTie     bool       `json:"isTie"`
+}
+
 type Action struct {
 	InventorySlot int             `json:"inventorySlot"`
 	Pos           vector2.Vector2 `json:"pos"`
 	Vel           vector2.Vector2 `json:"vel"`
 	UserToken     string          `json:"userToken"`
+	SideSpin      float64         `json:"sideSpin"` // from -1 to 1, bends the shot to the right, or to the left when negative
+	TopSpin       float64         `json:"topSpin"`  // from -1 to 1, follows through after a hit, or draws back when negative
 }
 
 type Marble struct {
+	Id             int             `json:"id"` // stable for the whole match
 	Pos            vector2.Vector2 `json:"pos"`
 	Vel            vector2.Vector2 `json:"vel"`
 	Rot            quaternion.T    `json:"rot"`
@@ -58,6 +148,10 @@ type Marble struct {
 	Collided       bool            `json:"collided"`
 	HighlightColor string          `json:"highlightColor"`
 	Owner          *Player         `json:"owner"`
+	Triggered      bool            `json:"triggered"` // its type's Ability has gone off, e.g. an explosive that's exploded
+	Group          int             `json:"group"`     // marbles stuck together share a Group, 0 for none
+	SideSpin       float64         `json:"sideSpin"`  // radians per time unit its path turns, see spin.go
+	TopSpin        vector2.Vector2 `json:"topSpin"`   // roll on top of its natural roll, it points along Vel for top spin and against it for back spin
 }
 
 type MarbleType struct {
@@ -65,4 +159,7 @@ type MarbleType struct {
 	Description string  `json:"description"`
 	Radius      float64 `json:"radius"`
 	Mass        float64 `json:"mass"`
+	Neutral     bool    `json:"neutral"` // thrown without an owner, like the jack in Bocce
+	Ability     string  `json:"ability"` // name of its Ability, "" for a plain marble
+	Physics     Physics `json:"physics"` // overrides the config's Physics where set
 }
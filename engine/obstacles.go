@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Fixed level geometry marbles bounce off, they never move
+type Obstacle struct {
+	Kind        ObstacleKind      `json:"kind"`
+	Pos         vector2.Vector2   `json:"pos"`         // bumper center
+	Radius      float64           `json:"radius"`      // bumper radius
+	Points      []vector2.Vector2 `json:"points"`      // wall ends, or polygon corners in order
+	Restitution float64           `json:"restitution"` // share of speed kept off it, from 0 to 1, and 1 when left out of a level file
+}
+
+type ObstacleKind string
+
+const (
+	ObstacleBumper  ObstacleKind = "bumper"
+	ObstacleWall    ObstacleKind = "wall"
+	ObstaclePolygon ObstacleKind = "polygon"
+)
+
+// Obstacles bounce perfectly unless the level file says otherwise
+func (obstacle *Obstacle) UnmarshalJSON(data []byte) error {
+	type plain Obstacle
+	decoded := plain{Restitution: 1}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*obstacle = Obstacle(decoded)
+	return nil
+}
+
+// The edges of a wall or polygon, a bumper has none
+func (obstacle *Obstacle) edges() [][2]vector2.Vector2 {
+	switch obstacle.Kind {
+	case ObstacleWall:
+		if len(obstacle.Points) == 2 {
+			return [][2]vector2.Vector2{{obstacle.Points[0], obstacle.Points[1]}}
+		}
+	case ObstaclePolygon:
+		edges := [][2]vector2.Vector2{}
+		for i := range obstacle.Points {
+			edges = append(edges, [2]vector2.Vector2{obstacle.Points[i], obstacle.Points[(i+1)%len(obstacle.Points)]})
+		}
+		return edges
+	}
+	return nil
+}
+
+// Whether the point is strictly inside a polygon, which is convex so it's on the same side of every edge
+func (obstacle *Obstacle) contains(point vector2.Vector2) bool {
+	if obstacle.Kind != ObstaclePolygon || len(obstacle.Points) < 3 {
+		return false
+	}
+	sign := 0.0
+	for _, edge := range obstacle.edges() {
+		cross := cross(edge[1].Sub(&edge[0]), point.Sub(&edge[0]))
+		if cross == 0 || cross*sign < 0 {
+			return false
+		}
+		sign = cross
+	}
+	return true
+}
+
+// How far a marble at pos with the radius sinks into the obstacle, and the normal pointing from the obstacle to the marble
+// a negative depth is the gap between them
+func (obstacle *Obstacle) contact(pos vector2.Vector2, radius float64) (vector2.Vector2, float64) {
+	if obstacle.Kind == ObstacleBumper {
+		away := pos.Sub(&obstacle.Pos)
+		distance := away.Magnitude()
+		if distance == 0 {
+			return vector2.Vector2{X: 0, Y: -1}, radius + obstacle.Radius
+		}
+		return *away.DivScalar(distance), radius + obstacle.Radius - distance
+	}
+
+	var closest vector2.Vector2
+	var closestEdge [2]vector2.Vector2
+	distance := math.Inf(1)
+	for _, edge := range obstacle.edges() {
+		point := closestPointOnSegment(pos, edge[0], edge[1])
+		if d := pos.Distance(&point); d < distance {
+			closest, closestEdge, distance = point, edge, d
+		}
+	}
+	if math.IsInf(distance, 1) {
+		return vector2.Vector2{X: 0, Y: -1}, math.Inf(-1)
+	}
+
+	if distance == 0 {
+		// right on an edge, so go out square to it
+		edge := closestEdge[1].Sub(&closestEdge[0]).Normalize()
+		normal := vector2.Vector2{X: edge.Y, Y: -edge.X}
+		if obstacle.contains(*pos.Add(normal.MulScalar(contactEpsilon))) {
+			normal = *normal.MulScalar(-1)
+		}
+		return normal, radius
+	}
+	if obstacle.contains(pos) {
+		// the center is inside, the nearest way out is through the closest edge
+		return *closest.Sub(&pos).DivScalar(distance), radius + distance
+	}
+	return *pos.Sub(&closest).DivScalar(distance), radius - distance
+}
+
+// When a marble moving along travel first touches the obstacle, marbles already touching it are left to contact
+func (obstacle *Obstacle) timeOfImpact(marble *Marble) (float64, bool) {
+	travel := marble.Vel.MulScalar(-1)
+	radius := marble.Type.Radius
+
+	if obstacle.Kind == ObstacleBumper {
+		return sweptTimeOfImpact(marble.Pos.Sub(&obstacle.Pos), travel, radius+obstacle.Radius)
+	}
+
+	earliest := math.Inf(1)
+	for _, edge := range obstacle.edges() {
+		if t, ok := segmentTimeOfImpact(marble.Pos, *travel, radius, edge[0], edge[1]); ok && t < earliest {
+			earliest = t
+		}
+		// the corners are hit like bumpers with no size
+		if t, ok := sweptTimeOfImpact(marble.Pos.Sub(&edge[0]), travel, radius); ok && t < earliest {
+			earliest = t
+		}
+	}
+	if obstacle.Kind == ObstacleWall && len(obstacle.Points) == 2 {
+		if t, ok := sweptTimeOfImpact(marble.Pos.Sub(&obstacle.Points[1]), travel, radius); ok && t < earliest {
+			earliest = t
+		}
+	}
+	return earliest, !math.IsInf(earliest, 1)
+}
+
+// Bounces the marble off the obstacle if it's heading into it (travel is opposite to Vel)
+// normal points from the obstacle to the marble, restitution is the marble's own
+func (obstacle *Obstacle) bounce(marble *Marble, normal vector2.Vector2, restitution float64) {
+	into := marble.Vel.Dot(&normal)
+	if into <= 0 {
+		return
+	}
+	marble.Collided = true
+	// anything over 1 could trap a marble between an obstacle and a wall, gaining speed forever
+	restitution *= math.Min(math.Max(obstacle.Restitution, 0), 1)
+	marble.Vel = *marble.Vel.Sub(normal.MulScalar((1 + restitution) * into))
+}
+
+// Shoves a marble that's overlapping the obstacle back out, and bounces it if it's still heading in
+func (obstacle *Obstacle) pushOut(marble *Marble, restitution float64) {
+	normal, depth := obstacle.contact(marble.Pos, marble.Type.Radius)
+	if depth <= contactEpsilon {
+		return
+	}
+	marble.Pos = *marble.Pos.Add(normal.MulScalar(depth))
+	obstacle.bounce(marble, normal, restitution)
+}
+
+// Solves when a circle moving along travel first gets within radius of the line through a and b,
+// then checks that happens between a and b, the ends are left to sweptTimeOfImpact
+func segmentTimeOfImpact(pos, travel vector2.Vector2, radius float64, a, b vector2.Vector2) (float64, bool) {
+	edge := b.Sub(&a)
+	length := edge.Magnitude()
+	if length == 0 {
+		return 0, false
+	}
+
+	normal := vector2.Vector2{X: -edge.Y / length, Y: edge.X / length}
+	distance := pos.Sub(&a).Dot(&normal)
+	if distance < 0 {
+		normal = *normal.MulScalar(-1)
+		distance = -distance
+	}
+	approach := travel.Dot(&normal)
+	if approach >= 0 || distance < radius-contactEpsilon {
+		return 0, false
+	}
+
+	t := math.Max((distance-radius)/-approach, 0)
+	touching := pos.Add(travel.MulScalar(t))
+	along := touching.Sub(&a).Dot(edge) / (length * length)
+	if along < 0 || along > 1 {
+		return 0, false
+	}
+	return t, true
+}
+
+func closestPointOnSegment(point, a, b vector2.Vector2) vector2.Vector2 {
+	edge := b.Sub(&a)
+	lengthSquared := edge.Dot(edge)
+	if lengthSquared == 0 {
+		return a
+	}
+	along := math.Min(math.Max(point.Sub(&a).Dot(edge)/lengthSquared, 0), 1)
+	return *a.Add(edge.MulScalar(along))
+}
+
+func cross(a, b *vector2.Vector2) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
@@ -0,0 +1,148 @@
+package engine_test
+
+import (
+	"fmt"
+	"marblegame/engine"
+	"math"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/ungerik/go3d/float64/quaternion"
+)
+
+// obstacles whose nearest face is at x = 300, for a marble coming along y = 240
+func obstaclesFacingLeft(restitution float64) map[string]engine.Obstacle {
+	return map[string]engine.Obstacle{
+		"bumper": {Kind: engine.ObstacleBumper, Pos: vector2.Vector2{X: 330, Y: 240}, Radius: 30, Restitution: restitution},
+		"wall":   {Kind: engine.ObstacleWall, Points: []vector2.Vector2{{X: 300, Y: 140}, {X: 300, Y: 340}}, Restitution: restitution},
+		"polygon": {Kind: engine.ObstaclePolygon, Points: []vector2.Vector2{
+			{X: 300, Y: 190}, {X: 400, Y: 190}, {X: 400, Y: 290}, {X: 300, Y: 290},
+		}, Restitution: restitution},
+	}
+}
+
+func TestNoTunnelingThroughObstacles(t *testing.T) {
+	for name, obstacle := range obstaclesFacingLeft(1) {
+		for _, sampling := range samplings {
+			for speed := 1.0; speed <= maxShotSpeed; speed += 3 {
+				t.Run(fmt.Sprintf("%s %s at speed %v", name, sampling.desc, speed), func(t *testing.T) {
+					g := newPhysicsGame(sampling.timeStep, sampling.substeps)
+					g.Config.Obstacles = []engine.Obstacle{obstacle}
+					small := engine.MarbleTypes[2]
+					frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+						movingMarble(small, 300-small.Radius-1, 240, speed),
+					}}
+
+					frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+					for i, f := range frames {
+						if m := f.Marbles[0]; m.Pos.X+m.Type.Radius > 300+1e-6 {
+							t.Fatalf("FAIL frame %d: marble at %v went into the %s", i, m.Pos.X, name)
+						}
+					}
+					if speed >= 10 && frames[len(frames)-1].Marbles[0].Pos.X >= 300-small.Radius-1 {
+						t.Errorf("FAIL marble never bounced off the %s", name)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestObstacleBounces(t *testing.T) {
+	// every frame keeps this much velocity to friction, with one step per frame
+	const friction = 0.96
+	testCases := []struct {
+		desc        string
+		obstacle    string
+		restitution float64
+		vel         vector2.Vector2 // travel is opposite to Vel
+		wantVel     vector2.Vector2 // before friction
+	}{
+		{desc: "Dead wall stops the marble", obstacle: "wall", restitution: 0, vel: vector2.Vector2{X: -100}, wantVel: vector2.Vector2{}},
+		{desc: "Soft wall keeps half", obstacle: "wall", restitution: 0.5, vel: vector2.Vector2{X: -100}, wantVel: vector2.Vector2{X: 50}},
+		{desc: "Bumper keeps it all", obstacle: "bumper", restitution: 1, vel: vector2.Vector2{X: -100}, wantVel: vector2.Vector2{X: 100}},
+		{desc: "Bumpers can't give more than they get", obstacle: "bumper", restitution: 1.5, vel: vector2.Vector2{X: -100}, wantVel: vector2.Vector2{X: 100}},
+		{desc: "Polygon face", obstacle: "polygon", restitution: 0.5, vel: vector2.Vector2{X: -100}, wantVel: vector2.Vector2{X: 50}},
+		{desc: "Glancing off a wall keeps its speed along it", obstacle: "wall", restitution: 0.5, vel: vector2.Vector2{X: -100, Y: 40}, wantVel: vector2.Vector2{X: 50, Y: 40}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 1)
+			g.Config.Obstacles = []engine.Obstacle{obstaclesFacingLeft(tC.restitution)[tC.obstacle]}
+			small := engine.MarbleTypes[2]
+			// it hits halfway through the frame
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{{
+				Pos:   vector2.Vector2{X: 300 - small.Radius + tC.vel.X*0.05, Y: 240},
+				Vel:   tC.vel,
+				Rot:   quaternion.Ident,
+				Type:  small,
+				Owner: &engine.Player{},
+			}}}
+
+			frame.Step(g)
+
+			got := frame.Marbles[0].Vel
+			want := tC.wantVel.MulScalar(friction)
+			if math.Abs(got.X-want.X) > 1e-9 || math.Abs(got.Y-want.Y) > 1e-9 {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, got, *want)
+			}
+			if tC.wantVel.X != 0 && !frame.Marbles[0].Collided {
+				t.Errorf("FAIL %s: marble should be marked as collided", tC.desc)
+			}
+		})
+	}
+}
+
+func TestMarblePlacedInObstacleIsPushedOut(t *testing.T) {
+	small := engine.MarbleTypes[2]
+	obstacles := obstaclesFacingLeft(1)
+	testCases := []struct {
+		desc     string
+		obstacle string
+		pos      vector2.Vector2
+		want     func(pos vector2.Vector2) bool
+	}{
+		{
+			desc:     "Off the side of a bumper",
+			obstacle: "bumper",
+			pos:      vector2.Vector2{X: 340, Y: 240},
+			want: func(pos vector2.Vector2) bool {
+				return pos.X > 330 && pos.Distance(&vector2.Vector2{X: 330, Y: 240}) >= 30+small.Radius-1e-6
+			},
+		},
+		{
+			desc:     "Off whichever side of a wall it's on",
+			obstacle: "wall",
+			pos:      vector2.Vector2{X: 305, Y: 240},
+			want:     func(pos vector2.Vector2) bool { return pos.X >= 300+small.Radius-1e-6 },
+		},
+		{
+			desc:     "Out of a polygon through the nearest edge",
+			obstacle: "polygon",
+			pos:      vector2.Vector2{X: 320, Y: 240},
+			want:     func(pos vector2.Vector2) bool { return pos.X <= 300-small.Radius+1e-6 },
+		},
+		{
+			desc:     "Off a polygon's corner",
+			obstacle: "polygon",
+			pos:      vector2.Vector2{X: 295, Y: 185},
+			want: func(pos vector2.Vector2) bool {
+				return pos.X < 300 && pos.Y < 190 && pos.Distance(&vector2.Vector2{X: 300, Y: 190}) >= small.Radius-1e-6
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			g.Config.Obstacles = []engine.Obstacle{obstacles[tC.obstacle]}
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{movingMarble(small, tC.pos.X, tC.pos.Y, 0)}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			if got := frames[len(frames)-1].Marbles[0].Pos; !tC.want(got) {
+				t.Errorf("FAIL %s: marble left at %v", tC.desc, got)
+			}
+		})
+	}
+}
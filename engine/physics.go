@@ -0,0 +1,311 @@
+package engine
+
+import (
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+const (
+	// caps how many impacts get resolved in one substep, so a pile of marbles can't stall a frame
+	maxImpactsPerSubstep = 64
+	// overlaps smaller than this are rounding error from resolving an impact, not real overlaps
+	contactEpsilon = 1e-6
+)
+
+// How marbles behaved before physics was configurable: perfectly bouncy, losing 4% of their speed every 0.1 time units
+var DefaultPhysics = Physics{
+	Restitution:     1,
+	RollingFriction: 0.96,
+	SlidingFriction: 0,
+	RestThreshold:   1,
+	MaxLaunchSpeed:  215,
+}
+
+// The physics a marble of the type moves with, the config's with whatever the type overrides
+func (config *MarbleGameConfig) PhysicsOf(marbleType MarbleType) Physics {
+	physics := config.Physics
+	if marbleType.Physics.Restitution != 0 {
+		physics.Restitution = marbleType.Physics.Restitution
+	}
+	if marbleType.Physics.RollingFriction != 0 {
+		physics.RollingFriction = marbleType.Physics.RollingFriction
+	}
+	if marbleType.Physics.SlidingFriction != 0 {
+		physics.SlidingFriction = marbleType.Physics.SlidingFriction
+	}
+	if marbleType.Physics.RestThreshold != 0 {
+		physics.RestThreshold = marbleType.Physics.RestThreshold
+	}
+	if marbleType.Physics.MaxLaunchSpeed != 0 {
+		physics.MaxLaunchSpeed = marbleType.Physics.MaxLaunchSpeed
+	}
+	// anything over 1 could trap a marble between two others or a wall, gaining speed forever
+	physics.Restitution = math.Min(math.Max(physics.Restitution, 0), 1)
+	return physics
+}
+
+// The share of speed kept when marbles i and j bounce off each other
+func (frame *MarbleGameFrame) restitution(config *MarbleGameConfig, i, j int) float64 {
+	return config.PhysicsOf(frame.Marbles[i].Type).Restitution * config.PhysicsOf(frame.Marbles[j].Type).Restitution
+}
+
+// The next contact found by a sweep, between two marbles or a marble and a wall or obstacle
+type impact struct {
+	time     float64
+	marble1  int
+	marble2  int // -1 when hitting a wall or obstacle
+	wall     wall
+	obstacle *Obstacle
+}
+
+type wall int
+
+const (
+	noWall wall = iota
+	leftWall
+	rightWall
+	topWall
+	bottomWall
+	arenaBoundary // anywhere on a circle, stadium or polygon arena
+)
+
+// Advances the frame by one emitted frame (Config.TimeStep of simulated time)
+// split into Config.Substeps fixed steps, each swept for impacts so fast marbles can't tunnel
+func (frame *MarbleGameFrame) Step(marbleGame *MarbleGame) {
+	substeps := marbleGame.Config.Substeps
+	if substeps < 1 {
+		substeps = 1
+	}
+	dt := marbleGame.Config.TimeStep / float64(substeps)
+
+	frame.ResetCollidedFlags()
+	frame.RotateMarbles()
+
+	for range substeps {
+		frame.sweep(marbleGame, dt)
+
+		for i := range frame.Marbles {
+			frame.Marbles[i].applySpin(dt)
+			frame.Marbles[i].slowDown(marbleGame.Config.PhysicsOf(frame.Marbles[i].Type), dt)
+		}
+		frame.settle(marbleGame)
+	}
+}
+
+// Applies dt worth of friction, rolling takes a share of the speed and sliding a fixed amount
+func (marble *Marble) slowDown(physics Physics, dt float64) {
+	marble.Vel = *marble.Vel.MulScalar(math.Pow(physics.RollingFriction, dt/0.1))
+	speed := marble.Vel.Magnitude()
+	if speed > 0 {
+		marble.Vel = *marble.Vel.MulScalar(math.Max(speed-physics.SlidingFriction*dt, 0) / speed)
+	}
+	if marble.Vel.Magnitude() < physics.RestThreshold && marble.spinSpent(physics.RestThreshold) {
+		marble.Vel = vector2.Vector2{X: 0, Y: 0}
+		marble.stopSpinning()
+	}
+}
+
+// Moves every marble dt forward in time, stopping at each impact along the way to resolve it
+func (frame *MarbleGameFrame) sweep(marbleGame *MarbleGame, dt float64) {
+	remaining := dt
+	for range maxImpactsPerSubstep {
+		nextImpact, found := frame.earliestImpact(marbleGame, remaining)
+		if !found {
+			break
+		}
+
+		frame.advance(nextImpact.time)
+		frame.resolveImpact(marbleGame, nextImpact)
+		remaining -= nextImpact.time
+	}
+	frame.advance(remaining)
+
+	// anything still overlapping (like a marble placed on top of another) gets shoved apart
+	frame.HandleCollisions(marbleGame)
+}
+
+// Moves every marble along its path for dt, marbles travel opposite to their Vel
+func (frame *MarbleGameFrame) advance(dt float64) {
+	if dt <= 0 {
+		return
+	}
+	for i := range frame.Marbles {
+		m := &frame.Marbles[i]
+		m.Pos = *m.Pos.Add(m.Vel.MulScalar(-dt))
+	}
+}
+
+// Finds the first impact within the next maxTime, if any
+func (frame *MarbleGameFrame) earliestImpact(marbleGame *MarbleGame, maxTime float64) (impact, bool) {
+	earliest := impact{time: math.Inf(1)}
+	found := false
+
+	for _, pair := range frame.sweepCandidates(maxTime) {
+		i, j := pair[0], pair[1]
+		if !frame.collides(i, j) {
+			continue
+		}
+		t, ok := marbleTimeOfImpact(&frame.Marbles[i], &frame.Marbles[j])
+		if ok && t <= maxTime && t < earliest.time {
+			earliest = impact{time: t, marble1: i, marble2: j}
+			found = true
+		}
+	}
+
+	for i := range frame.Marbles {
+		t, w, ok := boundaryTimeOfImpact(&frame.Marbles[i], &marbleGame.Config)
+		if ok && t <= maxTime && t < earliest.time {
+			earliest = impact{time: t, marble1: i, marble2: -1, wall: w}
+			found = true
+		}
+	}
+
+	for i := range frame.Marbles {
+		for j := range marbleGame.Config.Obstacles {
+			obstacle := &marbleGame.Config.Obstacles[j]
+			t, ok := obstacle.timeOfImpact(&frame.Marbles[i])
+			if ok && t <= maxTime && t < earliest.time {
+				earliest = impact{time: t, marble1: i, marble2: -1, obstacle: obstacle}
+				found = true
+			}
+		}
+	}
+
+	return earliest, found
+}
+
+// Solves |p + d*t| = r1 + r2 for the earliest t >= 0, where p is the gap between centers and d how fast it changes
+// only approaching marbles that aren't already overlapping can have an impact
+func marbleTimeOfImpact(marble1, marble2 *Marble) (float64, bool) {
+	p := marble1.Pos.Sub(&marble2.Pos)
+	d := marble2.Vel.Sub(&marble1.Vel) // travel is opposite to Vel
+	return sweptTimeOfImpact(p, d, marble1.Type.Radius+marble2.Type.Radius)
+}
+
+// The earliest t >= 0 where |p + d*t| = minDistance, for anything round closing in on something else round
+func sweptTimeOfImpact(p, d *vector2.Vector2, minDistance float64) (float64, bool) {
+	a := d.Dot(d)
+	b := 2 * p.Dot(d)
+	c := p.Dot(p) - minDistance*minDistance
+
+	if a == 0 || b >= 0 || c < -contactEpsilon {
+		return 0, false
+	}
+
+	discriminant := b*b - 4*a*c
+	if discriminant < 0 {
+		return 0, false
+	}
+
+	t := (-b - math.Sqrt(discriminant)) / (2 * a)
+	if t < 0 {
+		t = 0
+	}
+	return t, true
+}
+
+// Finds when a marble will touch the edge of the arena
+func boundaryTimeOfImpact(marble *Marble, config *MarbleGameConfig) (float64, wall, bool) {
+	if !config.Arena.isRectangle() {
+		t, ok := config.arenaTimeOfImpact(marble)
+		return t, arenaBoundary, ok
+	}
+	return wallTimeOfImpact(marble, *config)
+}
+
+// Finds when a marble moving toward a wall will touch it
+func wallTimeOfImpact(marble *Marble, config MarbleGameConfig) (float64, wall, bool) {
+	travel := marble.Vel.MulScalar(-1)
+	radius := marble.Type.Radius
+	width := float64(config.Width)
+	height := float64(config.Height)
+
+	earliest := math.Inf(1)
+	earliestWall := noWall
+
+	check := func(t float64, w wall) {
+		if t < 0 {
+			t = 0
+		}
+		if t < earliest {
+			earliest = t
+			earliestWall = w
+		}
+	}
+
+	if travel.X < 0 && marble.Pos.X-radius >= -contactEpsilon {
+		check((radius-marble.Pos.X)/travel.X, leftWall)
+	}
+	if travel.X > 0 && marble.Pos.X+radius <= width+contactEpsilon {
+		check((width-radius-marble.Pos.X)/travel.X, rightWall)
+	}
+	if travel.Y < 0 && marble.Pos.Y-radius >= -contactEpsilon {
+		check((radius-marble.Pos.Y)/travel.Y, topWall)
+	}
+	if travel.Y > 0 && marble.Pos.Y+radius <= height+contactEpsilon {
+		check((height-radius-marble.Pos.Y)/travel.Y, bottomWall)
+	}
+
+	return earliest, earliestWall, earliestWall != noWall
+}
+
+func (frame *MarbleGameFrame) resolveImpact(marbleGame *MarbleGame, i impact) {
+	marble1 := &frame.Marbles[i.marble1]
+	restitution := marbleGame.Config.PhysicsOf(marble1.Type).Restitution
+
+	if i.obstacle != nil {
+		normal, _ := i.obstacle.contact(marble1.Pos, marble1.Type.Radius)
+		i.obstacle.bounce(marble1, normal, restitution)
+		frame.carry(i.marble1)
+		frame.impacted(marbleGame, i.marble1, -1)
+		return
+	}
+
+	if i.marble2 == -1 {
+		// reverse momentum off the wall
+		switch i.wall {
+		case leftWall, rightWall:
+			marble1.Vel.X = -marble1.Vel.X * restitution
+		case topWall, bottomWall:
+			marble1.Vel.Y = -marble1.Vel.Y * restitution
+		case arenaBoundary:
+			normal, _ := marbleGame.Config.arenaContact(marble1.Pos, marble1.Type.Radius)
+			reflectOffBoundary(marble1, normal, restitution)
+		}
+		frame.carry(i.marble1)
+		frame.impacted(marbleGame, i.marble1, -1)
+		return
+	}
+
+	marble2 := &frame.Marbles[i.marble2]
+	marble1.Collided = true
+	marble2.Collided = true
+
+	normal := marble1.Pos.Sub(&marble2.Pos).Normalize()
+	frame.bounce(&marbleGame.Config, i.marble1, i.marble2, normal)
+	frame.impacted(marbleGame, i.marble1, i.marble2)
+	frame.impacted(marbleGame, i.marble2, i.marble1)
+}
+
+// Computes new velocities using the 2D collision formula, perfectly elastic when restitution is 1
+// normal points from marble2 to marble1, m1 and m2 are the masses they push back with
+func resolveElasticCollision(marble1, marble2 *Marble, m1, m2, restitution float64, normal *vector2.Vector2) {
+	v1, v2 := marble1.Vel, marble2.Vel
+
+	tangent := vector2.Vector2{X: -normal.Y, Y: normal.X} // Perpendicular vector
+
+	// Decompose velocities into normal and tangential components
+	v1n := normal.Dot(&v1)
+	v1t := tangent.Dot(&v1)
+	v2n := normal.Dot(&v2)
+	v2t := tangent.Dot(&v2)
+
+	// Compute new normal velocities using the 1D collision formula, restitution scales how fast they part
+	v1nFinal := (m1*v1n + m2*v2n + m2*restitution*(v2n-v1n)) / (m1 + m2)
+	v2nFinal := (m1*v1n + m2*v2n + m1*restitution*(v1n-v2n)) / (m1 + m2)
+
+	// Convert back to 2D velocity
+	marble1.Vel = *normal.MulScalar(v1nFinal).Add(tangent.MulScalar(v1t))
+	marble2.Vel = *normal.MulScalar(v2nFinal).Add(tangent.MulScalar(v2t))
+}
@@ -0,0 +1,262 @@
+package engine_test
+
+import (
+	"fmt"
+	"marblegame/engine"
+	"math"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/ungerik/go3d/float64/quaternion"
+)
+
+const maxShotSpeed = 215
+
+// how the frames of a shot get sampled
+var samplings = []struct {
+	desc     string
+	timeStep float64
+	substeps int
+}{
+	{desc: "default", timeStep: 0.1, substeps: 4},
+	{desc: "one step per frame", timeStep: 0.1, substeps: 1},
+	{desc: "coarse frames", timeStep: 1.0, substeps: 1},
+}
+
+func newPhysicsGame(timeStep float64, substeps int) *engine.MarbleGame {
+	g := engine.NewMarbleGame()
+	g.Config.TimeStep = timeStep
+	g.Config.Substeps = substeps
+	g.Config.RemoveMarblesFromOutsideScoringZone = false
+	return g
+}
+
+// a marble travelling towards +X at the given speed (marbles travel opposite to their Vel)
+func movingMarble(marbleType engine.MarbleType, x, y, speed float64) engine.Marble {
+	return engine.Marble{
+		Pos:   vector2.Vector2{X: x, Y: y},
+		Vel:   vector2.Vector2{X: -speed, Y: 0},
+		Rot:   quaternion.Ident,
+		Type:  marbleType,
+		Owner: &engine.Player{},
+	}
+}
+
+func TestNoTunnelingThroughMarbles(t *testing.T) {
+	small := engine.MarbleTypes[2]
+
+	for _, sampling := range samplings {
+		for speed := 1.0; speed <= maxShotSpeed; speed++ {
+			t.Run(fmt.Sprintf("%s at speed %v", sampling.desc, speed), func(t *testing.T) {
+				g := newPhysicsGame(sampling.timeStep, sampling.substeps)
+				frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+					movingMarble(small, 50, 240, speed),
+					movingMarble(small, 50+2*small.Radius+1, 240, 0),
+				}}
+
+				frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+				for i, f := range frames {
+					shooter, target := f.Marbles[0], f.Marbles[1]
+					gap := target.Pos.X - shooter.Pos.X - 2*small.Radius
+					if gap < -1e-6 {
+						t.Fatalf("FAIL frame %d: shooter at %v went into or past target at %v", i, shooter.Pos.X, target.Pos.X)
+					}
+				}
+
+				target := frames[len(frames)-1].Marbles[1]
+				if speed >= 10 && target.Pos.X <= 50+2*small.Radius+1 {
+					t.Errorf("FAIL target was never hit, still at %v", target.Pos.X)
+				}
+			})
+		}
+	}
+}
+
+func TestNoTunnelingThroughWalls(t *testing.T) {
+	for _, sampling := range samplings {
+		for _, marbleType := range engine.MarbleTypes {
+			for speed := 1.0; speed <= maxShotSpeed; speed++ {
+				t.Run(fmt.Sprintf("%s %s at speed %v", sampling.desc, marbleType.Name, speed), func(t *testing.T) {
+					g := newPhysicsGame(sampling.timeStep, sampling.substeps)
+					width := float64(g.Config.Width)
+					frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+						movingMarble(marbleType, width-marbleType.Radius-1, 240, speed),
+					}}
+
+					frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+					for i, f := range frames {
+						m := f.Marbles[0]
+						if m.Pos.X+m.Type.Radius > width+1e-6 || m.Pos.X-m.Type.Radius < -1e-6 {
+							t.Fatalf("FAIL frame %d: marble at %v is outside the arena", i, m.Pos.X)
+						}
+					}
+
+					// sticky marbles stop dead against the wall instead
+					bounces := marbleType.Ability != engine.StickyMarble.Ability
+					if bounces && speed >= 10 && frames[len(frames)-1].Marbles[0].Pos.X >= width-marbleType.Radius-1 {
+						t.Errorf("FAIL marble never bounced off the wall")
+					}
+				})
+			}
+		}
+	}
+}
+
+// Grouping the same substeps into different frames must not change the outcome
+func TestFrameSamplingDoesNotChangeOutcome(t *testing.T) {
+	big := engine.MarbleTypes[1]
+	small := engine.MarbleTypes[2]
+
+	for speed := 10.0; speed <= maxShotSpeed; speed += 15 {
+		t.Run(fmt.Sprintf("speed %v", speed), func(t *testing.T) {
+			var outcomes [][]engine.Marble
+			for _, substeps := range []int{1, 2, 4, 8} {
+				g := newPhysicsGame(0.025*float64(substeps), substeps)
+				frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+					movingMarble(small, 40, 230, speed),
+					movingMarble(big, 200, 250, 0),
+					movingMarble(small, 320, 200, 0),
+				}}
+
+				frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+				outcomes = append(outcomes, frames[len(frames)-1].Marbles)
+			}
+
+			for _, outcome := range outcomes[1:] {
+				for i := range outcome {
+					if math.Abs(outcome[i].Pos.X-outcomes[0][i].Pos.X) > 1e-9 || math.Abs(outcome[i].Pos.Y-outcomes[0][i].Pos.Y) > 1e-9 {
+						t.Errorf("FAIL marble %d: got %v, want %v", i, outcome[i].Pos, outcomes[0][i].Pos)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRestitution(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	overBouncy := plain
+	overBouncy.Physics.Restitution = 1.5
+	testCases := []struct {
+		desc        string
+		restitution float64 // the config's
+		marbleType  engine.MarbleType
+		obstacle    bool // bounces off a wall obstacle at x = 400 rather than the right wall
+		want        float64
+	}{
+		{desc: "Default bounces back at full speed", restitution: 1, marbleType: plain, want: 100},
+		{desc: "Config restitution", restitution: 0.8, marbleType: plain, want: 80},
+		{desc: "Type overrides the config", restitution: 0.8, marbleType: engine.SteelMarble, want: 50},
+		{desc: "Capped at 1", restitution: 1, marbleType: overBouncy, want: 100},
+		{desc: "Obstacle's restitution on top of the marble's", restitution: 1, marbleType: engine.SteelMarble, obstacle: true, want: 25},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(1, 1)
+			g.Config.Physics.Restitution = tC.restitution
+			g.Config.Physics.RollingFriction = 1
+			x := 500.0
+			if tC.obstacle {
+				x = 300
+				g.Config.Obstacles = []engine.Obstacle{{Kind: engine.ObstacleWall, Points: []vector2.Vector2{{X: 400, Y: 140}, {X: 400, Y: 340}}, Restitution: 0.5}}
+			}
+			// no friction, so only the bounce changes its speed
+			marbleType := tC.marbleType
+			marbleType.Physics.RollingFriction = 0
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{movingMarble(marbleType, x, 240, 100)}}
+
+			frame.Step(g)
+
+			// heading back left, so Vel points right
+			if got := frame.Marbles[0].Vel; math.Abs(got.X-tC.want) > 1e-9 || got.Y != 0 {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, got, vector2.Vector2{X: tC.want})
+			}
+		})
+	}
+
+	t.Run("Marbles multiply their restitutions", func(t *testing.T) {
+		g := newPhysicsGame(1, 1)
+		g.Config.Physics.RollingFriction = 1
+		soft := plain
+		soft.Physics.Restitution = 0.5
+		frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+			movingMarble(soft, 100, 240, 100),
+			movingMarble(soft, 200, 240, 0),
+		}}
+		before := momentum(frame)
+
+		frame.Step(g)
+
+		if after := momentum(frame); math.Abs(after.X-before.X) > 1e-9 {
+			t.Errorf("FAIL momentum: got %v, want %v", after, before)
+		}
+		if parting := frame.Marbles[0].Vel.X - frame.Marbles[1].Vel.X; math.Abs(parting-25) > 1e-9 {
+			t.Errorf("FAIL parting speed: got %v, want %v", parting, 25)
+		}
+	})
+}
+
+func TestFriction(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	testCases := []struct {
+		desc       string
+		config     func(physics *engine.Physics)
+		marbleType engine.MarbleType
+		want       float64
+	}{
+		{desc: "Default rolling friction", config: func(*engine.Physics) {}, marbleType: plain, want: 96},
+		{desc: "Config rolling friction", config: func(p *engine.Physics) { p.RollingFriction = 0.5 }, marbleType: plain, want: 50},
+		{desc: "Type rolling friction", config: func(*engine.Physics) {}, marbleType: engine.RubberMarble, want: 90},
+		{desc: "Sliding friction on top", config: func(p *engine.Physics) { p.SlidingFriction = 50 }, marbleType: plain, want: 91},
+		{desc: "Sliding friction stops it dead", config: func(p *engine.Physics) { p.SlidingFriction = 2000 }, marbleType: plain, want: 0},
+		{desc: "Under the rest threshold", config: func(p *engine.Physics) { p.RestThreshold = 100 }, marbleType: plain, want: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 1)
+			tC.config(&g.Config.Physics)
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{movingMarble(tC.marbleType, 300, 240, 100)}}
+
+			frame.Step(g)
+
+			if got := -frame.Marbles[0].Vel.X; math.Abs(got-tC.want) > 1e-9 {
+				t.Errorf("FAIL %s speed: got %v, want %v", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestLaunchSpeedFollowsMarbleType(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		marbleType engine.MarbleType
+		maxSpeed   float64 // the config's
+		want       float64
+	}{
+		{desc: "Default", marbleType: engine.MarbleTypes[0], maxSpeed: 215, want: 215},
+		{desc: "Config", marbleType: engine.MarbleTypes[0], maxSpeed: 300, want: 300},
+		{desc: "Steel", marbleType: engine.SteelMarble, maxSpeed: 215, want: 160},
+		{desc: "Rubber", marbleType: engine.RubberMarble, maxSpeed: 215, want: 260},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 1)
+			g.Config.Physics.MaxLaunchSpeed = tC.maxSpeed
+			g.Players["player 1"].Inventory = []engine.MarbleType{tC.marbleType}
+			// released at the left wall, 500 behind the marble
+			action := shoot("player 1", 500, 240)
+			action.Vel = vector2.Vector2{X: 0, Y: 240}
+
+			frame, err := g.ValidateGameAction(action, g.Frames[len(g.Frames)-1])
+			if err != nil {
+				t.Fatalf("FAIL validating: %v", err)
+			}
+
+			if got := frame.Marbles[0].Vel.Magnitude(); math.Abs(got-tC.want) > 1e-9 {
+				t.Errorf("FAIL %s launch speed: got %v, want %v", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"errors"
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Where a player can put a marble down before they let it go.
+// Each seat gets a launch zone from Config.LaunchZones, by the order players joined in (Player.Id), wrapping round
+// when there are more players than zones, and a marble's center has to be inside it. Without launch zones it can go
+// anywhere on the field. Either way it can't overlap the arena's walls, an obstacle or a marble already down.
+
+type LaunchZone struct {
+	Shape  LaunchShape       `json:"shape"`
+	Edge   FieldEdge         `json:"edge"`   // the side of the field a strip runs along
+	Depth  float64           `json:"depth"`  // how far a strip reaches into the field, or how thick an arc is
+	Center vector2.Vector2   `json:"center"` // an arc's center
+	Radius float64           `json:"radius"` // an arc's inner radius
+	From   float64           `json:"from"`   // an arc's start, in degrees clockwise on screen from +X
+	To     float64           `json:"to"`     // an arc's end, the arc runs clockwise from From to To, the same as From for a whole ring
+	Points []vector2.Vector2 `json:"points"` // a polygon's corners in order, it can be concave
+}
+
+type LaunchShape string
+
+const (
+	LaunchStrip   LaunchShape = "strip"
+	LaunchArc     LaunchShape = "arc"
+	LaunchPolygon LaunchShape = "polygon"
+)
+
+type FieldEdge string
+
+const (
+	EdgeLeft   FieldEdge = "left"
+	EdgeRight  FieldEdge = "right"
+	EdgeTop    FieldEdge = "top"
+	EdgeBottom FieldEdge = "bottom"
+)
+
+// The launch zone the player places in, nil when they can place anywhere
+func (config *MarbleGameConfig) LaunchZoneOf(player *Player) *LaunchZone {
+	if len(config.LaunchZones) == 0 {
+		return nil
+	}
+	return &config.LaunchZones[player.Id%len(config.LaunchZones)]
+}
+
+func (config *MarbleGameConfig) inLaunchZone(zone *LaunchZone, pos vector2.Vector2) bool {
+	switch zone.Shape {
+	case LaunchStrip:
+		switch zone.Edge {
+		case EdgeLeft:
+			return pos.X <= zone.Depth
+		case EdgeRight:
+			return pos.X >= float64(config.Width)-zone.Depth
+		case EdgeTop:
+			return pos.Y <= zone.Depth
+		case EdgeBottom:
+			return pos.Y >= float64(config.Height)-zone.Depth
+		}
+	case LaunchArc:
+		distance := pos.Distance(&zone.Center)
+		if distance < zone.Radius || distance > zone.Radius+zone.Depth {
+			return false
+		}
+		span := math.Mod(zone.To-zone.From, 360)
+		if span <= 0 {
+			span += 360
+		}
+		angle := math.Atan2(pos.Y-zone.Center.Y, pos.X-zone.Center.X) * 180 / math.Pi
+		along := math.Mod(angle-zone.From, 360)
+		if along < 0 {
+			along += 360
+		}
+		return along <= span
+	case LaunchPolygon:
+		return pointInPolygon(pos, zone.Points)
+	}
+	return false
+}
+
+func (zone *LaunchZone) validate() error {
+	switch zone.Shape {
+	case LaunchStrip:
+		switch zone.Edge {
+		case EdgeLeft, EdgeRight, EdgeTop, EdgeBottom:
+		default:
+			return errors.New("Strips need an edge of the field")
+		}
+		if zone.Depth <= 0 {
+			return errors.New("Strips need a depth")
+		}
+	case LaunchArc:
+		if zone.Depth <= 0 || zone.Radius < 0 {
+			return errors.New("Arcs need a depth and a radius that isn't negative")
+		}
+	case LaunchPolygon:
+		if len(zone.Points) < 3 {
+			return errors.New("Launch polygons need at least three corners")
+		}
+	default:
+		return errors.New("Unknown launch zone shape")
+	}
+	return nil
+}
+
+// Checks the player can put a marble of the type down at pos on the frame, the error is an ActionError saying why not
+func (marbleGame *MarbleGame) CheckPlacement(player *Player, marbleType MarbleType, pos vector2.Vector2, frame MarbleGameFrame) error {
+	config := &marbleGame.Config
+	radius := marbleType.Radius
+
+	if zone := config.LaunchZoneOf(player); zone != nil && !config.inLaunchZone(zone, pos) {
+		return actionError(CodeOutsideLaunchZone, "Place your marble in your launch zone")
+	}
+
+	if config.overlapsArena(pos, radius) {
+		return actionError(CodeOverlapsWall, "Marble doesn't fit inside the walls there")
+	}
+
+	for i := range config.Obstacles {
+		if _, depth := config.Obstacles[i].contact(pos, radius); depth > contactEpsilon {
+			return actionError(CodeOverlapsObstacle, "Marble would overlap an obstacle")
+		}
+	}
+
+	for _, m := range frame.Marbles {
+		if pos.Distance(&m.Pos) < radius+m.Type.Radius-contactEpsilon {
+			return actionError(CodeOverlapsMarble, "Marble would overlap another marble")
+		}
+	}
+
+	return nil
+}
+
+// Whether a marble at pos with the radius pokes out of the arena, or is outside it altogether
+func (config *MarbleGameConfig) overlapsArena(pos vector2.Vector2, radius float64) bool {
+	if config.Arena.isRectangle() {
+		return pos.X-radius < -contactEpsilon || pos.Y-radius < -contactEpsilon ||
+			pos.X+radius > float64(config.Width)+contactEpsilon || pos.Y+radius > float64(config.Height)+contactEpsilon
+	}
+	_, depth := config.arenaContact(pos, radius)
+	return depth > contactEpsilon
+}
+
+// The legal spot closest to pos for the player's marble, searching rings around pos a quarter of a marble apart
+// for bots and anything else placing by hand that needs to land somewhere legal
+func (marbleGame *MarbleGame) ClosestPlacement(player *Player, marbleType MarbleType, pos vector2.Vector2, frame MarbleGameFrame) (vector2.Vector2, error) {
+	if marbleGame.CheckPlacement(player, marbleType, pos, frame) == nil {
+		return pos, nil
+	}
+
+	step := math.Max(marbleType.Radius/4, 1)
+	farthest := math.Hypot(float64(marbleGame.Config.Width), float64(marbleGame.Config.Height))
+	for ring := 1; float64(ring)*step <= farthest; ring++ {
+		distance := float64(ring) * step
+		points := 6 * ring
+		for i := range points {
+			angle := 2 * math.Pi * float64(i) / float64(points)
+			candidate := vector2.Vector2{X: pos.X + distance*math.Cos(angle), Y: pos.Y + distance*math.Sin(angle)}
+			if marbleGame.CheckPlacement(player, marbleType, candidate, frame) == nil {
+				return candidate, nil
+			}
+		}
+	}
+	return pos, errors.New("Nowhere to place the marble")
+}
@@ -0,0 +1,263 @@
+package engine_test
+
+import (
+	"errors"
+	"marblegame/engine"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func TestPlacement(t *testing.T) {
+	strips := []engine.LaunchZone{
+		{Shape: engine.LaunchStrip, Edge: engine.EdgeLeft, Depth: 100},
+		{Shape: engine.LaunchStrip, Edge: engine.EdgeRight, Depth: 100},
+	}
+	testCases := []struct {
+		desc      string
+		setup     func(g *engine.MarbleGame)
+		userToken string
+		x, y      float64
+		wantCode  engine.ActionErrorCode // "" for a legal placement
+	}{
+		{desc: "Anywhere without launch zones", userToken: "player 1", x: 300, y: 240},
+		{desc: "Touching a wall", userToken: "player 1", x: 30, y: 30},
+		{desc: "Through the left wall", userToken: "player 1", x: 20, y: 240, wantCode: engine.CodeOverlapsWall},
+		{desc: "Through the bottom wall", userToken: "player 1", x: 300, y: 470, wantCode: engine.CodeOverlapsWall},
+		{desc: "Off the field", userToken: "player 1", x: -100, y: 240, wantCode: engine.CodeOverlapsWall},
+		{
+			desc:      "Poking out of a circle arena",
+			setup:     func(g *engine.MarbleGame) { g.Config.Arena = engine.Arena{Shape: engine.ArenaCircle} },
+			userToken: "player 1", x: 40, y: 40, wantCode: engine.CodeOverlapsWall,
+		},
+		{
+			desc:      "Inside a circle arena",
+			setup:     func(g *engine.MarbleGame) { g.Config.Arena = engine.Arena{Shape: engine.ArenaCircle} },
+			userToken: "player 1", x: 300, y: 240,
+		},
+		{
+			desc: "On a bumper",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.Obstacles = []engine.Obstacle{{Kind: engine.ObstacleBumper, Pos: vector2.Vector2{X: 300, Y: 240}, Radius: 20, Restitution: 1}}
+			},
+			userToken: "player 1", x: 340, y: 240, wantCode: engine.CodeOverlapsObstacle,
+		},
+		{
+			desc: "Touching a bumper",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.Obstacles = []engine.Obstacle{{Kind: engine.ObstacleBumper, Pos: vector2.Vector2{X: 300, Y: 240}, Radius: 20, Restitution: 1}}
+			},
+			userToken: "player 1", x: 350, y: 240,
+		},
+		{
+			desc: "Across a wall obstacle",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.Obstacles = []engine.Obstacle{{Kind: engine.ObstacleWall, Points: []vector2.Vector2{{X: 300, Y: 100}, {X: 300, Y: 380}}, Restitution: 1}}
+			},
+			userToken: "player 1", x: 310, y: 240, wantCode: engine.CodeOverlapsObstacle,
+		},
+		{
+			desc:      "On another marble",
+			setup:     func(g *engine.MarbleGame) { g.PlayAction(shoot("player 1", 300, 240)) },
+			userToken: "player 2", x: 340, y: 240, wantCode: engine.CodeOverlapsMarble,
+		},
+		{
+			desc:      "Touching another marble",
+			setup:     func(g *engine.MarbleGame) { g.PlayAction(shoot("player 1", 300, 240)) },
+			userToken: "player 2", x: 360, y: 240,
+		},
+		{
+			desc:      "In the first player's strip",
+			setup:     func(g *engine.MarbleGame) { g.Config.LaunchZones = strips },
+			userToken: "player 1", x: 60, y: 240,
+		},
+		{
+			desc:      "Outside the first player's strip",
+			setup:     func(g *engine.MarbleGame) { g.Config.LaunchZones = strips },
+			userToken: "player 1", x: 300, y: 240, wantCode: engine.CodeOutsideLaunchZone,
+		},
+		{
+			desc: "In the other player's strip",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = strips
+				g.PlayAction(shoot("player 1", 60, 240))
+			},
+			userToken: "player 2", x: 60, y: 100, wantCode: engine.CodeOutsideLaunchZone,
+		},
+		{
+			desc: "In the second player's strip",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = strips
+				g.PlayAction(shoot("player 1", 60, 240))
+			},
+			userToken: "player 2", x: 540, y: 100,
+		},
+		{
+			desc:      "Seats wrap around the zones",
+			setup:     func(g *engine.MarbleGame) { g.Config.LaunchZones = strips[:1] },
+			userToken: "player 1", x: 60, y: 240,
+		},
+		{
+			desc:      "Launch zone doesn't excuse the wall",
+			setup:     func(g *engine.MarbleGame) { g.Config.LaunchZones = strips },
+			userToken: "player 1", x: 10, y: 240, wantCode: engine.CodeOverlapsWall,
+		},
+		{
+			desc: "In an arc",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchArc, Center: vector2.Vector2{X: 300, Y: 240}, Radius: 150, Depth: 60, From: 45, To: 135}}
+			},
+			userToken: "player 1", x: 300, y: 420,
+		},
+		{
+			desc: "Past the end of an arc",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchArc, Center: vector2.Vector2{X: 300, Y: 240}, Radius: 150, Depth: 60, From: 45, To: 135}}
+			},
+			userToken: "player 1", x: 300, y: 60, wantCode: engine.CodeOutsideLaunchZone,
+		},
+		{
+			desc: "Inside an arc's radius",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchArc, Center: vector2.Vector2{X: 300, Y: 240}, Radius: 150, Depth: 60, From: 45, To: 135}}
+			},
+			userToken: "player 1", x: 300, y: 300, wantCode: engine.CodeOutsideLaunchZone,
+		},
+		{
+			desc: "Arc across zero degrees",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchArc, Center: vector2.Vector2{X: 300, Y: 240}, Radius: 150, Depth: 60, From: 315, To: 45}}
+			},
+			userToken: "player 1", x: 480, y: 240,
+		},
+		{
+			desc: "Whole ring",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchArc, Center: vector2.Vector2{X: 300, Y: 240}, Radius: 150, Depth: 60}}
+			},
+			userToken: "player 1", x: 300, y: 60,
+		},
+		{
+			desc: "In a polygon",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchPolygon, Points: []vector2.Vector2{{X: 0, Y: 0}, {X: 200, Y: 0}, {X: 0, Y: 200}}}}
+			},
+			userToken: "player 1", x: 50, y: 50,
+		},
+		{
+			desc: "Outside a polygon",
+			setup: func(g *engine.MarbleGame) {
+				g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchPolygon, Points: []vector2.Vector2{{X: 0, Y: 0}, {X: 200, Y: 0}, {X: 0, Y: 200}}}}
+			},
+			userToken: "player 1", x: 150, y: 150, wantCode: engine.CodeOutsideLaunchZone,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 2)
+			if tC.setup != nil {
+				tC.setup(g)
+			}
+			player := g.Players[tC.userToken]
+			inventoryBefore := len(player.Inventory)
+
+			err := g.PlayAction(shoot(tC.userToken, tC.x, tC.y))
+
+			if got := engine.ActionErrorCodeOf(err); got != tC.wantCode {
+				t.Errorf("FAIL %s: got code %q (%v), want %q", tC.desc, got, err, tC.wantCode)
+			}
+			if tC.wantCode != "" && len(player.Inventory) != inventoryBefore {
+				t.Errorf("FAIL %s: a rejected placement took a marble, got %d left, want %d", tC.desc, len(player.Inventory), inventoryBefore)
+			}
+		})
+	}
+}
+
+func TestActionErrorCodes(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		mode     string
+		setup    func(g *engine.MarbleGame)
+		action   engine.Action
+		wantCode engine.ActionErrorCode
+	}{
+		{desc: "Spectator", action: shoot("spectator", 300, 240), wantCode: engine.CodeInvalidPlayer},
+		{desc: "Out of turn", action: shoot("player 2", 300, 240), wantCode: engine.CodeNotYourTurn},
+		{desc: "No slot", action: engine.Action{InventorySlot: -1, UserToken: "player 1"}, wantCode: engine.CodeNoSlot},
+		{desc: "Slot out of range", action: engine.Action{InventorySlot: 2, UserToken: "player 1"}, wantCode: engine.CodeSlotOutOfRange},
+		{
+			desc:     "Mode rule",
+			mode:     engine.BocceMode{}.Name(),
+			action:   engine.Action{InventorySlot: 1, Pos: vector2.Vector2{X: 300, Y: 240}, Vel: vector2.Vector2{X: 300, Y: 240}, UserToken: "player 1"},
+			wantCode: engine.CodeModeRule,
+		},
+		{
+			desc: "Game over",
+			setup: func(g *engine.MarbleGame) {
+				for _, pos := range [][2]float64{{300, 240}, {100, 100}, {500, 400}, {100, 380}} {
+					g.PlayAction(shoot(g.TurnOrder[g.ActivePlayerIndex].UserToken, pos[0], pos[1]))
+				}
+			},
+			action:   shoot("player 1", 500, 100),
+			wantCode: engine.CodeGameOver,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := engine.NewMarbleGame()
+			g.Config.Mode = tC.mode
+			for _, userToken := range []string{"player 1", "player 2"} {
+				p, err := g.AddPlayer(userToken)
+				if err != nil {
+					t.Fatalf("FAIL adding %s: %v", userToken, err)
+				}
+				p.Inventory = p.Inventory[:2]
+			}
+			if tC.setup != nil {
+				tC.setup(g)
+			}
+
+			err := g.PlayAction(tC.action)
+
+			var actionErr *engine.ActionError
+			if !errors.As(err, &actionErr) {
+				t.Fatalf("FAIL %s: got %v, want an ActionError", tC.desc, err)
+			}
+			if actionErr.Code != tC.wantCode || actionErr.Message == "" {
+				t.Errorf("FAIL %s: got %q %q, want code %q", tC.desc, actionErr.Code, actionErr.Message, tC.wantCode)
+			}
+		})
+	}
+}
+
+func TestClosestPlacement(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	g.Config.LaunchZones = []engine.LaunchZone{{Shape: engine.LaunchStrip, Edge: engine.EdgeBottom, Depth: 120}}
+	if err := g.PlayAction(shoot("player 1", 300, 420)); err != nil {
+		t.Fatalf("FAIL setting up: %v", err)
+	}
+	player := g.Players["player 2"]
+	frame := g.Frames[len(g.Frames)-1]
+
+	for _, want := range []vector2.Vector2{{X: 300, Y: 240}, {X: 300, Y: 420}, {X: 0, Y: 480}, {X: 600, Y: 0}} {
+		got, err := g.ClosestPlacement(player, player.Inventory[0], want, frame)
+		if err != nil {
+			t.Fatalf("FAIL placing near %v: %v", want, err)
+		}
+		if err := g.CheckPlacement(player, player.Inventory[0], got, frame); err != nil {
+			t.Errorf("FAIL placing near %v: got %v, which isn't legal: %v", want, got, err)
+		}
+	}
+
+	// somewhere legal is left alone
+	legal := vector2.Vector2{X: 100, Y: 420}
+	if got, _ := g.ClosestPlacement(player, player.Inventory[0], legal, frame); got != legal {
+		t.Errorf("FAIL legal placement moved: got %v, want %v", got, legal)
+	}
+
+	// a zone off the field leaves nowhere
+	g.Config.LaunchZones[0].Depth = -10
+	if _, err := g.ClosestPlacement(player, player.Inventory[0], legal, frame); err == nil {
+		t.Errorf("FAIL expected nowhere to place, got no error")
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+// What an action would do if it were played on a frame, see PredictAction
+type Prediction struct {
+	Frames       []MarbleGameFrame `json:"frames"`
+	ScoreChanges map[string]int    `json:"scoreChanges"` // by userToken, how much every player's score would change
+}
+
+// Simulates an action on a frame without changing the game, so players can preview their shots
+// the action is validated like a real one, except it doesn't have to be the player's turn
+func (marbleGame *MarbleGame) PredictAction(action Action, frame MarbleGameFrame) (Prediction, error) {
+	sandbox := marbleGame.sandbox()
+
+	// let players line up a shot while they wait for their turn
+	for i, player := range sandbox.TurnOrder {
+		if player.UserToken == action.UserToken {
+			sandbox.ActivePlayerIndex = i
+		}
+	}
+
+	validatedFrame, err := sandbox.ValidateGameAction(action, sandbox.adoptFrame(frame))
+	if err != nil {
+		return Prediction{}, err
+	}
+
+	frames := sandbox.GenerateNewGameFrames(&action, &validatedFrame)
+
+	// hand the frames back pointing at the real players
+	for i := range frames {
+		frames[i] = marbleGame.adoptFrame(frames[i])
+	}
+
+	scoreChanges := make(map[string]int)
+	for userToken, player := range marbleGame.Players {
+		scoreChanges[userToken] = sandbox.Players[userToken].Score - player.Score
+	}
+
+	return Prediction{
+		Frames:       frames,
+		ScoreChanges: scoreChanges,
+	}, nil
+}
+
+// A deep copy of the game, safe to read or simulate on while the original carries on
+// the clone can't take back shots played before it was made
+func (marbleGame *MarbleGame) Clone() *MarbleGame {
+	clone := marbleGame.sandbox()
+	for _, frame := range marbleGame.Frames {
+		clone.Frames = append(clone.Frames, clone.adoptFrame(frame))
+	}
+	// logged entries are never changed once appended, so they can be shared
+	clone.ActionLog = append(clone.ActionLog, marbleGame.ActionLog...)
+	clone.JoinLog = append(clone.JoinLog, marbleGame.JoinLog...)
+	return clone
+}
+
+// A copy of the game's players, turn order and ends to simulate on, without the frames or logs
+func (marbleGame *MarbleGame) sandbox() *MarbleGame {
+	sandbox := &MarbleGame{
+		Players:           make(map[string]*Player),
+		Frames:            []MarbleGameFrame{},
+		Config:            marbleGame.Config,
+		TurnOrder:         []*Player{},
+		ActivePlayerIndex: marbleGame.ActivePlayerIndex,
+		State:             marbleGame.State,
+		ActionLog:         []LoggedAction{},
+		JoinLog:           []LoggedJoin{},
+		NextMarbleId:      marbleGame.NextMarbleId,
+		Ends:              append([]End{}, marbleGame.Ends...), // ends are never changed once appended
+		Hammer:            marbleGame.Hammer,
+		TurnDeadline:      marbleGame.TurnDeadline,
+	}
+
+	for userToken, player := range marbleGame.Players {
+		playerCopy := *player
+		playerCopy.Inventory = append([]MarbleType{}, player.Inventory...)
+		sandbox.Players[userToken] = &playerCopy
+	}
+	for _, player := range marbleGame.TurnOrder {
+		sandbox.TurnOrder = append(sandbox.TurnOrder, sandbox.Players[player.UserToken])
+	}
+
+	return sandbox
+}
+
+// Copies a frame with its marbles owned by this game's players rather than another copy's
+func (marbleGame *MarbleGame) adoptFrame(frame MarbleGameFrame) MarbleGameFrame {
+	adopted := MarbleGameFrame{Marbles: []Marble{}}
+	for _, m := range frame.Marbles {
+		if m.Owner != nil {
+			m.Owner = marbleGame.Players[m.Owner.UserToken]
+		}
+		adopted.Marbles = append(adopted.Marbles, m)
+	}
+	return adopted
+}
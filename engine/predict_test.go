@@ -0,0 +1,180 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"marblegame/engine"
+	"reflect"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func TestPredictActionMatchesPlayAction(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		action func(g *engine.MarbleGame) engine.Action
+	}{
+		{
+			desc: "placing a marble",
+			action: func(g *engine.MarbleGame) engine.Action {
+				return shoot(g.TurnOrder[g.ActivePlayerIndex].UserToken, 300, 240)
+			},
+		},
+		{
+			desc: "full power into the pack",
+			action: func(g *engine.MarbleGame) engine.Action {
+				return engine.Action{
+					InventorySlot: 0,
+					Pos:           vector2.Vector2{X: 300, Y: 440},
+					Vel:           vector2.Vector2{X: 300, Y: 480},
+					UserToken:     g.TurnOrder[g.ActivePlayerIndex].UserToken,
+				}
+			},
+		},
+		{
+			desc: "bank off the wall",
+			action: func(g *engine.MarbleGame) engine.Action {
+				return engine.Action{
+					InventorySlot: 1,
+					Pos:           vector2.Vector2{X: 100, Y: 100},
+					Vel:           vector2.Vector2{X: 200, Y: 0},
+					UserToken:     g.TurnOrder[g.ActivePlayerIndex].UserToken,
+				}
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 5)
+			for _, position := range [][2]float64{{240, 180}, {360, 220}, {300, 320}} {
+				player := g.TurnOrder[g.ActivePlayerIndex]
+				if err := g.PlayAction(shoot(player.UserToken, position[0], position[1])); err != nil {
+					t.Fatalf("FAIL setting up: %v", err)
+				}
+			}
+
+			action := tC.action(g)
+			before, _ := json.Marshal(g)
+			scoresBefore := map[string]int{}
+			for userToken, player := range g.Players {
+				scoresBefore[userToken] = player.Score
+			}
+
+			prediction, err := g.PredictAction(action, g.Frames[len(g.Frames)-1])
+			if err != nil {
+				t.Fatalf("FAIL predicting: %v", err)
+			}
+
+			after, _ := json.Marshal(g)
+			if string(after) != string(before) {
+				t.Fatalf("FAIL predicting changed the game")
+			}
+
+			if err := g.PlayAction(action); err != nil {
+				t.Fatalf("FAIL playing: %v", err)
+			}
+			if !reflect.DeepEqual(prediction.Frames, g.Frames) {
+				t.Errorf("FAIL predicted frames differ from the played ones: got %d frames, want %d", len(prediction.Frames), len(g.Frames))
+			}
+			for userToken, player := range g.Players {
+				want := player.Score - scoresBefore[userToken]
+				if got := prediction.ScoreChanges[userToken]; got != want {
+					t.Errorf("FAIL score change for %s: got %d, want %d", userToken, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictActionOutOfTurn(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	before, _ := json.Marshal(g)
+
+	prediction, err := g.PredictAction(shoot("player 2", 300, 240), g.Frames[len(g.Frames)-1])
+	if err != nil {
+		t.Fatalf("FAIL predicting out of turn: %v", err)
+	}
+	if got := prediction.ScoreChanges["player 2"]; got != g.Config.ScoringZones[0].BullseyeScore {
+		t.Errorf("FAIL score change: got %d, want %d", got, g.Config.ScoringZones[0].BullseyeScore)
+	}
+
+	after, _ := json.Marshal(g)
+	if string(after) != string(before) {
+		t.Errorf("FAIL predicting changed the game")
+	}
+	if err := g.PlayAction(shoot("player 2", 300, 240)); err == nil {
+		t.Errorf("FAIL playing out of turn should still error")
+	}
+}
+
+func TestPredictActionErrors(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		setup  func(g *engine.MarbleGame)
+		action engine.Action
+	}{
+		{
+			desc:   "spectator",
+			setup:  func(g *engine.MarbleGame) {},
+			action: shoot("spectator", 300, 240),
+		},
+		{
+			desc:  "no inventory slot",
+			setup: func(g *engine.MarbleGame) {},
+			action: engine.Action{
+				InventorySlot: -1,
+				UserToken:     "player 1",
+			},
+		},
+		{
+			desc:  "inventory slot out of range",
+			setup: func(g *engine.MarbleGame) {},
+			action: engine.Action{
+				InventorySlot: 5,
+				UserToken:     "player 1",
+			},
+		},
+		{
+			desc: "game over",
+			setup: func(g *engine.MarbleGame) {
+				g.PlayAction(shoot("player 1", 300, 240))
+				g.PlayAction(shoot("player 2", 50, 50))
+			},
+			action: shoot("player 1", 300, 240),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 1)
+			tC.setup(g)
+			if _, err := g.PredictAction(tC.action, g.Frames[len(g.Frames)-1]); err == nil {
+				t.Errorf("FAIL expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	g := playRandomMatch(t, 3)
+	g.State = engine.GameStateInProgress
+	for _, player := range g.TurnOrder {
+		player.Inventory = engine.NewPlayer(player.UserToken).Inventory
+	}
+	before, _ := json.Marshal(g)
+
+	clone := g.Clone()
+	cloned, _ := json.Marshal(clone)
+	if string(cloned) != string(before) {
+		t.Fatalf("FAIL clone differs from the original")
+	}
+
+	player := clone.TurnOrder[clone.ActivePlayerIndex]
+	if err := clone.PlayAction(shoot(player.UserToken, 300, 240)); err != nil {
+		t.Fatalf("FAIL playing on the clone: %v", err)
+	}
+
+	after, _ := json.Marshal(g)
+	if string(after) != string(before) {
+		t.Errorf("FAIL playing on the clone changed the original")
+	}
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// Everything needed to rebuild a match, a tiny fraction of the size of its frames
+type Replay struct {
+	Config  MarbleGameConfig `json:"config"`
+	Joins   []LoggedJoin     `json:"joins"`
+	Actions []LoggedAction   `json:"actions"`
+}
+
+// Captures the match so far as a Replay
+func (marbleGame *MarbleGame) Replay() Replay {
+	return Replay{
+		Config:  marbleGame.Config,
+		Joins:   append([]LoggedJoin{}, marbleGame.JoinLog...),
+		Actions: append([]LoggedAction{}, marbleGame.ActionLog...),
+	}
+}
+
+// Re-simulates the match from NewMarbleGame, seating players and playing every action, skip and leave in order
+// returns an error if an action is rejected or the scores drift from what was logged
+func (replay Replay) Rebuild() (*MarbleGame, error) {
+	marbleGame := NewMarbleGame()
+	marbleGame.Config = replay.Config
+
+	joinIndex := 0
+	seatPlayers := func(actionsPlayed int) error {
+		for joinIndex < len(replay.Joins) && replay.Joins[joinIndex].JoinedAfter <= actionsPlayed {
+			if _, err := marbleGame.AddPlayer(replay.Joins[joinIndex].UserToken); err != nil {
+				return err
+			}
+			joinIndex++
+		}
+		return nil
+	}
+
+	for i, loggedAction := range replay.Actions {
+		if err := seatPlayers(i); err != nil {
+			return nil, err
+		}
+
+		play := func() error { return marbleGame.PlayAction(loggedAction.Action) }
+		switch {
+		case loggedAction.Skipped:
+			play = marbleGame.SkipTurn
+		case loggedAction.Left:
+			play = func() error { return marbleGame.RemovePlayer(loggedAction.Action.UserToken) }
+		}
+		if err := play(); err != nil {
+			return nil, fmt.Errorf("action %d: %w", i, err)
+		}
+
+		for userToken, score := range loggedAction.Scores {
+			player, exists := marbleGame.Players[userToken]
+			if !exists || player.Score != score {
+				return nil, fmt.Errorf("action %d: Replay diverged from the logged scores", i)
+			}
+		}
+	}
+
+	if err := seatPlayers(len(replay.Actions)); err != nil {
+		return nil, err
+	}
+
+	return marbleGame, nil
+}
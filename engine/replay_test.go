@@ -0,0 +1,100 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"marblegame/engine"
+	"math/rand"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Plays a whole match of random shots, with a third player joining partway through
+func playRandomMatch(t *testing.T, seed int64) *engine.MarbleGame {
+	t.Helper()
+	r := rand.New(rand.NewSource(seed))
+
+	g := engine.NewMarbleGame()
+	g.Config.PlayerLimit = 3
+	g.AddPlayer("player 1")
+	g.AddPlayer("player 2")
+
+	for g.State != engine.GameStateFinished {
+		if len(g.ActionLog) == 3 {
+			g.AddPlayer("player 3")
+		}
+
+		player := g.TurnOrder[g.ActivePlayerIndex]
+		slot := r.Intn(len(player.Inventory))
+		pos, err := g.ClosestPlacement(player, player.Inventory[slot], vector2.Vector2{X: 20 + r.Float64()*560, Y: 20 + r.Float64()*440}, g.Frames[len(g.Frames)-1])
+		if err != nil {
+			t.Fatalf("FAIL placing action %d: %v", len(g.ActionLog), err)
+		}
+		err = g.PlayAction(engine.Action{
+			InventorySlot: slot,
+			Pos:           pos,
+			Vel:           vector2.Vector2{X: r.Float64() * 600, Y: r.Float64() * 480},
+			UserToken:     player.UserToken,
+		})
+		if err != nil {
+			t.Fatalf("FAIL playing action %d: %v", len(g.ActionLog), err)
+		}
+	}
+
+	return g
+}
+
+func TestReplayRebuildsIdenticalFrames(t *testing.T) {
+	for seed := range int64(5) {
+		original := playRandomMatch(t, seed)
+
+		// replays are meant to be stored, so go through JSON like a replay file would
+		marshalled, err := json.Marshal(original.Replay())
+		if err != nil {
+			t.Fatalf("FAIL marshalling replay: %v", err)
+		}
+		var replay engine.Replay
+		if err := json.Unmarshal(marshalled, &replay); err != nil {
+			t.Fatalf("FAIL unmarshalling replay: %v", err)
+		}
+
+		rebuilt, err := replay.Rebuild()
+		if err != nil {
+			t.Fatalf("FAIL seed %d rebuilding replay: %v", seed, err)
+		}
+
+		if len(rebuilt.Frames) != len(original.Frames) {
+			t.Fatalf("FAIL seed %d frame count: got %d, want %d", seed, len(rebuilt.Frames), len(original.Frames))
+		}
+		for i := range original.Frames {
+			want, got := original.Frames[i].Marbles, rebuilt.Frames[i].Marbles
+			if len(got) != len(want) {
+				t.Fatalf("FAIL seed %d frame %d marble count: got %d, want %d", seed, i, len(got), len(want))
+			}
+			for j := range want {
+				if got[j].Pos != want[j].Pos || got[j].Vel != want[j].Vel || got[j].Rot != want[j].Rot ||
+					got[j].Score != want[j].Score || got[j].Owner.UserToken != want[j].Owner.UserToken {
+					t.Fatalf("FAIL seed %d frame %d marble %d: got %+v, want %+v", seed, i, j, got[j], want[j])
+				}
+			}
+		}
+
+		for userToken, player := range original.Players {
+			if rebuilt.Players[userToken].Score != player.Score {
+				t.Errorf("FAIL seed %d %s score: got %d, want %d", seed, userToken, rebuilt.Players[userToken].Score, player.Score)
+			}
+		}
+		if rebuilt.State != engine.GameStateFinished {
+			t.Errorf("FAIL seed %d state: got %s, want %s", seed, rebuilt.State, engine.GameStateFinished)
+		}
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	replay := playRandomMatch(t, 42).Replay()
+	replay.Actions[0].Scores["player 1"] += 1000
+
+	if _, err := replay.Rebuild(); err == nil {
+		t.Errorf("FAIL tampered scores should fail to rebuild")
+	}
+}
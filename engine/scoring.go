@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// An area of the field marbles score in, more the closer they get to its Center.
+// A marble counts as in the zone as soon as it touches it, and how far out it is
+// runs from 0 touching the bullseye (or the Center without one) to 1 at the zone's edge,
+// along the line from the Center through the marble.
+//
+// Zones can overlap, a marble is scored by the first zone in the config's list it touches,
+// so list small zones in front of the big ones they sit on.
+type ScoringZone struct {
+	Shape          ZoneShape         `json:"shape"`
+	Center         vector2.Vector2   `json:"center"`         // where scores are measured from, it has to be inside the zone
+	Radius         float64           `json:"radius"`         // a ring's outer radius
+	Size           vector2.Vector2   `json:"size"`           // a rectangle's width and height, centered on Center
+	Points         []vector2.Vector2 `json:"points"`         // a polygon's corners in order, it must be convex
+	Curve          PointCurve        `json:"curve"`          // how the score falls off towards the edge
+	MaxScore       int               `json:"maxScore"`       // next to the bullseye
+	MinScore       int               `json:"minScore"`       // at the edge
+	Steps          int               `json:"steps"`          // how many rings a stepped curve has
+	Table          []int             `json:"table"`          // a table curve's scores, one per equal band from the middle outwards
+	BullseyeRadius float64           `json:"bullseyeRadius"` // 0 for no bullseye
+	BullseyeScore  int               `json:"bullseyeScore"`
+}
+
+type ZoneShape string
+
+const (
+	ZoneRing      ZoneShape = "ring"
+	ZoneRectangle ZoneShape = "rectangle"
+	ZonePolygon   ZoneShape = "polygon"
+)
+
+type PointCurve string
+
+const (
+	CurveLinear  PointCurve = "linear"  // falls smoothly from MaxScore to MinScore
+	CurveStepped PointCurve = "stepped" // Steps rings, from MaxScore down to MinScore
+	CurveTable   PointCurve = "table"   // whatever the Table says
+)
+
+// Zones fall off linearly unless the level file says otherwise
+func (zone *ScoringZone) UnmarshalJSON(data []byte) error {
+	type plain ScoringZone
+	decoded := plain{Curve: CurveLinear, Points: []vector2.Vector2{}, Table: []int{}}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*zone = ScoringZone(decoded)
+	return nil
+}
+
+// The target every match used before zones were configurable, a ring round the center with a bullseye
+func TargetZone(center vector2.Vector2) ScoringZone {
+	return ScoringZone{
+		Shape:          ZoneRing,
+		Center:         center,
+		Radius:         150,
+		Size:           vector2.Vector2{},
+		Points:         []vector2.Vector2{},
+		Curve:          CurveLinear,
+		MaxScore:       20,
+		MinScore:       5,
+		Table:          []int{},
+		BullseyeRadius: 15,
+		BullseyeScore:  40,
+	}
+}
+
+// What a marble at pos with the radius scores, and whether it's on a bullseye
+// it's scored by the first zone it touches, 0 when it's outside all of them
+func (config *MarbleGameConfig) ScoreAt(pos vector2.Vector2, radius float64) (int, bool) {
+	zone := config.zoneAt(pos, radius)
+	if zone == nil {
+		return 0, false
+	}
+	return zone.score(pos, radius)
+}
+
+func (config *MarbleGameConfig) zoneAt(pos vector2.Vector2, radius float64) *ScoringZone {
+	for i := range config.ScoringZones {
+		if config.ScoringZones[i].touches(pos, radius) {
+			return &config.ScoringZones[i]
+		}
+	}
+	return nil
+}
+
+// Rectangles are polygons that are easier to write down
+func (zone *ScoringZone) outline() []vector2.Vector2 {
+	if zone.Shape == ZoneRectangle {
+		halfWidth, halfHeight := zone.Size.X/2, zone.Size.Y/2
+		return []vector2.Vector2{
+			{X: zone.Center.X - halfWidth, Y: zone.Center.Y - halfHeight},
+			{X: zone.Center.X + halfWidth, Y: zone.Center.Y - halfHeight},
+			{X: zone.Center.X + halfWidth, Y: zone.Center.Y + halfHeight},
+			{X: zone.Center.X - halfWidth, Y: zone.Center.Y + halfHeight},
+		}
+	}
+	return zone.Points
+}
+
+func (zone *ScoringZone) touches(pos vector2.Vector2, radius float64) bool {
+	if zone.Shape == ZoneRing {
+		return pos.Distance(&zone.Center) <= zone.Radius+radius
+	}
+	points := zone.outline()
+	if pointInPolygon(pos, points) {
+		return true
+	}
+	closest, _ := closestPointOnPolygon(pos, points)
+	return pos.Distance(&closest) <= radius
+}
+
+// How far it is from the Center to the edge heading towards the point
+func (zone *ScoringZone) reach(point vector2.Vector2) float64 {
+	if zone.Shape == ZoneRing {
+		return zone.Radius
+	}
+	direction := point.Sub(&zone.Center)
+	reach := math.Inf(1)
+	points := zone.outline()
+	for i := range points {
+		a, b := points[i], points[(i+1)%len(points)]
+		edge := b.Sub(&a)
+		facing := cross(direction, edge)
+		if facing == 0 {
+			continue
+		}
+		// where the line out of the Center crosses this edge, in lengths of direction
+		s := cross(a.Sub(&zone.Center), edge) / facing
+		w := cross(a.Sub(&zone.Center), direction) / facing
+		if s > 0 && w >= 0 && w <= 1 {
+			reach = math.Min(reach, s*direction.Magnitude())
+		}
+	}
+	return reach
+}
+
+func (zone *ScoringZone) score(pos vector2.Vector2, radius float64) (int, bool) {
+	distance := pos.Distance(&zone.Center)
+	if zone.BullseyeRadius > 0 && distance <= zone.BullseyeRadius+radius {
+		return zone.BullseyeScore, true
+	}
+
+	out := 0.0
+	if distance > 0 {
+		out = (distance - radius - zone.BullseyeRadius) / (zone.reach(pos) - zone.BullseyeRadius)
+		out = math.Min(math.Max(out, 0), 1)
+	}
+
+	switch zone.Curve {
+	case CurveStepped:
+		if zone.Steps == 1 {
+			return zone.MaxScore, false
+		}
+		step := min(int(out*float64(zone.Steps)), zone.Steps-1)
+		drop := float64(step*(zone.MaxScore-zone.MinScore)) / float64(zone.Steps-1)
+		return zone.MaxScore - int(math.Round(drop)), false
+	case CurveTable:
+		return zone.Table[min(int(out*float64(len(zone.Table))), len(zone.Table)-1)], false
+	}
+	return min(zone.MinScore+int((1-out)*float64(zone.MaxScore-zone.MinScore+1)), zone.MaxScore), false
+}
+
+func (zone *ScoringZone) validate() error {
+	switch zone.Shape {
+	case ZoneRing:
+		if zone.Radius <= 0 {
+			return errors.New("Rings need a radius")
+		}
+	case ZoneRectangle:
+		if zone.Size.X <= 0 || zone.Size.Y <= 0 {
+			return errors.New("Rectangles need a width and height")
+		}
+	case ZonePolygon:
+		if len(zone.Points) < 3 {
+			return errors.New("Zone polygons need at least three corners")
+		}
+		if !isConvex(zone.Points) {
+			return errors.New("Zone polygons must be convex")
+		}
+		if !pointInPolygon(zone.Center, zone.Points) {
+			return errors.New("A zone's center must be inside it")
+		}
+	default:
+		return errors.New("Unknown zone shape")
+	}
+
+	// the bullseye has to leave some of the zone round it
+	inside := zone.Radius
+	if zone.Shape != ZoneRing {
+		closest, _ := closestPointOnPolygon(zone.Center, zone.outline())
+		inside = zone.Center.Distance(&closest)
+	}
+	if zone.BullseyeRadius < 0 || zone.BullseyeRadius >= inside {
+		return errors.New("The bullseye must fit inside its zone")
+	}
+
+	switch zone.Curve {
+	case CurveLinear, CurveStepped:
+		if zone.MinScore > zone.MaxScore {
+			return errors.New("A zone's MinScore can't be more than its MaxScore")
+		}
+		if zone.Curve == CurveStepped && zone.Steps < 1 {
+			return errors.New("Stepped zones need at least one step")
+		}
+	case CurveTable:
+		if len(zone.Table) == 0 {
+			return errors.New("Table zones need some scores")
+		}
+	default:
+		return errors.New("Unknown point curve")
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+var fieldCenter = vector2.Vector2{X: 300, Y: 240}
+
+// scores from 10 in the middle down to 1 at the edge
+func linearZone(shape engine.ZoneShape) engine.ScoringZone {
+	return engine.ScoringZone{
+		Shape:  shape,
+		Center: fieldCenter,
+		Radius: 100,
+		Size:   vector2.Vector2{X: 200, Y: 100},
+		// a diamond reaching 100 out to each side
+		Points:   []vector2.Vector2{{X: 300, Y: 140}, {X: 400, Y: 240}, {X: 300, Y: 340}, {X: 200, Y: 240}},
+		Curve:    engine.CurveLinear,
+		MaxScore: 10,
+		MinScore: 1,
+	}
+}
+
+func scoreAt(zones []engine.ScoringZone, pos vector2.Vector2, radius float64) (int, bool) {
+	config := engine.NewMarbleGame().Config
+	config.ScoringZones = zones
+	return config.ScoreAt(pos, radius)
+}
+
+func TestZoneShapes(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		shape  engine.ZoneShape
+		pos    vector2.Vector2
+		radius float64
+		want   int
+	}{
+		{desc: "Ring center", shape: engine.ZoneRing, pos: fieldCenter, want: 10},
+		{desc: "Ring halfway", shape: engine.ZoneRing, pos: vector2.Vector2{X: 350, Y: 240}, want: 6},
+		{desc: "Outside the ring", shape: engine.ZoneRing, pos: vector2.Vector2{X: 410, Y: 240}, want: 0},
+		{desc: "Touching the ring", shape: engine.ZoneRing, pos: vector2.Vector2{X: 410, Y: 240}, radius: 15, want: 1},
+		{desc: "Rectangle halfway along", shape: engine.ZoneRectangle, pos: vector2.Vector2{X: 350, Y: 240}, want: 6},
+		{desc: "Rectangle halfway across", shape: engine.ZoneRectangle, pos: vector2.Vector2{X: 300, Y: 265}, want: 6},
+		{desc: "Rectangle halfway to a corner", shape: engine.ZoneRectangle, pos: vector2.Vector2{X: 350, Y: 265}, want: 6},
+		{desc: "Past the rectangle's short side", shape: engine.ZoneRectangle, pos: vector2.Vector2{X: 300, Y: 300}, want: 0},
+		{desc: "Touching the rectangle", shape: engine.ZoneRectangle, pos: vector2.Vector2{X: 401, Y: 240}, radius: 5, want: 1},
+		{desc: "Polygon halfway to a corner", shape: engine.ZonePolygon, pos: vector2.Vector2{X: 350, Y: 240}, want: 6},
+		{desc: "Polygon halfway to an edge", shape: engine.ZonePolygon, pos: vector2.Vector2{X: 325, Y: 215}, want: 6},
+		{desc: "Outside the polygon", shape: engine.ZonePolygon, pos: vector2.Vector2{X: 360, Y: 180}, want: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, _ := scoreAt([]engine.ScoringZone{linearZone(tC.shape)}, tC.pos, tC.radius)
+			if got != tC.want {
+				t.Errorf("FAIL %s: got %d, want %d", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestPointCurves(t *testing.T) {
+	// rings of radius 100, marbles are measured along the x axis out of the middle
+	linear := engine.ScoringZone{Shape: engine.ZoneRing, Center: fieldCenter, Radius: 100, Curve: engine.CurveLinear, MaxScore: 20, MinScore: 5}
+	stepped := linear
+	stepped.Curve, stepped.Steps = engine.CurveStepped, 4
+	oneStep := stepped
+	oneStep.Steps = 1
+	table := linear
+	table.Curve, table.Table = engine.CurveTable, []int{9, 6, 3}
+	bullseye := linear
+	bullseye.BullseyeRadius, bullseye.BullseyeScore = 10, 40
+
+	testCases := []struct {
+		desc         string
+		zone         engine.ScoringZone
+		out          float64
+		radius       float64
+		want         int
+		wantBullseye bool
+	}{
+		{desc: "Linear middle", zone: linear, out: 0, want: 20},
+		{desc: "Linear halfway", zone: linear, out: 50, want: 13},
+		{desc: "Linear edge", zone: linear, out: 100, want: 5},
+		{desc: "First step", zone: stepped, out: 10, want: 20},
+		{desc: "Second step", zone: stepped, out: 30, want: 15},
+		{desc: "Third step", zone: stepped, out: 60, want: 10},
+		{desc: "Last step", zone: stepped, out: 99, want: 5},
+		{desc: "Edge is the last step", zone: stepped, out: 100, want: 5},
+		{desc: "A single step is all MaxScore", zone: oneStep, out: 90, want: 20},
+		{desc: "First band of the table", zone: table, out: 10, want: 9},
+		{desc: "Middle band of the table", zone: table, out: 40, want: 6},
+		{desc: "Last band of the table", zone: table, out: 80, want: 3},
+		{desc: "On the bullseye", zone: bullseye, out: 0, want: 40, wantBullseye: true},
+		{desc: "Marble touching the bullseye", zone: bullseye, out: 12, radius: 5, want: 40, wantBullseye: true},
+		{desc: "Just off the bullseye, measured from its edge", zone: bullseye, out: 20, want: 19},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, gotBullseye := scoreAt([]engine.ScoringZone{tC.zone}, vector2.Vector2{X: 300 + tC.out, Y: 240}, tC.radius)
+			if got != tC.want || gotBullseye != tC.wantBullseye {
+				t.Errorf("FAIL %s: got %d (bullseye %v), want %d (bullseye %v)", tC.desc, got, gotBullseye, tC.want, tC.wantBullseye)
+			}
+		})
+	}
+}
+
+func TestDefaultTargetScoresLikeBefore(t *testing.T) {
+	small := engine.MarbleTypes[2]
+	testCases := []struct {
+		desc string
+		out  float64
+		want int
+	}{
+		{desc: "Touching the bullseye", out: 30, want: 40},
+		{desc: "Between", out: 100, want: 12},
+		{desc: "Touching the edge", out: 165, want: 5},
+		{desc: "Outside", out: 166, want: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			config := engine.NewMarbleGame().Config
+			if got, _ := config.ScoreAt(vector2.Vector2{X: 300, Y: 240 + tC.out}, small.Radius); got != tC.want {
+				t.Errorf("FAIL %s: got %d, want %d", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestOverlappingZonesFirstListedWins(t *testing.T) {
+	inner := engine.ScoringZone{Shape: engine.ZoneRing, Center: fieldCenter, Radius: 20, Curve: engine.CurveTable, Table: []int{50}}
+	outer := engine.ScoringZone{Shape: engine.ZoneRing, Center: fieldCenter, Radius: 100, Curve: engine.CurveTable, Table: []int{1}}
+	testCases := []struct {
+		desc   string
+		zones  []engine.ScoringZone
+		pos    vector2.Vector2
+		radius float64
+		want   int
+	}{
+		{desc: "Inner zone listed first", zones: []engine.ScoringZone{inner, outer}, pos: fieldCenter, want: 50},
+		{desc: "Only in the outer zone", zones: []engine.ScoringZone{inner, outer}, pos: vector2.Vector2{X: 330, Y: 240}, want: 1},
+		{desc: "Touching the inner zone is enough", zones: []engine.ScoringZone{inner, outer}, pos: vector2.Vector2{X: 325, Y: 240}, radius: 10, want: 50},
+		{desc: "Outer zone listed first hides the inner", zones: []engine.ScoringZone{outer, inner}, pos: fieldCenter, want: 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if got, _ := scoreAt(tC.zones, tC.pos, tC.radius); got != tC.want {
+				t.Errorf("FAIL %s: got %d, want %d", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestMarblesOutsideEveryZoneAreRemoved(t *testing.T) {
+	g := engine.NewMarbleGame()
+	left := linearZone(engine.ZoneRing)
+	left.Center = vector2.Vector2{X: 150, Y: 240}
+	right := linearZone(engine.ZoneRectangle)
+	right.Center = vector2.Vector2{X: 450, Y: 240}
+	g.Config.ScoringZones = []engine.ScoringZone{left, right}
+	small := engine.MarbleTypes[2]
+	frame := engine.MarbleGameFrame{Marbles: []engine.Marble{
+		movingMarble(small, 150, 240, 0),
+		movingMarble(small, 300, 240, 0), // in the gap between them
+		movingMarble(small, 450, 240, 0),
+	}}
+
+	frame.RemoveMarblesOutsideScoringZone(g)
+
+	if len(frame.Marbles) != 2 || frame.Marbles[0].Pos.X != 150 || frame.Marbles[1].Pos.X != 450 {
+		t.Errorf("FAIL marbles left: got %v", frame.Marbles)
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"math"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// Spin a player puts on a shot, on top of the marble's natural roll.
+// Side spin bends its path, top spin makes it follow through after hitting something and back spin draws it back,
+// like english on a billiard ball. Hitting things never changes a marble's spin, only its velocity.
+const (
+	// radians per time unit a full side spin turns a marble's path
+	maxSideSpin = 1.0
+	// share of side spin kept every 0.1 time units
+	sideSpinPerTenth = 0.9
+	// extra roll a full top spin gives, as a share of the launch speed
+	maxTopSpin = 1.75
+	// how fast the ground grips a marble's extra roll, most of it is used up within 1/spinGrip time units
+	spinGrip = 1.0
+	// a solid ball turns 2/7 of its extra roll into speed as the ground grips it
+	rollShare = 2.0 / 7
+)
+
+// Keeps the spin on an action to what a player can put on a shot, from -1 to 1
+func clampSpin(spin float64) float64 {
+	return math.Max(-1, math.Min(spin, 1))
+}
+
+// The spin a marble leaves the hand with, action's spin has to be clamped already
+func (marble *Marble) addSpin(action Action) {
+	marble.SideSpin = action.SideSpin * maxSideSpin
+	marble.TopSpin = *marble.Vel.MulScalar(action.TopSpin * maxTopSpin)
+}
+
+// Applies dt worth of spin, side spin turns the marble and the ground turns some of its extra roll into speed
+func (marble *Marble) applySpin(dt float64) {
+	if marble.SideSpin != 0 {
+		sin, cos := math.Sincos(marble.SideSpin * dt)
+		marble.Vel = rotate(marble.Vel, sin, cos)
+		marble.TopSpin = rotate(marble.TopSpin, sin, cos)
+		marble.SideSpin *= math.Pow(sideSpinPerTenth, dt/0.1)
+	}
+
+	grip := 1 - math.Exp(-spinGrip*dt)
+	marble.Vel = *marble.Vel.Add(marble.TopSpin.MulScalar(rollShare * grip))
+	marble.TopSpin = *marble.TopSpin.MulScalar(1 - grip)
+}
+
+// Whether the marble's spin is too little to get it moving again
+func (marble *Marble) spinSpent(restThreshold float64) bool {
+	return marble.TopSpin.Magnitude()*rollShare < restThreshold
+}
+
+func (marble *Marble) stopSpinning() {
+	marble.SideSpin = 0
+	marble.TopSpin = vector2.Vector2{}
+}
+
+// Turns v by the angle with the given sine and cosine, clockwise on screen for positive angles
+func rotate(v vector2.Vector2, sin, cos float64) vector2.Vector2 {
+	return vector2.Vector2{X: v.X*cos - v.Y*sin, Y: v.X*sin + v.Y*cos}
+}
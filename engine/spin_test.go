@@ -0,0 +1,120 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"math"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+// the marble player 1 launches from (300, 240) towards +X with the given spin
+func spunMarble(t *testing.T, sideSpin, topSpin float64) engine.Marble {
+	t.Helper()
+	g := newTwoPlayerGame(t, 1)
+	action := shoot("player 1", 300, 240)
+	action.Vel = vector2.Vector2{X: 200, Y: 240}
+	action.SideSpin, action.TopSpin = sideSpin, topSpin
+
+	frame, err := g.ValidateGameAction(action, g.Frames[len(g.Frames)-1])
+	if err != nil {
+		t.Fatalf("FAIL validating: %v", err)
+	}
+	return frame.Marbles[0]
+}
+
+func TestSpinIsClamped(t *testing.T) {
+	full := spunMarble(t, 1, -1)
+	testCases := []struct {
+		desc     string
+		sideSpin float64
+		topSpin  float64
+		want     engine.Marble
+	}{
+		{desc: "No spin", sideSpin: 0, topSpin: 0, want: engine.Marble{}},
+		{desc: "Full spin", sideSpin: 1, topSpin: -1, want: full},
+		{desc: "Too much spin", sideSpin: 5, topSpin: -3, want: full},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := spunMarble(t, tC.sideSpin, tC.topSpin)
+			if got.SideSpin != tC.want.SideSpin || got.TopSpin != tC.want.TopSpin {
+				t.Errorf("FAIL %s: got %v and %v, want %v and %v", tC.desc, got.SideSpin, got.TopSpin, tC.want.SideSpin, tC.want.TopSpin)
+			}
+		})
+	}
+
+	if full.SideSpin <= 0 || full.TopSpin.Dot(&full.Vel) >= 0 {
+		t.Errorf("FAIL full spin: got side spin %v and top spin %v for a marble with Vel %v", full.SideSpin, full.TopSpin, full.Vel)
+	}
+}
+
+func TestSideSpinBends(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	testCases := []struct {
+		desc     string
+		sideSpin float64
+		want     int // which way it ends up off the line it was shot along, +1 is down the screen
+	}{
+		{desc: "Right", sideSpin: 1, want: 1},
+		{desc: "Left", sideSpin: -1, want: -1},
+		{desc: "Straight", sideSpin: 0, want: 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			marble := movingMarble(plain, 100, 240, 100)
+			marble.SideSpin = tC.sideSpin
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{marble}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			final := frames[len(frames)-1].Marbles[0]
+			got := 0
+			switch {
+			case final.Pos.Y > 240:
+				got = 1
+			case final.Pos.Y < 240:
+				got = -1
+			}
+			if got != tC.want {
+				t.Errorf("FAIL %s: ended up at %v", tC.desc, final.Pos)
+			}
+			if final.SideSpin != 0 {
+				t.Errorf("FAIL %s: still spinning at rest, %v", tC.desc, final.SideSpin)
+			}
+		})
+	}
+}
+
+func TestFollowThroughAndDraw(t *testing.T) {
+	plain := engine.MarbleTypes[0]
+	testCases := []struct {
+		desc    string
+		topSpin float64 // extra roll as a share of its speed
+		check   func(x float64) bool
+	}{
+		{desc: "Stun shot stops dead", topSpin: 0, check: func(x float64) bool { return math.Abs(x-140) < 1e-6 }},
+		{desc: "Top spin follows through", topSpin: 1.5, check: func(x float64) bool { return x > 150 }},
+		{desc: "Back spin draws back", topSpin: -1.5, check: func(x float64) bool { return x < 130 }},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newPhysicsGame(0.1, 4)
+			// right up against the marble it hits head on
+			shooter := movingMarble(plain, 140, 240, 150)
+			shooter.TopSpin = *shooter.Vel.MulScalar(tC.topSpin)
+			frame := engine.MarbleGameFrame{Marbles: []engine.Marble{shooter, movingMarble(plain, 200, 240, 0)}}
+
+			frames := g.GenerateNewGameFrames(&engine.Action{}, &frame)
+
+			final := frames[len(frames)-1].Marbles
+			if !tC.check(final[0].Pos.X) {
+				t.Errorf("FAIL %s: shooter ended up at %v", tC.desc, final[0].Pos)
+			}
+			if final[1].Pos.X <= 200 {
+				t.Errorf("FAIL %s: target should have been knocked on, got %v", tC.desc, final[1].Pos)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import "time"
+
+// A player can take back a shot they regret, rewinding the match to just before it, and every shot played since.
+// Each player gets Config.TakebacksPerMatch of them, asking everyone else first is up to whoever serves the match.
+// Only the last TakebackHistory shots can be reached, and seats changing can't be undone,
+// so a player joining or leaving forgets them all.
+
+// How many shots back a takeback can reach
+const TakebackHistory = 8
+
+// The match as it was just before a shot
+type turnSnapshot struct {
+	userToken string          // who took the shot
+	game      *MarbleGame     // players, turn order and ends, see sandbox
+	frame     MarbleGameFrame // the settled field, owned by game's players
+	actions   int             // how many actions were logged
+}
+
+func (marbleGame *MarbleGame) snapshot(userToken string) turnSnapshot {
+	game := marbleGame.sandbox()
+	return turnSnapshot{
+		userToken: userToken,
+		game:      game,
+		frame:     game.adoptFrame(marbleGame.Frames[len(marbleGame.Frames)-1]),
+		actions:   len(marbleGame.ActionLog),
+	}
+}
+
+func (marbleGame *MarbleGame) remember(snapshot turnSnapshot) {
+	marbleGame.history = append(marbleGame.history, snapshot)
+	if len(marbleGame.history) > TakebackHistory {
+		marbleGame.history = marbleGame.history[len(marbleGame.history)-TakebackHistory:]
+	}
+}
+
+// Checks the player has a shot they can take back, the error is an ActionError saying why not
+func (marbleGame *MarbleGame) CanTakeBack(userToken string) error {
+	_, err := marbleGame.takebackPoint(userToken)
+	return err
+}
+
+// The index into history from before the player's latest shot
+func (marbleGame *MarbleGame) takebackPoint(userToken string) (int, error) {
+	if marbleGame.State == GameStateFinished {
+		return -1, actionError(CodeGameOver, "Game is over")
+	}
+	player, exists := marbleGame.Players[userToken]
+	if !exists || player.Left {
+		return -1, actionError(CodeInvalidPlayer, "Invalid Player")
+	}
+	if player.Takebacks >= marbleGame.Config.TakebacksPerMatch {
+		return -1, actionError(CodeTakebackLimit, "No takebacks left")
+	}
+	for i := len(marbleGame.history) - 1; i >= 0; i-- {
+		if marbleGame.history[i].userToken == userToken {
+			return i, nil
+		}
+	}
+	return -1, actionError(CodeNothingToTakeBack, "No shot of yours to take back")
+}
+
+// Rewinds the match to just before the player's latest shot: the field, scores, everyone's inventory and whose turn it is
+// the turn clock is stopped, and the shots are dropped from the ActionLog so replays never see them
+func (marbleGame *MarbleGame) TakeBack(userToken string) error {
+	i, err := marbleGame.takebackPoint(userToken)
+	if err != nil {
+		return err
+	}
+	snapshot := marbleGame.history[i]
+	restored := snapshot.game
+
+	// being away isn't part of the shot, and neither are the takebacks themselves
+	for token, player := range marbleGame.Players {
+		if before, exists := restored.Players[token]; exists {
+			before.Takebacks = player.Takebacks
+			before.MissedTurns = player.MissedTurns
+			before.ShouldSkipMyTurns = player.ShouldSkipMyTurns
+		}
+	}
+	restored.Players[userToken].Takebacks++
+
+	marbleGame.Players = restored.Players
+	marbleGame.TurnOrder = restored.TurnOrder
+	marbleGame.ActivePlayerIndex = restored.ActivePlayerIndex
+	marbleGame.State = restored.State
+	marbleGame.NextMarbleId = restored.NextMarbleId
+	marbleGame.Ends = restored.Ends
+	marbleGame.Hammer = restored.Hammer
+	marbleGame.Frames = []MarbleGameFrame{snapshot.frame}
+	// capped, so logging the next action can't write over entries a Replay may still be holding
+	marbleGame.ActionLog = marbleGame.ActionLog[:snapshot.actions:snapshot.actions]
+	marbleGame.TurnDeadline = time.Time{}
+	marbleGame.history = marbleGame.history[:i]
+	return nil
+}
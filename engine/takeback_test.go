@@ -0,0 +1,231 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"reflect"
+	"testing"
+)
+
+func TestTakeBackRestoresTheTurn(t *testing.T) {
+	g := newTwoPlayerGame(t, 3)
+	if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+		t.Fatalf("FAIL player 1 shot: %v", err)
+	}
+
+	before := g.Clone()
+	if err := g.PlayAction(shootNear(t, g, 320, 260)); err != nil {
+		t.Fatalf("FAIL player 2 shot: %v", err)
+	}
+	if err := g.TakeBack("player 2"); err != nil {
+		t.Fatalf("FAIL taking back: %v", err)
+	}
+
+	if g.ActivePlayerIndex != before.ActivePlayerIndex {
+		t.Errorf("FAIL active player: got %d, want %d", g.ActivePlayerIndex, before.ActivePlayerIndex)
+	}
+	if len(g.ActionLog) != len(before.ActionLog) {
+		t.Errorf("FAIL action log: got %d, want %d", len(g.ActionLog), len(before.ActionLog))
+	}
+	want, got := before.Frames[len(before.Frames)-1].Marbles, g.Frames[len(g.Frames)-1].Marbles
+	if len(got) != len(want) {
+		t.Fatalf("FAIL marble count: got %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Pos != want[i].Pos || got[i].Owner != g.Players[want[i].Owner.UserToken] {
+			t.Errorf("FAIL marble %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	for userToken, player := range before.Players {
+		if g.Players[userToken].Score != player.Score {
+			t.Errorf("FAIL %s score: got %d, want %d", userToken, g.Players[userToken].Score, player.Score)
+		}
+		if !reflect.DeepEqual(g.Players[userToken].Inventory, player.Inventory) {
+			t.Errorf("FAIL %s inventory: got %v, want %v", userToken, g.Players[userToken].Inventory, player.Inventory)
+		}
+	}
+	if g.Players["player 2"].Takebacks != 1 {
+		t.Errorf("FAIL takebacks used: got %d, want 1", g.Players["player 2"].Takebacks)
+	}
+
+	// the shot can be played again
+	if err := g.PlayAction(shootNear(t, g, 200, 200)); err != nil {
+		t.Errorf("FAIL replaying the shot: %v", err)
+	}
+}
+
+func TestTakeBackRewindsLaterShots(t *testing.T) {
+	g := newTwoPlayerGame(t, 3)
+	if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+		t.Fatalf("FAIL player 1 shot: %v", err)
+	}
+	if err := g.PlayAction(shootNear(t, g, 320, 260)); err != nil {
+		t.Fatalf("FAIL player 2 shot: %v", err)
+	}
+
+	if err := g.TakeBack("player 1"); err != nil {
+		t.Fatalf("FAIL taking back: %v", err)
+	}
+	if len(g.ActionLog) != 0 {
+		t.Errorf("FAIL action log: got %d, want 0", len(g.ActionLog))
+	}
+	if marbles := len(g.Frames[len(g.Frames)-1].Marbles); marbles != 0 {
+		t.Errorf("FAIL marbles on the field: got %d, want 0", marbles)
+	}
+	if active := g.TurnOrder[g.ActivePlayerIndex].UserToken; active != "player 1" {
+		t.Errorf("FAIL active player: got %s, want player 1", active)
+	}
+}
+
+func TestTakeBackErrors(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		setup     func(t *testing.T, g *engine.MarbleGame)
+		userToken string
+		want      engine.ActionErrorCode
+	}{
+		{
+			desc:      "no shots yet",
+			setup:     func(t *testing.T, g *engine.MarbleGame) {},
+			userToken: "player 1",
+			want:      engine.CodeNothingToTakeBack,
+		},
+		{
+			desc: "only the opponent shot",
+			setup: func(t *testing.T, g *engine.MarbleGame) {
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+			},
+			userToken: "player 2",
+			want:      engine.CodeNothingToTakeBack,
+		},
+		{
+			desc:      "not in the match",
+			setup:     func(t *testing.T, g *engine.MarbleGame) {},
+			userToken: "nobody",
+			want:      engine.CodeInvalidPlayer,
+		},
+		{
+			desc: "takebacks turned off",
+			setup: func(t *testing.T, g *engine.MarbleGame) {
+				g.Config.TakebacksPerMatch = 0
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+			},
+			userToken: "player 1",
+			want:      engine.CodeTakebackLimit,
+		},
+		{
+			desc: "already used",
+			setup: func(t *testing.T, g *engine.MarbleGame) {
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+				if err := g.TakeBack("player 1"); err != nil {
+					t.Fatalf("FAIL first takeback: %v", err)
+				}
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+			},
+			userToken: "player 1",
+			want:      engine.CodeTakebackLimit,
+		},
+		{
+			desc: "someone joined since",
+			setup: func(t *testing.T, g *engine.MarbleGame) {
+				g.Config.PlayerLimit = 3
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+				if _, err := g.AddPlayer("player 3"); err != nil {
+					t.Fatalf("FAIL joining: %v", err)
+				}
+			},
+			userToken: "player 1",
+			want:      engine.CodeNothingToTakeBack,
+		},
+		{
+			desc: "game over",
+			setup: func(t *testing.T, g *engine.MarbleGame) {
+				if err := g.PlayAction(shootNear(t, g, 300, 240)); err != nil {
+					t.Fatalf("FAIL shot: %v", err)
+				}
+				g.State = engine.GameStateFinished
+			},
+			userToken: "player 1",
+			want:      engine.CodeGameOver,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 3)
+			tC.setup(t, g)
+			if got := engine.ActionErrorCodeOf(g.CanTakeBack(tC.userToken)); got != tC.want {
+				t.Errorf("FAIL %s: got %v, want %v", tC.desc, got, tC.want)
+			}
+			if got := engine.ActionErrorCodeOf(g.TakeBack(tC.userToken)); got != tC.want {
+				t.Errorf("FAIL %s taking back: got %v, want %v", tC.desc, got, tC.want)
+			}
+		})
+	}
+}
+
+func TestTakeBackHistoryIsBounded(t *testing.T) {
+	g := newTwoPlayerGame(t, engine.TakebackHistory+2)
+	g.Config.TakebacksPerMatch = engine.TakebackHistory
+	// the first two shots fall out of the history
+	for i := range engine.TakebackHistory + 2 {
+		if err := g.PlayAction(shootNear(t, g, 100+float64(i%6)*80, 100+float64(i/6)*80)); err != nil {
+			t.Fatalf("FAIL shot %d: %v", i, err)
+		}
+	}
+	for i := range engine.TakebackHistory / 2 {
+		if err := g.TakeBack("player 1"); err != nil {
+			t.Fatalf("FAIL takeback %d: %v", i, err)
+		}
+	}
+	if len(g.ActionLog) != 2 {
+		t.Errorf("FAIL action log: got %d, want 2", len(g.ActionLog))
+	}
+	if got := engine.ActionErrorCodeOf(g.CanTakeBack("player 1")); got != engine.CodeNothingToTakeBack {
+		t.Errorf("FAIL shot past the history: got %v, want %v", got, engine.CodeNothingToTakeBack)
+	}
+}
+
+func TestReplayAfterTakeBack(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	for _, pos := range [][2]float64{{300, 240}, {320, 300}} {
+		if err := g.PlayAction(shootNear(t, g, pos[0], pos[1])); err != nil {
+			t.Fatalf("FAIL shot: %v", err)
+		}
+	}
+	if err := g.TakeBack("player 2"); err != nil {
+		t.Fatalf("FAIL taking back: %v", err)
+	}
+	for _, pos := range [][2]float64{{200, 200}, {360, 200}, {260, 320}} {
+		if err := g.PlayAction(shootNear(t, g, pos[0], pos[1])); err != nil {
+			t.Fatalf("FAIL shot: %v", err)
+		}
+	}
+
+	rebuilt, err := g.Replay().Rebuild()
+	if err != nil {
+		t.Fatalf("FAIL rebuilding: %v", err)
+	}
+	for userToken, player := range g.Players {
+		if rebuilt.Players[userToken].Score != player.Score {
+			t.Errorf("FAIL %s score: got %d, want %d", userToken, rebuilt.Players[userToken].Score, player.Score)
+		}
+	}
+	want, got := g.Frames[len(g.Frames)-1].Marbles, rebuilt.Frames[len(rebuilt.Frames)-1].Marbles
+	if len(got) != len(want) {
+		t.Fatalf("FAIL marble count: got %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Pos != want[i].Pos {
+			t.Errorf("FAIL marble %d: got %v, want %v", i, got[i].Pos, want[i].Pos)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// The turn clock keeps a player who walks away from holding up the match.
+// Whoever runs the game starts the clock on each turn with StartTurnClock, and skips the turn with SkipTurn once it
+// runs out. A player who misses Config.MissedTurnsToAway turns in a row is marked ShouldSkipMyTurns, and
+// SkipAwayPlayers skips them as soon as their turn comes round, until they're back.
+// The engine never reads the time itself, so it can be driven by a fake clock.
+
+// Starts the active player's clock from now, or stops it when the config has no clock or the match is over
+func (marbleGame *MarbleGame) StartTurnClock(now time.Time) {
+	if marbleGame.Config.TurnTime <= 0 || marbleGame.State == GameStateFinished || len(marbleGame.TurnOrder) == 0 {
+		marbleGame.TurnDeadline = time.Time{}
+		return
+	}
+	marbleGame.TurnDeadline = now.Add(time.Duration(marbleGame.Config.TurnTime * float64(time.Second)))
+}
+
+// Whether the active player's clock has run out by now
+func (marbleGame *MarbleGame) TurnTimedOut(now time.Time) bool {
+	return !marbleGame.TurnDeadline.IsZero() && !now.Before(marbleGame.TurnDeadline)
+}
+
+// Passes the active player's turn, they forfeit the marble they would have thrown
+// it counts as a missed turn, and is logged so a Replay skips it too
+func (marbleGame *MarbleGame) SkipTurn() error {
+	if marbleGame.State == GameStateFinished {
+		return errors.New("Game is over")
+	}
+	if len(marbleGame.TurnOrder) == 0 {
+		return errors.New("No one to skip")
+	}
+
+	player := marbleGame.TurnOrder[marbleGame.ActivePlayerIndex]
+	player.MissedTurns++
+	if away := marbleGame.Config.MissedTurnsToAway; away > 0 && player.MissedTurns >= away {
+		player.ShouldSkipMyTurns = true
+	}
+	if slot := marbleGame.forfeitSlot(player); slot != -1 {
+		player.Inventory = slices.Delete(player.Inventory, slot, slot+1)
+	}
+
+	if marbleGame.State == GameStateWaiting {
+		marbleGame.State = GameStateInProgress
+	}
+
+	// nothing moves, but the skip can still be the last turn of an end
+	frame := marbleGame.adoptFrame(marbleGame.Frames[len(marbleGame.Frames)-1])
+	marbleGame.Mode().EndTurn(marbleGame, &frame)
+	marbleGame.Frames = []MarbleGameFrame{frame}
+
+	marbleGame.ActionLog = append(marbleGame.ActionLog, LoggedAction{
+		Action:  Action{UserToken: player.UserToken},
+		Scores:  marbleGame.scores(),
+		Skipped: true,
+	})
+
+	if marbleGame.IsGameOver() {
+		marbleGame.State = GameStateFinished
+		marbleGame.TurnDeadline = time.Time{}
+		return nil
+	}
+
+	marbleGame.AdvanceTurn()
+
+	return nil
+}
+
+// Skips the active player for as long as they're away, returns how many turns were skipped
+// every skip takes a marble away, so this stops once someone's there or the match is over
+func (marbleGame *MarbleGame) SkipAwayPlayers() int {
+	skipped := 0
+	for marbleGame.State != GameStateFinished && len(marbleGame.TurnOrder) > 0 && marbleGame.TurnOrder[marbleGame.ActivePlayerIndex].ShouldSkipMyTurns {
+		if err := marbleGame.SkipTurn(); err != nil {
+			break
+		}
+		skipped++
+	}
+	return skipped
+}
+
+// Marks the player as back, so their turns aren't skipped any more
+func (marbleGame *MarbleGame) PlayerIsBack(userToken string) {
+	player, exists := marbleGame.Players[userToken]
+	if !exists {
+		return
+	}
+	player.MissedTurns = 0
+	player.ShouldSkipMyTurns = false
+}
+
+// The first inventory slot the mode would let the player throw, -1 when there's none
+func (marbleGame *MarbleGame) forfeitSlot(player *Player) int {
+	mode := marbleGame.Mode()
+	for slot := range player.Inventory {
+		action := Action{InventorySlot: slot, UserToken: player.UserToken}
+		if mode.ValidateAction(marbleGame, action, player) == nil {
+			return slot
+		}
+	}
+	return -1
+}
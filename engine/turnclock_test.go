@@ -0,0 +1,160 @@
+package engine_test
+
+import (
+	"marblegame/engine"
+	"testing"
+	"time"
+)
+
+func TestTurnClock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		desc      string
+		turnTime  float64
+		finished  bool
+		wantAfter time.Duration // zero for no deadline
+	}{
+		{desc: "No clock", turnTime: 0},
+		{desc: "Thirty seconds", turnTime: 30, wantAfter: 30 * time.Second},
+		{desc: "Half a second", turnTime: 0.5, wantAfter: 500 * time.Millisecond},
+		{desc: "Finished match", turnTime: 30, finished: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 1)
+			g.Config.TurnTime = tC.turnTime
+			if tC.finished {
+				g.State = engine.GameStateFinished
+			}
+
+			g.StartTurnClock(start)
+
+			if tC.wantAfter == 0 {
+				if !g.TurnDeadline.IsZero() || g.TurnTimedOut(start.Add(time.Hour)) {
+					t.Errorf("FAIL %s: got a deadline of %v, want none", tC.desc, g.TurnDeadline)
+				}
+				return
+			}
+			if got := g.TurnDeadline.Sub(start); got != tC.wantAfter {
+				t.Errorf("FAIL %s deadline: got %v after the start, want %v", tC.desc, got, tC.wantAfter)
+			}
+			if g.TurnTimedOut(start.Add(tC.wantAfter - time.Millisecond)) {
+				t.Errorf("FAIL %s: timed out before the deadline", tC.desc)
+			}
+			if !g.TurnTimedOut(start.Add(tC.wantAfter)) {
+				t.Errorf("FAIL %s: not timed out at the deadline", tC.desc)
+			}
+		})
+	}
+}
+
+func TestSkipTurn(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	g.Config.MissedTurnsToAway = 2
+
+	if err := g.SkipTurn(); err != nil {
+		t.Fatalf("FAIL skipping: %v", err)
+	}
+
+	player1 := g.Players["player 1"]
+	if len(player1.Inventory) != 1 {
+		t.Errorf("FAIL skipped player should forfeit a marble: got %d left, want %d", len(player1.Inventory), 1)
+	}
+	if player1.MissedTurns != 1 || player1.ShouldSkipMyTurns {
+		t.Errorf("FAIL after one miss: got %d missed, away %v", player1.MissedTurns, player1.ShouldSkipMyTurns)
+	}
+	if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; got != "player 2" {
+		t.Errorf("FAIL active player: got %s, want %s", got, "player 2")
+	}
+	if g.State != engine.GameStateInProgress {
+		t.Errorf("FAIL state: got %s, want %s", g.State, engine.GameStateInProgress)
+	}
+	if last := g.ActionLog[len(g.ActionLog)-1]; !last.Skipped || last.Action.UserToken != "player 1" {
+		t.Errorf("FAIL logged skip: got %+v", last)
+	}
+
+	// player 2 plays, then player 1 misses again and is away
+	if err := g.PlayAction(shoot("player 2", 100, 100)); err != nil {
+		t.Fatalf("FAIL playing: %v", err)
+	}
+	if err := g.SkipTurn(); err != nil {
+		t.Fatalf("FAIL skipping: %v", err)
+	}
+	if !player1.ShouldSkipMyTurns {
+		t.Errorf("FAIL after %d misses: should be away", player1.MissedTurns)
+	}
+
+	g.PlayerIsBack("player 1")
+	if player1.MissedTurns != 0 || player1.ShouldSkipMyTurns {
+		t.Errorf("FAIL back: got %d missed, away %v", player1.MissedTurns, player1.ShouldSkipMyTurns)
+	}
+}
+
+func TestSkipAwayPlayers(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		away        []string
+		wantSkipped int
+		wantActive  string
+		wantState   engine.GameState
+	}{
+		{desc: "No one away", away: nil, wantSkipped: 0, wantActive: "player 1", wantState: engine.GameStateWaiting},
+		{desc: "First player away", away: []string{"player 1"}, wantSkipped: 1, wantActive: "player 2", wantState: engine.GameStateInProgress},
+		// every skip costs a marble, so it ends once the marbles run out
+		{desc: "Everyone away", away: []string{"player 1", "player 2"}, wantSkipped: 4, wantState: engine.GameStateFinished},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := newTwoPlayerGame(t, 2)
+			for _, userToken := range tC.away {
+				g.Players[userToken].ShouldSkipMyTurns = true
+			}
+
+			if got := g.SkipAwayPlayers(); got != tC.wantSkipped {
+				t.Errorf("FAIL %s skipped: got %d, want %d", tC.desc, got, tC.wantSkipped)
+			}
+			if g.State != tC.wantState {
+				t.Errorf("FAIL %s state: got %s, want %s", tC.desc, g.State, tC.wantState)
+			}
+			if got := g.TurnOrder[g.ActivePlayerIndex].UserToken; tC.wantActive != "" && got != tC.wantActive {
+				t.Errorf("FAIL %s active player: got %s, want %s", tC.desc, got, tC.wantActive)
+			}
+		})
+	}
+}
+
+func TestReplayRebuildsSkippedTurns(t *testing.T) {
+	g := newTwoPlayerGame(t, 2)
+	actions := []func() error{
+		g.SkipTurn,
+		func() error { return g.PlayAction(shoot("player 2", 100, 100)) },
+		func() error { return g.PlayAction(shoot("player 1", 400, 300)) },
+		g.SkipTurn,
+	}
+	for i, act := range actions {
+		if err := act(); err != nil {
+			t.Fatalf("FAIL action %d: %v", i, err)
+		}
+	}
+	if g.State != engine.GameStateFinished {
+		t.Fatalf("FAIL state: got %s, want %s", g.State, engine.GameStateFinished)
+	}
+
+	rebuilt, err := g.Replay().Rebuild()
+	if err != nil {
+		t.Fatalf("FAIL rebuilding: %v", err)
+	}
+	if len(rebuilt.ActionLog) != len(g.ActionLog) {
+		t.Fatalf("FAIL logged actions: got %d, want %d", len(rebuilt.ActionLog), len(g.ActionLog))
+	}
+	for i, logged := range g.ActionLog {
+		if got := rebuilt.ActionLog[i]; got.Skipped != logged.Skipped || got.Action.UserToken != logged.Action.UserToken {
+			t.Errorf("FAIL action %d: got %s skipped %v, want %s skipped %v", i, got.Action.UserToken, got.Skipped, logged.Action.UserToken, logged.Skipped)
+		}
+	}
+	for userToken, player := range g.Players {
+		if got := rebuilt.Players[userToken].Score; got != player.Score {
+			t.Errorf("FAIL %s score: got %d, want %d", userToken, got, player.Score)
+		}
+	}
+}
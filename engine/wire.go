@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/ungerik/go3d/float64/quaternion"
+)
+
+// The wire format is what the game websocket sends instead of the whole MarbleGame.
+//
+// Version 1:
+//
+//	{
+//	  "v": 1,
+//	  "players": [WirePlayer...],        // everyone who joined, referenced everywhere else by id
+//	  "marbleTypes": [MarbleType...],    // referenced by index into this list
+//	  "config": MarbleGameConfig,        // with the level's obstacles
+//	  "turnOrder": [playerId...],
+//	  "activePlayerIndex": 0,            // index into turnOrder
+//	  "state": "waiting" | "inProgress" | "finished",
+//	  "round": 1,                        // the end being played, counting from 1
+//	  "ends": [End...],                  // finished ends, with each player's points in them
+//	  "totals": {userToken: points},     // points banked from the finished ends
+//	  "hammer": userToken,               // who throws last this end, "" for the last in turnOrder
+//	  "turnDeadline": 0,                 // unix milliseconds when the active player's turn runs out, 0 with no clock
+//	  "keyframe": [WireMarble...],       // the first frame of the shot, in full
+//	  "deltas": [WireDelta...]           // one per following frame, each relative to the frame before it
+//	}
+//
+// Positions are sent as integers of 1/100th of a unit, and rotation quaternions as integers of 1/10000th.
+// A WireDelta holds records only for marbles that changed since the previous frame, as flat arrays:
+//
+//	[marbleId, dx, dy, dRot0, dRot1, dRot2, dRot3, dScore, collided]
+//
+// where collided is 1 or 0 and trailing zeros are trimmed, so [marbleId] means only collided went back to 0.
+// Marbles that appear or disappear between frames are listed in "add" (as WireMarbles) and "rm" (as ids).
+// Because every value is a quantized integer, summing the deltas rebuilds each frame exactly.
+// Velocities and highlight colors are not sent, the client doesn't draw them.
+const WireFormatVersion = 1
+
+const (
+	wirePositionScale = 100
+	wireRotationScale = 10000
+	wireNoOwner       = -1
+)
+
+type WireGame struct {
+	Version           int              `json:"v"`
+	Players           []WirePlayer     `json:"players"`
+	MarbleTypes       []MarbleType     `json:"marbleTypes"`
+	Config            MarbleGameConfig `json:"config"`
+	TurnOrder         []int            `json:"turnOrder"`
+	ActivePlayerIndex int              `json:"activePlayerIndex"`
+	State             GameState        `json:"state"`
+	Round             int              `json:"round"`
+	Ends              []End            `json:"ends"`
+	Totals            map[string]int   `json:"totals"`
+	Hammer            string           `json:"hammer"`
+	TurnDeadline      int64            `json:"turnDeadline"`
+	Keyframe          []WireMarble     `json:"keyframe"`
+	Deltas            []WireDelta      `json:"deltas"`
+}
+
+type WirePlayer struct {
+	Id                int    `json:"id"`
+	UserToken         string `json:"userToken"`
+	DisplayName       string `json:"displayName"`
+	Score             int    `json:"score"`
+	Hue               int    `json:"hue"`
+	ShouldSkipMyTurns bool   `json:"shouldSkipMyTurns"`
+	Left              bool   `json:"left"`
+	TurnsTaken        int    `json:"turnsTaken"`
+	BestMarbleScore   int    `json:"bestMarbleScore"`
+	Takebacks         int    `json:"takebacks"`
+	Inventory         []int  `json:"inventory"` // indexes into marbleTypes
+}
+
+type WireMarble struct {
+	Id       int    `json:"id"`
+	Type     int    `json:"type"`  // index into marbleTypes
+	Owner    int    `json:"owner"` // player id, -1 for no owner
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Rot      [4]int `json:"rot"`
+	Score    int    `json:"score"`
+	Collided bool   `json:"collided,omitempty"`
+}
+
+type WireDelta struct {
+	Marbles [][]int      `json:"m,omitempty"`
+	Added   []WireMarble `json:"add,omitempty"`
+	Removed []int        `json:"rm,omitempty"`
+}
+
+// Encodes the game into the compact wire format
+func (marbleGame *MarbleGame) EncodeWire() WireGame {
+	wireGame := WireGame{
+		Version:           WireFormatVersion,
+		Players:           []WirePlayer{},
+		MarbleTypes:       []MarbleType{},
+		Config:            marbleGame.Config,
+		TurnOrder:         []int{},
+		ActivePlayerIndex: marbleGame.ActivePlayerIndex,
+		State:             marbleGame.State,
+		Round:             marbleGame.Round(),
+		Ends:              marbleGame.Ends,
+		Totals:            marbleGame.EndTotals(),
+		Hammer:            marbleGame.Hammer,
+		TurnDeadline:      wireTime(marbleGame.TurnDeadline),
+		Keyframe:          []WireMarble{},
+		Deltas:            []WireDelta{},
+	}
+
+	typeIndex := func(marbleType MarbleType) int {
+		i := slices.IndexFunc(wireGame.MarbleTypes, func(t MarbleType) bool { return t.Name == marbleType.Name })
+		if i == -1 {
+			wireGame.MarbleTypes = append(wireGame.MarbleTypes, marbleType)
+			i = len(wireGame.MarbleTypes) - 1
+		}
+		return i
+	}
+
+	for _, join := range marbleGame.JoinLog {
+		player, exists := marbleGame.Players[join.UserToken]
+		if !exists {
+			continue
+		}
+		inventory := []int{}
+		for _, marbleType := range player.Inventory {
+			inventory = append(inventory, typeIndex(marbleType))
+		}
+		wireGame.Players = append(wireGame.Players, WirePlayer{
+			Id:                player.Id,
+			UserToken:         player.UserToken,
+			DisplayName:       player.DisplayName,
+			Score:             player.Score,
+			Hue:               player.Hue,
+			ShouldSkipMyTurns: player.ShouldSkipMyTurns,
+			Left:              player.Left,
+			TurnsTaken:        player.TurnsTaken,
+			BestMarbleScore:   player.BestMarbleScore,
+			Takebacks:         player.Takebacks,
+			Inventory:         inventory,
+		})
+	}
+
+	for _, player := range marbleGame.TurnOrder {
+		wireGame.TurnOrder = append(wireGame.TurnOrder, player.Id)
+	}
+
+	encodeMarble := func(m Marble) WireMarble {
+		owner := wireNoOwner
+		if m.Owner != nil {
+			owner = m.Owner.Id
+		}
+		return WireMarble{
+			Id:       m.Id,
+			Type:     typeIndex(m.Type),
+			Owner:    owner,
+			X:        quantize(m.Pos.X, wirePositionScale),
+			Y:        quantize(m.Pos.Y, wirePositionScale),
+			Rot:      quantizeRotation(m.Rot),
+			Score:    m.Score,
+			Collided: m.Collided,
+		}
+	}
+
+	if len(marbleGame.Frames) == 0 {
+		return wireGame
+	}
+
+	previous := map[int]WireMarble{}
+	for _, m := range marbleGame.Frames[0].Marbles {
+		wm := encodeMarble(m)
+		wireGame.Keyframe = append(wireGame.Keyframe, wm)
+		previous[wm.Id] = wm
+	}
+
+	for f := 1; f < len(marbleGame.Frames); f++ {
+		frame := marbleGame.Frames[f]
+		delta := WireDelta{}
+		current := map[int]WireMarble{}
+
+		for _, m := range frame.Marbles {
+			wm := encodeMarble(m)
+			current[wm.Id] = wm
+
+			before, existed := previous[wm.Id]
+			if !existed {
+				delta.Added = append(delta.Added, wm)
+				continue
+			}
+
+			collided := 0
+			if wm.Collided {
+				collided = 1
+			}
+			record := []int{
+				wm.Id,
+				wm.X - before.X,
+				wm.Y - before.Y,
+				wm.Rot[0] - before.Rot[0],
+				wm.Rot[1] - before.Rot[1],
+				wm.Rot[2] - before.Rot[2],
+				wm.Rot[3] - before.Rot[3],
+				wm.Score - before.Score,
+				collided,
+			}
+			for len(record) > 1 && record[len(record)-1] == 0 {
+				record = record[:len(record)-1]
+			}
+			if len(record) == 1 && wm.Collided == before.Collided {
+				// nothing changed
+				continue
+			}
+			delta.Marbles = append(delta.Marbles, record)
+		}
+
+		for _, m := range marbleGame.Frames[f-1].Marbles {
+			if _, stillThere := current[m.Id]; !stillThere {
+				delta.Removed = append(delta.Removed, m.Id)
+			}
+		}
+
+		wireGame.Deltas = append(wireGame.Deltas, delta)
+		previous = current
+	}
+
+	return wireGame
+}
+
+// Rebuilds a MarbleGame from the wire format, the same way the client does
+// the frames match the originals up to the wire format's quantization
+func (wireGame WireGame) Decode() *MarbleGame {
+	marbleGame := NewMarbleGame()
+	marbleGame.Config = wireGame.Config
+	marbleGame.ActivePlayerIndex = wireGame.ActivePlayerIndex
+	marbleGame.State = wireGame.State
+	marbleGame.Ends = wireGame.Ends
+	marbleGame.Hammer = wireGame.Hammer
+	if wireGame.TurnDeadline != 0 {
+		marbleGame.TurnDeadline = time.UnixMilli(wireGame.TurnDeadline)
+	}
+	marbleGame.Frames = []MarbleGameFrame{}
+
+	playersById := map[int]*Player{}
+	for _, wp := range wireGame.Players {
+		inventory := []MarbleType{}
+		for _, i := range wp.Inventory {
+			inventory = append(inventory, wireGame.MarbleTypes[i])
+		}
+		player := &Player{
+			Id:                wp.Id,
+			UserToken:         wp.UserToken,
+			DisplayName:       wp.DisplayName,
+			Score:             wp.Score,
+			Hue:               wp.Hue,
+			ShouldSkipMyTurns: wp.ShouldSkipMyTurns,
+			Left:              wp.Left,
+			TurnsTaken:        wp.TurnsTaken,
+			BestMarbleScore:   wp.BestMarbleScore,
+			Takebacks:         wp.Takebacks,
+			Inventory:         inventory,
+		}
+		playersById[wp.Id] = player
+		marbleGame.Players[wp.UserToken] = player
+	}
+	for _, id := range wireGame.TurnOrder {
+		marbleGame.TurnOrder = append(marbleGame.TurnOrder, playersById[id])
+	}
+
+	decodeMarble := func(wm WireMarble) Marble {
+		return Marble{
+			Id:       wm.Id,
+			Pos:      vector2.Vector2{X: float64(wm.X) / wirePositionScale, Y: float64(wm.Y) / wirePositionScale},
+			Rot:      dequantizeRotation(wm.Rot),
+			Score:    wm.Score,
+			Type:     wireGame.MarbleTypes[wm.Type],
+			Collided: wm.Collided,
+			Owner:    playersById[wm.Owner],
+		}
+	}
+
+	current := append([]WireMarble{}, wireGame.Keyframe...)
+	addFrame := func() {
+		frame := MarbleGameFrame{Marbles: []Marble{}}
+		for _, wm := range current {
+			frame.Marbles = append(frame.Marbles, decodeMarble(wm))
+		}
+		marbleGame.Frames = append(marbleGame.Frames, frame)
+	}
+	addFrame()
+
+	for _, delta := range wireGame.Deltas {
+		for _, record := range delta.Marbles {
+			i := slices.IndexFunc(current, func(wm WireMarble) bool { return wm.Id == record[0] })
+			field := func(n int) int {
+				if n < len(record) {
+					return record[n]
+				}
+				return 0
+			}
+			wm := &current[i]
+			wm.X += field(1)
+			wm.Y += field(2)
+			for r := range wm.Rot {
+				wm.Rot[r] += field(3 + r)
+			}
+			wm.Score += field(7)
+			wm.Collided = field(8) == 1
+		}
+		current = slices.DeleteFunc(current, func(wm WireMarble) bool { return slices.Contains(delta.Removed, wm.Id) })
+		current = append(current, delta.Added...)
+		addFrame()
+	}
+
+	return marbleGame
+}
+
+func quantize(value float64, scale float64) int {
+	return int(math.Round(value * scale))
+}
+
+func quantizeRotation(rot quaternion.T) [4]int {
+	return [4]int{
+		quantize(rot[0], wireRotationScale),
+		quantize(rot[1], wireRotationScale),
+		quantize(rot[2], wireRotationScale),
+		quantize(rot[3], wireRotationScale),
+	}
+}
+
+func dequantizeRotation(rot [4]int) quaternion.T {
+	return quaternion.T{
+		float64(rot[0]) / wireRotationScale,
+		float64(rot[1]) / wireRotationScale,
+		float64(rot[2]) / wireRotationScale,
+		float64(rot[3]) / wireRotationScale,
+	}
+}
+
+// Times go out as unix milliseconds, 0 for none
+func wireTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,203 @@
+package engine_test
+
+import (
+	"encoding/json"
+	"marblegame/engine"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/deeean/go-vector/vector2"
+)
+
+func wireRoundTrip(t *testing.T, g *engine.MarbleGame) *engine.MarbleGame {
+	t.Helper()
+	marshalled, err := json.Marshal(g.EncodeWire())
+	if err != nil {
+		t.Fatalf("FAIL marshalling wire game: %v", err)
+	}
+	var wireGame engine.WireGame
+	if err := json.Unmarshal(marshalled, &wireGame); err != nil {
+		t.Fatalf("FAIL unmarshalling wire game: %v", err)
+	}
+	return wireGame.Decode()
+}
+
+// Compares frames up to the wire format's quantization
+func assertSameFrames(t *testing.T, got, want []engine.MarbleGameFrame) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("FAIL frame count: got %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if len(got[i].Marbles) != len(want[i].Marbles) {
+			t.Fatalf("FAIL frame %d marble count: got %d, want %d", i, len(got[i].Marbles), len(want[i].Marbles))
+		}
+		for j, w := range want[i].Marbles {
+			g := got[i].Marbles[j]
+			if g.Id != w.Id || g.Score != w.Score || g.Collided != w.Collided || g.Type.Name != w.Type.Name {
+				t.Fatalf("FAIL frame %d marble %d: got %+v, want %+v", i, j, g, w)
+			}
+			if (g.Owner == nil) != (w.Owner == nil) || (g.Owner != nil && g.Owner.UserToken != w.Owner.UserToken) {
+				t.Fatalf("FAIL frame %d marble %d owner: got %+v, want %+v", i, j, g.Owner, w.Owner)
+			}
+			if math.Abs(g.Pos.X-w.Pos.X) > 0.005 || math.Abs(g.Pos.Y-w.Pos.Y) > 0.005 {
+				t.Fatalf("FAIL frame %d marble %d pos: got %v, want %v", i, j, g.Pos, w.Pos)
+			}
+			for r := range w.Rot {
+				if math.Abs(g.Rot[r]-w.Rot[r]) > 0.00005 {
+					t.Fatalf("FAIL frame %d marble %d rot: got %v, want %v", i, j, g.Rot, w.Rot)
+				}
+			}
+		}
+	}
+}
+
+func TestWireRoundTrip(t *testing.T) {
+	g := playRandomMatch(t, 7)
+	decoded := wireRoundTrip(t, g)
+
+	assertSameFrames(t, decoded.Frames, g.Frames)
+
+	if len(decoded.TurnOrder) != len(g.TurnOrder) {
+		t.Fatalf("FAIL turn order length: got %d, want %d", len(decoded.TurnOrder), len(g.TurnOrder))
+	}
+	for i := range g.TurnOrder {
+		if decoded.TurnOrder[i].UserToken != g.TurnOrder[i].UserToken {
+			t.Errorf("FAIL turn order %d: got %s, want %s", i, decoded.TurnOrder[i].UserToken, g.TurnOrder[i].UserToken)
+		}
+	}
+	for userToken, player := range g.Players {
+		p := decoded.Players[userToken]
+		if p.Score != player.Score || p.Hue != player.Hue || len(p.Inventory) != len(player.Inventory) {
+			t.Errorf("FAIL player %s: got %+v, want %+v", userToken, p, player)
+		}
+	}
+	if decoded.State != g.State || decoded.ActivePlayerIndex != g.ActivePlayerIndex {
+		t.Errorf("FAIL state: got %s/%d, want %s/%d", decoded.State, decoded.ActivePlayerIndex, g.State, g.ActivePlayerIndex)
+	}
+}
+
+func TestWirePayloadSize(t *testing.T) {
+	g := newTwoPlayerGame(t, 11)
+
+	// fill the field with resting marbles
+	for i := range 10 {
+		player := g.TurnOrder[g.ActivePlayerIndex]
+		x, y := 60+float64(i%5)*110, 140+float64(i/5)*200
+		if err := g.PlayAction(shoot(player.UserToken, x, y)); err != nil {
+			t.Fatalf("FAIL placing marble %d: %v", i, err)
+		}
+	}
+
+	// then a full power shot across the field
+	player := g.TurnOrder[g.ActivePlayerIndex]
+	err := g.PlayAction(engine.Action{
+		InventorySlot: 0,
+		Pos:           vector2.Vector2{X: 300, Y: 260},
+		Vel:           vector2.Vector2{X: 300, Y: 480},
+		UserToken:     player.UserToken,
+	})
+	if err != nil {
+		t.Fatalf("FAIL shooting: %v", err)
+	}
+	if len(g.Frames) < 100 {
+		t.Fatalf("FAIL expected a long shot, only got %d frames", len(g.Frames))
+	}
+
+	full, _ := json.Marshal(g)
+	wire, _ := json.Marshal(g.EncodeWire())
+	t.Logf("full %d bytes, wire %d bytes, %d frames", len(full), len(wire), len(g.Frames))
+	if len(full) < 10*len(wire) {
+		t.Errorf("FAIL wire format should be at least 10x smaller: full %d bytes, wire %d bytes", len(full), len(wire))
+	}
+
+	assertSameFrames(t, wireRoundTrip(t, g).Frames, g.Frames)
+}
+
+// Both encodings have to carry the same MarbleGameFrame content, the client decodes either one the same way
+func TestWireBinaryMatchesJSON(t *testing.T) {
+	testCases := []struct {
+		desc string
+		game func(t *testing.T) *engine.MarbleGame
+	}{
+		{
+			desc: "new game",
+			game: func(t *testing.T) *engine.MarbleGame { return newTwoPlayerGame(t, 11) },
+		},
+		{
+			desc: "random match",
+			game: func(t *testing.T) *engine.MarbleGame { return playRandomMatch(t, 7) },
+		},
+		{
+			desc: "another random match",
+			game: func(t *testing.T) *engine.MarbleGame { return playRandomMatch(t, 42) },
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			g := tC.game(t)
+
+			marshalledJSON, err := json.Marshal(g.EncodeWire())
+			if err != nil {
+				t.Fatalf("FAIL marshalling JSON: %v", err)
+			}
+			var fromJSON engine.WireGame
+			if err := json.Unmarshal(marshalledJSON, &fromJSON); err != nil {
+				t.Fatalf("FAIL unmarshalling JSON: %v", err)
+			}
+
+			marshalledBinary, err := g.EncodeWire().MarshalBinary()
+			if err != nil {
+				t.Fatalf("FAIL marshalling binary: %v", err)
+			}
+			var fromBinary engine.WireGame
+			if err := fromBinary.UnmarshalBinary(marshalledBinary); err != nil {
+				t.Fatalf("FAIL unmarshalling binary: %v", err)
+			}
+
+			if !reflect.DeepEqual(fromBinary, fromJSON) {
+				t.Errorf("FAIL binary and JSON wire games differ: got %+v, want %+v", fromBinary, fromJSON)
+			}
+
+			binaryFrames := fromBinary.Decode().Frames
+			jsonFrames := fromJSON.Decode().Frames
+			if !reflect.DeepEqual(binaryFrames, jsonFrames) {
+				t.Errorf("FAIL binary and JSON frames differ")
+			}
+			assertSameFrames(t, binaryFrames, g.Frames)
+
+			t.Logf("JSON %d bytes, binary %d bytes, %d frames", len(marshalledJSON), len(marshalledBinary), len(g.Frames))
+			if len(marshalledBinary) >= len(marshalledJSON) {
+				t.Errorf("FAIL binary should be smaller than JSON: got %d bytes, JSON is %d", len(marshalledBinary), len(marshalledJSON))
+			}
+		})
+	}
+}
+
+func TestWireBinaryRejectsBadInput(t *testing.T) {
+	valid, err := playRandomMatch(t, 7).EncodeWire().MarshalBinary()
+	if err != nil {
+		t.Fatalf("FAIL marshalling binary: %v", err)
+	}
+	wrongVersion := append([]byte{engine.WireFormatVersion + 1}, valid[1:]...)
+
+	testCases := []struct {
+		desc string
+		data []byte
+	}{
+		{desc: "empty", data: []byte{}},
+		{desc: "wrong version", data: wrongVersion},
+		{desc: "truncated header", data: valid[:10]},
+		{desc: "truncated frames", data: valid[:len(valid)-1]},
+		{desc: "trailing bytes", data: append(append([]byte{}, valid...), 0)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var wireGame engine.WireGame
+			if err := wireGame.UnmarshalBinary(tC.data); err == nil {
+				t.Errorf("FAIL expected an error, got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// The binary wire format carries exactly what the JSON one does, for clients that ask for it.
+// Integers are varints (signed ones zigzagged, see encoding/binary), and the layout is:
+//
+//	uvarint  version
+//	uvarint  length of the header, then the header as JSON:
+//	         {"players", "marbleTypes", "config", "turnOrder", "activePlayerIndex", "state",
+//	          "round", "ends", "totals", "hammer", "turnDeadline"}
+//	uvarint  keyframe marble count, then each marble
+//	uvarint  delta count, then for each delta:
+//	           uvarint record count, then each record as a uvarint length and that many varints
+//	           uvarint added count, then each marble
+//	           uvarint removed count, then each id as a varint
+//
+// where a marble is varints id, type, owner, x, y, rot0..rot3, score, then a byte for collided.
+// The header is small and changes shape whenever the config does, so only the frames are packed.
+
+type wireHeader struct {
+	Players           []WirePlayer     `json:"players"`
+	MarbleTypes       []MarbleType     `json:"marbleTypes"`
+	Config            MarbleGameConfig `json:"config"`
+	TurnOrder         []int            `json:"turnOrder"`
+	ActivePlayerIndex int              `json:"activePlayerIndex"`
+	State             GameState        `json:"state"`
+	Round             int              `json:"round"`
+	Ends              []End            `json:"ends"`
+	Totals            map[string]int   `json:"totals"`
+	Hammer            string           `json:"hammer"`
+	TurnDeadline      int64            `json:"turnDeadline"`
+}
+
+func (wireGame WireGame) MarshalBinary() ([]byte, error) {
+	header, err := json.Marshal(wireHeader{
+		Players:           wireGame.Players,
+		MarbleTypes:       wireGame.MarbleTypes,
+		Config:            wireGame.Config,
+		TurnOrder:         wireGame.TurnOrder,
+		ActivePlayerIndex: wireGame.ActivePlayerIndex,
+		State:             wireGame.State,
+		Round:             wireGame.Round,
+		Ends:              wireGame.Ends,
+		Totals:            wireGame.Totals,
+		Hammer:            wireGame.Hammer,
+		TurnDeadline:      wireGame.TurnDeadline,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := binary.AppendUvarint(nil, uint64(wireGame.Version))
+	b = binary.AppendUvarint(b, uint64(len(header)))
+	b = append(b, header...)
+
+	appendMarbles := func(b []byte, marbles []WireMarble) []byte {
+		b = binary.AppendUvarint(b, uint64(len(marbles)))
+		for _, wm := range marbles {
+			for _, v := range []int{wm.Id, wm.Type, wm.Owner, wm.X, wm.Y, wm.Rot[0], wm.Rot[1], wm.Rot[2], wm.Rot[3], wm.Score} {
+				b = binary.AppendVarint(b, int64(v))
+			}
+			if wm.Collided {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		}
+		return b
+	}
+
+	b = appendMarbles(b, wireGame.Keyframe)
+	b = binary.AppendUvarint(b, uint64(len(wireGame.Deltas)))
+	for _, delta := range wireGame.Deltas {
+		b = binary.AppendUvarint(b, uint64(len(delta.Marbles)))
+		for _, record := range delta.Marbles {
+			b = binary.AppendUvarint(b, uint64(len(record)))
+			for _, v := range record {
+				b = binary.AppendVarint(b, int64(v))
+			}
+		}
+		b = appendMarbles(b, delta.Added)
+		b = binary.AppendUvarint(b, uint64(len(delta.Removed)))
+		for _, id := range delta.Removed {
+			b = binary.AppendVarint(b, int64(id))
+		}
+	}
+
+	return b, nil
+}
+
+func (wireGame *WireGame) UnmarshalBinary(data []byte) error {
+	r := &wireReader{data: data}
+
+	version := int(r.uvarint())
+	if r.err == nil && version != WireFormatVersion {
+		return errors.New("Unsupported wire format version")
+	}
+
+	var header wireHeader
+	headerBytes := r.bytes(r.count())
+	if r.err != nil {
+		return r.err
+	}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return err
+	}
+
+	readMarbles := func() []WireMarble {
+		marbles := []WireMarble{}
+		for range r.count() {
+			wm := WireMarble{
+				Id:    r.varint(),
+				Type:  r.varint(),
+				Owner: r.varint(),
+				X:     r.varint(),
+				Y:     r.varint(),
+				Rot:   [4]int{r.varint(), r.varint(), r.varint(), r.varint()},
+				Score: r.varint(),
+			}
+			wm.Collided = r.byte() == 1
+			if r.err != nil {
+				return nil
+			}
+			marbles = append(marbles, wm)
+		}
+		return marbles
+	}
+
+	decoded := WireGame{
+		Version:           version,
+		Players:           header.Players,
+		MarbleTypes:       header.MarbleTypes,
+		Config:            header.Config,
+		TurnOrder:         header.TurnOrder,
+		ActivePlayerIndex: header.ActivePlayerIndex,
+		State:             header.State,
+		Round:             header.Round,
+		Ends:              header.Ends,
+		Totals:            header.Totals,
+		Hammer:            header.Hammer,
+		TurnDeadline:      header.TurnDeadline,
+		Keyframe:          readMarbles(),
+		Deltas:            []WireDelta{},
+	}
+
+	for range r.count() {
+		delta := WireDelta{}
+		for range r.count() {
+			record := []int{}
+			for range r.count() {
+				record = append(record, r.varint())
+			}
+			delta.Marbles = append(delta.Marbles, record)
+		}
+		if added := readMarbles(); len(added) > 0 {
+			delta.Added = added
+		}
+		for range r.count() {
+			delta.Removed = append(delta.Removed, r.varint())
+		}
+		if r.err != nil {
+			return r.err
+		}
+		decoded.Deltas = append(decoded.Deltas, delta)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) > 0 {
+		return errors.New("Trailing bytes after wire game")
+	}
+
+	*wireGame = decoded
+	return nil
+}
+
+var errTruncatedWireGame = errors.New("Truncated wire game")
+
+// Reads varints off the front of data, remembering the first error so callers can check once at the end
+type wireReader struct {
+	data []byte
+	err  error
+}
+
+func (r *wireReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errTruncatedWireGame
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *wireReader) varint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errTruncatedWireGame
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
+
+// A length, which can't be more than the bytes left since every item takes at least one
+func (r *wireReader) count() int {
+	v := r.uvarint()
+	if v > uint64(len(r.data)) {
+		r.err = errTruncatedWireGame
+		return 0
+	}
+	return int(v)
+}
+
+func (r *wireReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errTruncatedWireGame
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *wireReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errTruncatedWireGame
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
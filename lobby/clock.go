@@ -0,0 +1,24 @@
+package lobby
+
+import "time"
+
+// Where a GameHub gets the time from, tests swap in a fake one to run the turn clock by hand
+type Clock interface {
+	Now() time.Time
+	// Calls f on its own goroutine once d has passed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
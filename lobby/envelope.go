@@ -0,0 +1,109 @@
+package lobby
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"marblegame/views"
+	"marblegame/websockets"
+	"strings"
+	"unicode/utf8"
+)
+
+// Everything the game websocket sends is wrapped in an Envelope, so clients switch on its type rather than guessing
+// from the fields inside.
+//
+// Version 1:
+//
+//	{
+//	  "v": 1,
+//	  "type": "state" | "error" | "event" | "turn-change" | "chat",
+//	  "event": "preview" | "presence" | "matchSummary" | "takeback", // only with "type": "event"
+//	  "data": ...
+//	}
+//
+// with data by type:
+//
+//	state        engine.WireGame, the whole game in the wire format, see engine.WireFormatVersion
+//	error        engine.ActionError, only to the player whose action or preview was turned down
+//	event        PreviewResponse for "preview", only to the player aiming
+//	             Presence for "presence"
+//	             engine.MatchSummary for "matchSummary", once the match is over
+//	             Takeback for "takeback", as a player asks to take back a shot and the table answers
+//	turn-change  TurnChange, after every action, skipped turn or forfeited seat while the match goes on
+//	chat         ChatMessage, from anyone at the table to everyone
+//
+// JSON clients get queued envelopes as one text message, one per line. Errors, chat and some takebacks are followed by a line of
+// HTML, a views.Toast for htmx to swap into #toast, so clients should skip lines that don't start with "{".
+// Binary clients get state as websockets.BinaryKindGame, and every other envelope as websockets.BinaryKindJSON
+// without the HTML.
+//
+// Players send ActionRequests back, with one of "action", "preview", "chat" or "takeback" set.
+// New types, events and fields can be added to a version, anything else bumps EnvelopeVersion.
+const EnvelopeVersion = 1
+
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    MessageType     `json:"type"`
+	Event   EventName       `json:"event,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type MessageType string
+
+const (
+	MessageState      MessageType = "state"
+	MessageError      MessageType = "error"
+	MessageEvent      MessageType = "event"
+	MessageTurnChange MessageType = "turn-change"
+	MessageChat       MessageType = "chat"
+)
+
+type EventName string
+
+const (
+	EventPreview      EventName = "preview"
+	EventPresence     EventName = "presence"
+	EventMatchSummary EventName = "matchSummary"
+	EventTakeback     EventName = "takeback"
+)
+
+type TurnChange struct {
+	UserToken    string `json:"userToken"`    // whose turn it is now
+	Round        int    `json:"round"`        // the end being played, counting from 1
+	TurnDeadline int64  `json:"turnDeadline"` // unix milliseconds when it runs out, 0 with no turn clock
+}
+
+type ChatMessage struct {
+	UserToken string `json:"userToken"`
+	Message   string `json:"message"`
+}
+
+// Longer chat messages are cut off, it's in runes so a full message can take up to 4 times as many bytes
+// which has to fit in websockets.MaxMessageSize along with the rest of the ActionRequest
+const MaxChatLength = 200
+
+func marshalEnvelope(messageType MessageType, event EventName, data any) []byte {
+	marshalledData, _ := json.Marshal(data)
+	marshalled, _ := json.Marshal(Envelope{Version: EnvelopeVersion, Type: messageType, Event: event, Data: marshalledData})
+	return marshalled
+}
+
+// An envelope with a toast to show, JSON clients get the rendered views.Toast on the line after it
+func withToast(envelope []byte, message string) websockets.EncodedMessage {
+	var buffer bytes.Buffer
+	views.Toast(message).Render(context.Background(), &buffer)
+	return websockets.EncodedMessage{
+		JSON:   append(append(envelope, '\n'), buffer.Bytes()...),
+		Binary: append([]byte{websockets.BinaryKindJSON}, envelope...),
+	}
+}
+
+// Trims a chat message and cuts it down to MaxChatLength characters, "" if there's nothing to send
+func cleanChat(message string) string {
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > MaxChatLength {
+		message = string([]rune(message)[:MaxChatLength])
+	}
+	return message
+}
@@ -0,0 +1,427 @@
+package lobby
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"marblegame/engine"
+	"marblegame/websockets"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// A GameHub serves the MarbleGame owned by its Room
+// every read or change of the MarbleGame goes through Do, so it all happens on the one game goroutine
+type GameHub struct {
+	*websockets.Hub
+	Room            *Room
+	PreviewInterval time.Duration // previews sooner than this after a player's last one are dropped
+	BotDelay        time.Duration // how long bots take over their turn, so the last shot can play out first
+	Clock           Clock         // runs the turn clock, held seats and bots' BotDelay, set it before the hub is used
+	tasks           chan func()
+	lastPreviews    map[string]time.Time // by userToken, only touched on the game goroutine
+	turnTimer       Timer                // fires when the active player's turn runs out, only touched on the game goroutine
+	connections     map[string]int       // open sockets by userToken, only touched on the game goroutine
+	heldSeats       map[string]heldSeat  // by userToken, seats of disconnected players, see presence.go. Only touched on the game goroutine
+	takeback        *takebackRequest     // the takeback being asked for, see takeback.go. Only touched on the game goroutine
+	moves           int                  // goes up every time the match moves on, takebacks included, so a bot can tell its plan is stale. Only touched on the game goroutine
+}
+
+var _ websockets.HubInterface = (*GameHub)(nil)
+
+func NewGameHub(room *Room) *GameHub {
+	return &GameHub{
+		Hub:             websockets.NewHub(),
+		Room:            room,
+		PreviewInterval: 100 * time.Millisecond,
+		BotDelay:        3 * time.Second,
+		Clock:           realClock{},
+		tasks:           make(chan func()),
+		lastPreviews:    make(map[string]time.Time),
+		connections:     make(map[string]int),
+		heldSeats:       make(map[string]heldSeat),
+	}
+}
+
+// Runs the hub alongside the game goroutine
+func (gh *GameHub) Run() {
+	go gh.runGame()
+	gh.Hub.Run()
+}
+
+func (gh *GameHub) runGame() {
+	for task := range gh.tasks {
+		task()
+	}
+}
+
+// Runs fn on the game goroutine with the room's MarbleGame, and waits for it to finish
+func (gh *GameHub) Do(fn func(marbleGame *engine.MarbleGame)) {
+	done := make(chan struct{})
+	gh.tasks <- func() {
+		defer close(done)
+		fn(gh.Room.Game)
+	}
+	<-done
+}
+
+func (gh *GameHub) RegisterHandler(c *websockets.Client) {
+	time.AfterFunc(500*time.Millisecond, // TODO: this is jank sauce
+		func() {
+			gh.Do(func(marbleGame *engine.MarbleGame) {
+				gh.connections[c.UserToken]++
+				// the GameHub is up just before the room's first match is
+				if marbleGame == nil {
+					return
+				}
+				gh.reclaimSeat(c.UserToken)
+
+				// only players in the room get a seat, everyone else spectates, as do players who left the match
+				if gh.Room.HasPlayer(c.UserToken) {
+					if _, err := marbleGame.AddPlayer(c.UserToken); err != nil {
+						fmt.Println(err)
+					}
+				}
+				// the clock starts once the last player takes their seat, reconnecting doesn't reset it
+				if marbleGame.TurnDeadline.IsZero() {
+					gh.startTurnClock(marbleGame)
+				}
+
+				gh.sendMarbleGameToClient(c, marbleGame)
+				gh.sendHeldSeats(c)
+				gh.sendPendingTakeback(c)
+				if marbleGame.State == engine.GameStateFinished {
+					gh.Direct <- websockets.DirectMessage{Client: c, Message: marshalEnvelope(MessageEvent, EventMatchSummary, marbleGame.Summary())}
+				}
+				// they disconnected again before this ran
+				if gh.connections[c.UserToken] <= 0 {
+					gh.holdSeat(marbleGame, c.UserToken)
+				}
+				gh.playBotTurn(marbleGame)
+			})
+		},
+	)
+}
+
+// What players send over the game websocket, with one of the fields set, see Envelope for what comes back
+type ActionRequest struct {
+	ActionString  string `json:"action"`   // stringified input cause lazy
+	PreviewString string `json:"preview"`  // an action to predict rather than play, see sendPreview
+	Chat          string `json:"chat"`     // a message for everyone at the table, see sendChat
+	Takeback      string `json:"takeback"` // asking to take back their last shot, or answering someone who did, see takeback.go
+}
+
+func (gh *GameHub) ReadPumpHandler(c *websockets.Client, message []byte) {
+	// so when we read this from the ws we need to do some things
+
+	// 1. check if it's the player's turn
+
+	// 2. process their action
+	// we first have to extract out the stringified action cause of how the frontend is
+	var r ActionRequest
+	err := json.Unmarshal(message, &r)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if r.Chat != "" {
+		gh.sendChat(c, r.Chat)
+		return
+	}
+	if r.Takeback != "" {
+		gh.handleTakeback(c, r.Takeback)
+		return
+	}
+	if r.PreviewString != "" {
+		gh.sendPreview(c, r.PreviewString)
+		return
+	}
+	var a engine.Action
+	err = json.Unmarshal([]byte(r.ActionString), &a)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	a.UserToken = c.UserToken
+
+	gh.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame == nil {
+			return
+		}
+		// anything they send means they're back at the table
+		marbleGame.PlayerIsBack(a.UserToken)
+
+		// 3. calculate their hit into a new game state, and move on to the next in turn order
+		err := marbleGame.PlayAction(a)
+
+		if err != nil {
+			fmt.Println(err)
+			gh.sendActionError(c, err)
+		} else {
+			// 4. send the new game state to all the clients
+			gh.afterAction(marbleGame)
+		}
+	})
+}
+
+// Sends out the game after an action is played or a turn is skipped, and lets a bot take the next turn if it's theirs
+// players who are away are skipped first, and the next turn's clock started. A takeback still being asked for is dropped
+func (gh *GameHub) afterAction(marbleGame *engine.MarbleGame) {
+	gh.moves++
+	gh.cancelTakeback()
+	marbleGame.SkipAwayPlayers()
+	gh.startTurnClock(marbleGame)
+	gh.sendMarbleGameToClients(marbleGame)
+
+	if marbleGame.State == engine.GameStateFinished {
+		gh.sendMatchSummaryToClients(marbleGame)
+	} else {
+		gh.sendTurnChange(marbleGame)
+	}
+
+	gh.playBotTurn(marbleGame)
+}
+
+// If a bot is up, it plans its shot on a Clone off the game goroutine, waits out BotDelay, then plays it
+// the shot is thrown away if the match moved on in the meantime, a shot taken back and played again included
+func (gh *GameHub) playBotTurn(marbleGame *engine.MarbleGame) {
+	if marbleGame == nil || marbleGame.State == engine.GameStateFinished || len(marbleGame.TurnOrder) == 0 {
+		return
+	}
+	b, isBot := gh.Room.Bots[marbleGame.TurnOrder[marbleGame.ActivePlayerIndex].UserToken]
+	if !isBot {
+		return
+	}
+
+	// don't start the match without the rest of the room, they take their seats as they connect
+	if !gh.everyoneSeated(marbleGame) {
+		return
+	}
+
+	snapshot := marbleGame.Clone()
+	moves := gh.moves
+
+	go func() {
+		started := gh.Clock.Now()
+		action, err := b.PlanAction(snapshot)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// planning counts towards BotDelay
+		gh.Clock.AfterFunc(gh.BotDelay-gh.Clock.Now().Sub(started), func() {
+			gh.Do(func(current *engine.MarbleGame) {
+				if current != marbleGame || gh.moves != moves {
+					return
+				}
+				if err := current.PlayAction(action); err != nil {
+					fmt.Println(err)
+					return
+				}
+				gh.afterAction(current)
+			})
+		})
+	}()
+}
+
+// Whether the whole room has a seat, or the match is already under way
+func (gh *GameHub) everyoneSeated(marbleGame *engine.MarbleGame) bool {
+	if marbleGame.State != engine.GameStateWaiting {
+		return true
+	}
+	for _, userToken := range gh.Room.PlayerList() {
+		if _, seated := marbleGame.Players[userToken]; !seated {
+			return false
+		}
+	}
+	return true
+}
+
+// (Re)starts the active player's turn clock, if the config has one and everyone has a seat
+// when it runs out their turn is skipped, unless they've played in the meantime
+func (gh *GameHub) startTurnClock(marbleGame *engine.MarbleGame) {
+	if gh.turnTimer != nil {
+		gh.turnTimer.Stop()
+		gh.turnTimer = nil
+	}
+	if marbleGame == nil || !gh.everyoneSeated(marbleGame) {
+		return
+	}
+
+	now := gh.Clock.Now()
+	marbleGame.StartTurnClock(now)
+	if marbleGame.TurnDeadline.IsZero() {
+		return
+	}
+
+	gh.turnTimer = gh.Clock.AfterFunc(marbleGame.TurnDeadline.Sub(now), func() {
+		gh.Do(func(current *engine.MarbleGame) {
+			if current != marbleGame || !current.TurnTimedOut(gh.Clock.Now()) {
+				return
+			}
+			if err := current.SkipTurn(); err != nil {
+				fmt.Println(err)
+				return
+			}
+			gh.afterAction(current)
+		})
+	})
+}
+
+func (gh *GameHub) WritePumpHandler(c *websockets.Client, message []byte) error {
+	return c.WriteQueued(message)
+}
+
+func (gh *GameHub) ServeWS(c echo.Context) error {
+	upgrader := websockets.NewUpgrader()
+
+	userToken := c.QueryParam("userToken")
+	if userToken == "" {
+		return errors.New("no userToken")
+	}
+
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	client := &websockets.Client{
+		Hub:       gh,
+		UserToken: userToken,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		Encoding:  websockets.NegotiateEncoding(c, conn),
+	}
+
+	gh.Register <- client
+
+	go client.WritePump()
+	go client.ReadPump()
+
+	gh.RegisterHandler(client)
+
+	return nil
+}
+
+// Game state goes out in the compact wire format, see engine.WireFormatVersion
+func (gh *GameHub) sendMarbleGameToClients(marbleGame *engine.MarbleGame) {
+	gh.BroadcastEncoded <- encodeMarbleGame(marbleGame)
+}
+
+func (gh *GameHub) sendMarbleGameToClient(c *websockets.Client, marbleGame *engine.MarbleGame) {
+	encoded := encodeMarbleGame(marbleGame)
+	gh.Direct <- websockets.DirectMessage{Client: c, Message: encoded.JSON, Binary: encoded.Binary}
+}
+
+// Encodes the game once for each encoding, rather than once per client
+func encodeMarbleGame(marbleGame *engine.MarbleGame) websockets.EncodedMessage {
+	wireGame := marbleGame.EncodeWire()
+	marshalledBinary, _ := wireGame.MarshalBinary()
+	return websockets.EncodedMessage{
+		JSON:   marshalEnvelope(MessageState, "", wireGame),
+		Binary: append([]byte{websockets.BinaryKindGame}, marshalledBinary...),
+	}
+}
+
+type PreviewResponse struct {
+	Preview      engine.WireGame `json:"preview"`
+	ScoreChanges map[string]int  `json:"scoreChanges,omitempty"` // only sent with the whole outcome
+}
+
+// Predicts an action for the player aiming it, so they can see a ghost path before they shoot
+// previews are rate limited by PreviewInterval, and cut down to the config's PreviewFrames
+func (gh *GameHub) sendPreview(c *websockets.Client, previewString string) {
+	var a engine.Action
+	err := json.Unmarshal([]byte(previewString), &a)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	a.UserToken = c.UserToken
+
+	gh.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame == nil {
+			return
+		}
+		now := gh.Clock.Now()
+		if now.Sub(gh.lastPreviews[c.UserToken]) < gh.PreviewInterval {
+			return
+		}
+		gh.lastPreviews[c.UserToken] = now
+
+		prediction, err := marbleGame.PredictAction(a, marbleGame.Frames[len(marbleGame.Frames)-1])
+		if err != nil {
+			fmt.Println(err)
+			gh.sendActionError(c, err)
+			return
+		}
+
+		response := PreviewResponse{ScoreChanges: prediction.ScoreChanges}
+		frames := prediction.Frames
+		if previewFrames := marbleGame.Config.PreviewFrames; previewFrames > 0 {
+			// only the start of the shot, so previews don't give away where everything ends up
+			frames = frames[:min(previewFrames, len(frames))]
+			response.ScoreChanges = nil
+		}
+
+		preview := *marbleGame
+		preview.Frames = frames
+		response.Preview = preview.EncodeWire()
+
+		gh.Direct <- websockets.DirectMessage{Client: c, Message: marshalEnvelope(MessageEvent, EventPreview, response)}
+	})
+}
+
+// Tells just the player why their action or preview was turned down, errors that aren't ActionErrors stay on the server
+func (gh *GameHub) sendActionError(c *websockets.Client, err error) {
+	var actionErr *engine.ActionError
+	if !errors.As(err, &actionErr) {
+		return
+	}
+	message := withToast(marshalEnvelope(MessageError, "", actionErr), actionErr.Message)
+	gh.Direct <- websockets.DirectMessage{Client: c, Message: message.JSON, Binary: message.Binary}
+}
+
+func (gh *GameHub) sendMatchSummaryToClients(marbleGame *engine.MarbleGame) {
+	gh.Broadcast <- marshalEnvelope(MessageEvent, EventMatchSummary, marbleGame.Summary())
+}
+
+func (gh *GameHub) sendTurnChange(marbleGame *engine.MarbleGame) {
+	if len(marbleGame.TurnOrder) == 0 {
+		return
+	}
+	turnChange := TurnChange{
+		UserToken: marbleGame.TurnOrder[marbleGame.ActivePlayerIndex].UserToken,
+		Round:     marbleGame.Round(),
+	}
+	if !marbleGame.TurnDeadline.IsZero() {
+		turnChange.TurnDeadline = marbleGame.TurnDeadline.UnixMilli()
+	}
+	gh.Broadcast <- marshalEnvelope(MessageTurnChange, "", turnChange)
+}
+
+// Passes a chat message on to everyone watching the game, players and spectators alike
+func (gh *GameHub) sendChat(c *websockets.Client, message string) {
+	message = cleanChat(message)
+	if message == "" {
+		return
+	}
+	envelope := marshalEnvelope(MessageChat, "", ChatMessage{UserToken: c.UserToken, Message: message})
+
+	gh.Do(func(marbleGame *engine.MarbleGame) {
+		gh.BroadcastEncoded <- withToast(envelope, displayName(marbleGame, c.UserToken)+": "+message)
+	})
+}
+
+// The player's name at the table, spectators go by the start of their userToken like players do
+func displayName(marbleGame *engine.MarbleGame, userToken string) string {
+	if marbleGame != nil {
+		if player, exists := marbleGame.Players[userToken]; exists {
+			return player.DisplayName
+		}
+	}
+	return engine.NewPlayer(userToken).DisplayName
+}
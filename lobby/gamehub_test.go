@@ -0,0 +1,1231 @@
+package lobby_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"marblegame/bot"
+	"marblegame/engine"
+	"marblegame/lobby"
+	"marblegame/websockets"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deeean/go-vector/vector2"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// Run with `go test -race`, every client hammers the same GameHub at once while visitors come and go from the room
+func TestGameHubConcurrentClients(t *testing.T) {
+	const roomId = 9001
+	const clientCount = 12
+	const visitorCount = 4
+	const playerLimit = 4
+	const actionsPerClient = 15
+
+	room := lobby.NewRoom(roomId, "race")
+	room.SetMaxPlayers(clientCount + visitorCount)
+	for i := range clientCount {
+		room.AddPlayerToRoom(fmt.Sprintf("player %d", i))
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		marbleGame.Config.PlayerLimit = playerLimit
+	})
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	wsURL := strings.Replace(server.URL, "http", "ws", 1) + fmt.Sprintf("/ws/room/%d/game", roomId)
+
+	var wg sync.WaitGroup
+	// visitors join the room, look in on the match and leave again, all while it's being played
+	// they wait for the seats to fill, so they only ever spectate
+	for i := range visitorCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			userToken := fmt.Sprintf("visitor %d", i)
+			for seated := false; !seated; time.Sleep(10 * time.Millisecond) {
+				room.GameHub.Do(func(marbleGame *engine.MarbleGame) { seated = len(marbleGame.TurnOrder) == playerLimit })
+			}
+			for range 5 {
+				if err := room.AddPlayerToRoom(userToken); err != nil {
+					t.Errorf("FAIL %s joining the room: %v", userToken, err)
+					return
+				}
+				conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?userToken="+strings.ReplaceAll(userToken, " ", "%20"), nil)
+				if err != nil {
+					t.Errorf("FAIL dialing as %s: %v", userToken, err)
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+				conn.Close()
+				if err := room.RemovePlayerFromRoom(userToken); err != nil {
+					t.Errorf("FAIL %s leaving the room: %v", userToken, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := range clientCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			userToken := fmt.Sprintf("player %d", i)
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?userToken="+strings.ReplaceAll(userToken, " ", "%20"), nil)
+			if err != nil {
+				t.Errorf("FAIL dialing as %s: %v", userToken, err)
+				return
+			}
+			defer conn.Close()
+
+			// wait until we've joined and got the game state
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, _, err := conn.ReadMessage(); err != nil {
+				t.Errorf("FAIL reading first game state as %s: %v", userToken, err)
+				return
+			}
+
+			// keep draining broadcasts so our send channel never fills up
+			go func() {
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			r := rand.New(rand.NewSource(int64(i)))
+			for range actionsPerClient {
+				pos := vector2.Vector2{X: 50 + r.Float64()*500, Y: 50 + r.Float64()*380}
+				action, _ := json.Marshal(engine.Action{
+					InventorySlot: 0,
+					Pos:           pos,
+					Vel:           vector2.Vector2{X: pos.X + r.Float64()*40 - 20, Y: pos.Y + r.Float64()*40 - 20},
+				})
+				message, _ := json.Marshal(lobby.ActionRequest{ActionString: string(action)})
+				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					t.Errorf("FAIL writing action as %s: %v", userToken, err)
+					return
+				}
+			}
+
+			// give the hub time to work through what we sent before hanging up
+			time.Sleep(500 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.TurnOrder) != playerLimit {
+			t.Errorf("FAIL TurnOrder length: got %d, want %d", len(marbleGame.TurnOrder), playerLimit)
+		}
+		if len(marbleGame.Players) != len(marbleGame.TurnOrder) {
+			t.Errorf("FAIL Players and TurnOrder disagree: got %d players, %d in TurnOrder", len(marbleGame.Players), len(marbleGame.TurnOrder))
+		}
+
+		turnsTaken := 0
+		marblesThrown := 0
+		for _, player := range marbleGame.TurnOrder {
+			turnsTaken += player.TurnsTaken
+			marblesThrown += len(engine.NewPlayer(player.UserToken).Inventory) - len(player.Inventory)
+		}
+		if turnsTaken == 0 {
+			t.Errorf("FAIL no actions were played")
+		}
+		if turnsTaken != marblesThrown {
+			t.Errorf("FAIL turns taken and marbles thrown disagree: got %d turns, %d marbles", turnsTaken, marblesThrown)
+		}
+
+		if _, err := json.Marshal(marbleGame); err != nil {
+			t.Errorf("FAIL marshalling game: %v", err)
+		}
+	})
+}
+
+// Every way of asking for an encoding gets the same game state, in the message type it asked for
+func TestGameHubEncodings(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		query        string
+		subprotocols []string
+		wantType     int
+	}{
+		{
+			desc:     "JSON by default",
+			wantType: websocket.TextMessage,
+		},
+		{
+			desc:     "binary by query parameter",
+			query:    "&encoding=binary",
+			wantType: websocket.BinaryMessage,
+		},
+		{
+			desc:         "binary by subprotocol",
+			subprotocols: []string{websockets.BinarySubprotocol},
+			wantType:     websocket.BinaryMessage,
+		},
+	}
+	for i, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			roomId := 9100 + i
+			room := lobby.NewRoom(roomId, "encodings")
+			room.AddPlayerToRoom("player")
+			if err := room.StartGame(); err != nil {
+				t.Fatalf("FAIL starting game: %v", err)
+			}
+
+			e := echo.New()
+			lobby.RoomRoutes(e)
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			wsURL := strings.Replace(server.URL, "http", "ws", 1) + fmt.Sprintf("/ws/room/%d/game?userToken=player", roomId) + tC.query
+			dialer := websocket.Dialer{Subprotocols: tC.subprotocols}
+			conn, _, err := dialer.Dial(wsURL, nil)
+			if err != nil {
+				t.Fatalf("FAIL dialing: %v", err)
+			}
+			defer conn.Close()
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("FAIL reading game state: %v", err)
+			}
+			if messageType != tC.wantType {
+				t.Fatalf("FAIL message type: got %d, want %d", messageType, tC.wantType)
+			}
+
+			var wireGame engine.WireGame
+			if messageType == websocket.BinaryMessage {
+				if message[0] != websockets.BinaryKindGame {
+					t.Fatalf("FAIL binary kind: got %d, want %d", message[0], websockets.BinaryKindGame)
+				}
+				err = wireGame.UnmarshalBinary(message[1:])
+			} else {
+				var envelope lobby.Envelope
+				if err = json.Unmarshal(message, &envelope); err == nil {
+					if envelope.Type != lobby.MessageState {
+						t.Fatalf("FAIL envelope type: got %s, want %s", envelope.Type, lobby.MessageState)
+					}
+					err = json.Unmarshal(envelope.Data, &wireGame)
+				}
+			}
+			if err != nil {
+				t.Fatalf("FAIL decoding game state: %v", err)
+			}
+
+			room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+				want := marbleGame.EncodeWire().Decode()
+				got := wireGame.Decode()
+				if !reflect.DeepEqual(got.Frames, want.Frames) {
+					t.Errorf("FAIL frames: got %+v, want %+v", got.Frames, want.Frames)
+				}
+				if _, joined := got.Players["player"]; !joined {
+					t.Errorf("FAIL player missing from game state")
+				}
+			})
+		})
+	}
+}
+
+// Dials the room's game socket and waits for the first game state
+func dialGame(t *testing.T, serverURL string, roomId int, userToken string) *websocket.Conn {
+	t.Helper()
+	wsURL := strings.Replace(serverURL, "http", "ws", 1) + fmt.Sprintf("/ws/room/%d/game?userToken=%s", roomId, userToken)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("FAIL dialing as %s: %v", userToken, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("FAIL reading first game state as %s: %v", userToken, err)
+	}
+	return conn
+}
+
+func sendPreview(t *testing.T, conn *websocket.Conn, action engine.Action) {
+	t.Helper()
+	actionString, _ := json.Marshal(action)
+	message, _ := json.Marshal(lobby.ActionRequest{PreviewString: string(actionString)})
+	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatalf("FAIL sending preview: %v", err)
+	}
+}
+
+// Fails if anything arrives on conn within the wait
+func expectNoMessage(t *testing.T, conn *websocket.Conn, wait time.Duration, who string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(wait))
+	if _, message, err := conn.ReadMessage(); err == nil {
+		t.Errorf("FAIL %s got an unexpected message: %s", who, message)
+	}
+}
+
+func TestGameHubPreview(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		previewFrames    int
+		wantScoreChanges bool
+	}{
+		{
+			desc:          "ghost path",
+			previewFrames: 5,
+		},
+		{
+			desc:             "practice mode",
+			previewFrames:    0,
+			wantScoreChanges: true,
+		},
+	}
+	for i, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			roomId := 9200 + i
+			room := lobby.NewRoom(roomId, "preview")
+			room.AddPlayerToRoom("player1")
+			room.AddPlayerToRoom("player2")
+			if err := room.StartGame(); err != nil {
+				t.Fatalf("FAIL starting game: %v", err)
+			}
+			room.GameHub.PreviewInterval = time.Hour
+			room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+				marbleGame.Config.PreviewFrames = tC.previewFrames
+			})
+
+			e := echo.New()
+			lobby.RoomRoutes(e)
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			player1 := dialGame(t, server.URL, roomId, "player1")
+			defer player1.Close()
+			player2 := dialGame(t, server.URL, roomId, "player2")
+			defer player2.Close()
+
+			shot := engine.Action{
+				InventorySlot: 0,
+				Pos:           vector2.Vector2{X: 300, Y: 400},
+				Vel:           vector2.Vector2{X: 300, Y: 480},
+			}
+			sendPreview(t, player1, shot)
+			sendPreview(t, player1, shot) // too soon, dropped
+
+			envelope := expectEnvelope(t, player1, lobby.MessageEvent, lobby.EventPreview, nil)
+			var response lobby.PreviewResponse
+			if err := json.Unmarshal(envelope.Data, &response); err != nil {
+				t.Fatalf("FAIL unmarshalling preview: %v", err)
+			}
+
+			frameCount := len(response.Preview.Decode().Frames)
+			if tC.previewFrames > 0 && frameCount != tC.previewFrames {
+				t.Errorf("FAIL preview frames: got %d, want %d", frameCount, tC.previewFrames)
+			}
+			if tC.previewFrames == 0 && frameCount <= 5 {
+				t.Errorf("FAIL practice mode should preview the whole shot, only got %d frames", frameCount)
+			}
+			if gotScoreChanges := response.ScoreChanges != nil; gotScoreChanges != tC.wantScoreChanges {
+				t.Errorf("FAIL score changes sent: got %v, want %v", gotScoreChanges, tC.wantScoreChanges)
+			}
+
+			expectNoMessage(t, player1, 300*time.Millisecond, "player1 after a rate limited preview")
+			expectNoMessage(t, player2, 300*time.Millisecond, "player2 during player1's preview")
+
+			room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+				if len(marbleGame.Frames) != 1 || len(marbleGame.ActionLog) != 0 {
+					t.Errorf("FAIL previewing changed the game: got %d frames, %d actions", len(marbleGame.Frames), len(marbleGame.ActionLog))
+				}
+			})
+		})
+	}
+}
+
+func TestGameSocketEnvelopes(t *testing.T) {
+	const roomId = 9250
+	room := lobby.NewRoom(roomId, "envelopes")
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+	player2 := dialGame(t, server.URL, roomId, "player2")
+	defer player2.Close()
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.TurnOrder) == 2 })
+
+	send := func(conn *websocket.Conn, request lobby.ActionRequest) {
+		t.Helper()
+		message, _ := json.Marshal(request)
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatalf("FAIL sending: %v", err)
+		}
+	}
+	shot := func(x, y float64) string {
+		action, _ := json.Marshal(engine.Action{InventorySlot: 0, Pos: vector2.Vector2{X: x, Y: y}, Vel: vector2.Vector2{X: x, Y: y}})
+		return string(action)
+	}
+
+	// out of turn, only player2 hears about it
+	send(player2, lobby.ActionRequest{ActionString: shot(300, 240)})
+	if got := expectActionError(t, player2).Code; got != engine.CodeNotYourTurn {
+		t.Errorf("FAIL error code: got %s, want %s", got, engine.CodeNotYourTurn)
+	}
+
+	send(player1, lobby.ActionRequest{ActionString: shot(300, 240)})
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		var turnChange lobby.TurnChange
+		json.Unmarshal(expectEnvelope(t, conn, lobby.MessageTurnChange, "", nil).Data, &turnChange)
+		if turnChange.UserToken != "player2" || turnChange.Round != 1 {
+			t.Errorf("FAIL turn change: got %+v, want player2's turn in round 1", turnChange)
+		}
+	}
+
+	// chat goes to everyone with a toast after it, and player1 never got player2's error
+	send(player2, lobby.ActionRequest{Chat: "  nice shot  "})
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		gotChat := false
+		for !gotChat {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("FAIL waiting for chat: %v", err)
+			}
+			lines := strings.Split(string(message), "\n")
+			for i, line := range lines {
+				var envelope lobby.Envelope
+				if json.Unmarshal([]byte(line), &envelope) != nil {
+					continue
+				}
+				if conn == player1 && envelope.Type == lobby.MessageError {
+					t.Errorf("FAIL player1 got player2's error")
+				}
+				if envelope.Type != lobby.MessageChat {
+					continue
+				}
+				gotChat = true
+				var chat lobby.ChatMessage
+				json.Unmarshal(envelope.Data, &chat)
+				if chat.UserToken != "player2" || chat.Message != "nice shot" {
+					t.Errorf("FAIL chat: got %+v, want player2 saying %q", chat, "nice shot")
+				}
+				if i+1 >= len(lines) || !strings.Contains(lines[i+1], `id="toast"`) || !strings.Contains(lines[i+1], "play: nice shot") {
+					t.Errorf("FAIL chat toast: got %q", lines[i+1:])
+				}
+			}
+		}
+	}
+}
+
+func TestTakebackNeedsConsent(t *testing.T) {
+	const roomId = 9260
+	room := lobby.NewRoom(roomId, "takebacks")
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.SetTakebacks(2); err != nil {
+		t.Fatalf("FAIL setting takebacks: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+	player2 := dialGame(t, server.URL, roomId, "player2")
+	defer player2.Close()
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.TurnOrder) == 2 })
+
+	send := func(conn *websocket.Conn, request lobby.ActionRequest) {
+		t.Helper()
+		message, _ := json.Marshal(request)
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatalf("FAIL sending: %v", err)
+		}
+	}
+	shot := func(x, y float64) string {
+		action, _ := json.Marshal(engine.Action{InventorySlot: 0, Pos: vector2.Vector2{X: x, Y: y}, Vel: vector2.Vector2{X: x, Y: y}})
+		return string(action)
+	}
+	expectTakeback := func(conn *websocket.Conn, status string) lobby.Takeback {
+		t.Helper()
+		var takeback lobby.Takeback
+		expectEnvelope(t, conn, lobby.MessageEvent, lobby.EventTakeback, func(data json.RawMessage) bool {
+			return json.Unmarshal(data, &takeback) == nil && takeback.Status == status
+		})
+		return takeback
+	}
+	expectCode := func(conn *websocket.Conn, want engine.ActionErrorCode) {
+		t.Helper()
+		if got := expectActionError(t, conn).Code; got != want {
+			t.Errorf("FAIL error code: got %s, want %s", got, want)
+		}
+	}
+
+	send(player1, lobby.ActionRequest{ActionString: shot(300, 240)})
+	expectEnvelope(t, player1, lobby.MessageTurnChange, "", nil)
+	expectEnvelope(t, player2, lobby.MessageTurnChange, "", nil)
+
+	send(player2, lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	expectCode(player2, engine.CodeNothingToTakeBack)
+
+	send(player1, lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		if takeback := expectTakeback(conn, lobby.TakebackRequested); takeback.UserToken != "player1" || !reflect.DeepEqual(takeback.WaitingOn, []string{"player2"}) {
+			t.Errorf("FAIL request: got %+v, want player1 waiting on player2", takeback)
+		}
+	}
+	send(player1, lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	expectCode(player1, lobby.CodeTakebackPending)
+	send(player1, lobby.ActionRequest{Takeback: lobby.TakebackApprove})
+	expectCode(player1, lobby.CodeNoTakebackRequest)
+
+	// refused, so the shot stands
+	send(player2, lobby.ActionRequest{Takeback: lobby.TakebackDecline})
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		expectTakeback(conn, lobby.TakebackDeclined)
+	}
+
+	// allowed, so it's player1's turn again with the field empty
+	send(player1, lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	expectTakeback(player2, lobby.TakebackRequested)
+	send(player2, lobby.ActionRequest{Takeback: lobby.TakebackApprove})
+	// the approval and the turn change after it can be queued into one message, so both are picked out line by line
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		approved := false
+		for turnChanged := false; !turnChanged; {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("FAIL waiting for the turn after the takeback: %v", err)
+			}
+			for _, line := range strings.Split(string(message), "\n") {
+				var envelope lobby.Envelope
+				if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &envelope) != nil {
+					continue
+				}
+				var takeback lobby.Takeback
+				if envelope.Event == lobby.EventTakeback && json.Unmarshal(envelope.Data, &takeback) == nil && takeback.Status == lobby.TakebackApproved {
+					approved = true
+				}
+				if envelope.Type == lobby.MessageTurnChange {
+					turnChanged = true
+					var turnChange lobby.TurnChange
+					json.Unmarshal(envelope.Data, &turnChange)
+					if turnChange.UserToken != "player1" {
+						t.Errorf("FAIL turn after takeback: got %s, want player1", turnChange.UserToken)
+					}
+				}
+			}
+		}
+		if !approved {
+			t.Errorf("FAIL the turn changed without the takeback being approved")
+		}
+	}
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.ActionLog) != 0 || len(marbleGame.Frames[len(marbleGame.Frames)-1].Marbles) != 0 {
+			t.Errorf("FAIL after takeback: got %d actions and %d marbles, want none", len(marbleGame.ActionLog), len(marbleGame.Frames[len(marbleGame.Frames)-1].Marbles))
+		}
+		if got := marbleGame.Players["player1"].Takebacks; got != 1 {
+			t.Errorf("FAIL takebacks used: got %d, want 1", got)
+		}
+	})
+
+	// the game moving on drops a request nobody answered
+	send(player1, lobby.ActionRequest{ActionString: shot(300, 240)})
+	expectEnvelope(t, player2, lobby.MessageTurnChange, "", nil)
+	send(player1, lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	expectTakeback(player2, lobby.TakebackRequested)
+	send(player2, lobby.ActionRequest{ActionString: shot(200, 200)})
+	for _, conn := range []*websocket.Conn{player1, player2} {
+		expectTakeback(conn, lobby.TakebackCancelled)
+	}
+}
+
+func TestLongChatKeepsTheSocketOpen(t *testing.T) {
+	const roomId = 9270
+	room := lobby.NewRoom(roomId, "chat")
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+	player2 := dialGame(t, server.URL, roomId, "player2")
+	defer player2.Close()
+
+	testCases := []struct {
+		desc    string
+		message string
+		want    string
+	}{
+		{desc: "Four byte runes", message: strings.Repeat("🎲", lobby.MaxChatLength), want: strings.Repeat("🎲", lobby.MaxChatLength)},
+		{desc: "JSON escaped control characters", message: strings.Repeat("\x01", lobby.MaxChatLength), want: strings.Repeat("\x01", lobby.MaxChatLength)},
+		{desc: "Cut off", message: strings.Repeat("é", lobby.MaxChatLength+50), want: strings.Repeat("é", lobby.MaxChatLength)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			// sent the way htmx's ws-send does, with every field of the form and its headers
+			message, _ := json.Marshal(map[string]any{
+				"action":   "",
+				"preview":  "",
+				"chat":     tC.message,
+				"takeback": "",
+				"HEADERS": map[string]any{
+					"HX-Request":      "true",
+					"HX-Trigger":      "game-form",
+					"HX-Trigger-Name": nil,
+					"HX-Target":       "game-form",
+					"HX-Current-URL":  server.URL + fmt.Sprintf("/room/%d/game", roomId),
+				},
+			})
+			if err := player1.WriteMessage(websocket.TextMessage, message); err != nil {
+				t.Fatalf("FAIL sending chat: %v", err)
+			}
+
+			var chat lobby.ChatMessage
+			expectEnvelope(t, player1, lobby.MessageChat, "", func(data json.RawMessage) bool {
+				return json.Unmarshal(data, &chat) == nil
+			})
+			if chat.Message != tC.want {
+				t.Errorf("FAIL %s: got %d runes back, want %d", tC.desc, utf8.RuneCountInString(chat.Message), utf8.RuneCountInString(tC.want))
+			}
+		})
+	}
+}
+
+// StartGame puts up the GameHub just before the match, so anything getting in first must find no match rather than crash
+func TestGameHubBeforeTheMatch(t *testing.T) {
+	const roomId = 9271
+	room := lobby.NewRoom(roomId, "early")
+	room.AddPlayerToRoom("player1")
+	room.GameHub = lobby.NewGameHub(room)
+	go room.GameHub.Run()
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	response, err := http.Get(fmt.Sprintf("%s/room/%d/replay", server.URL, roomId))
+	if err != nil {
+		t.Fatalf("FAIL getting replay: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("FAIL replay status: got %d, want %d", response.StatusCode, http.StatusNotFound)
+	}
+
+	if err := room.SetMaxPlayers(3); err != nil {
+		t.Errorf("FAIL setting max players: %v", err)
+	}
+
+	// no game state comes back yet, so not through dialGame
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1)+fmt.Sprintf("/ws/room/%d/game?userToken=player1", roomId), nil)
+	if err != nil {
+		t.Fatalf("FAIL dialing: %v", err)
+	}
+	defer conn.Close()
+	action, _ := json.Marshal(engine.Action{InventorySlot: 0, Pos: vector2.Vector2{X: 300, Y: 240}, Vel: vector2.Vector2{X: 300, Y: 240}})
+	for _, request := range []lobby.ActionRequest{{ActionString: string(action)}, {PreviewString: string(action)}, {Chat: "early"}} {
+		message, _ := json.Marshal(request)
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatalf("FAIL sending: %v", err)
+		}
+	}
+	// the chat is handled after the action and preview, and the socket registers after it
+	expectEnvelope(t, conn, lobby.MessageChat, "", nil)
+	time.Sleep(600 * time.Millisecond)
+
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame.Config.PlayerLimit != 3 {
+			t.Errorf("FAIL player limit: got %d, want 3", marbleGame.Config.PlayerLimit)
+		}
+	})
+}
+
+// Waits for the room's match to satisfy done, checking through Do
+func waitForGame(t *testing.T, room *lobby.Room, timeout time.Duration, done func(marbleGame *engine.MarbleGame) bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		var ok bool
+		room.GameHub.Do(func(marbleGame *engine.MarbleGame) { ok = done(marbleGame) })
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("FAIL timed out waiting on the match")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A room with a GameHub that doesn't make bots wait
+func newBotRoom(t *testing.T, roomId int, maxPlayers int) *lobby.Room {
+	t.Helper()
+	room := lobby.NewRoom(roomId, "bots")
+	room.SetMaxPlayers(maxPlayers)
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.BotDelay = 0
+	go room.GameHub.Run()
+	return room
+}
+
+func TestBotsPlayAWholeMatch(t *testing.T) {
+	room := newBotRoom(t, 9300, 2)
+	for _, difficulty := range []bot.Difficulty{bot.Easy, bot.Medium} {
+		if _, err := room.AddBot(difficulty); err != nil {
+			t.Fatalf("FAIL adding %s bot: %v", difficulty.Name, err)
+		}
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	waitForGame(t, room, 30*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return marbleGame.State == engine.GameStateFinished
+	})
+
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		wantActions := 2 * len(engine.NewPlayer("").Inventory)
+		if len(marbleGame.ActionLog) != wantActions {
+			t.Errorf("FAIL actions played: got %d, want %d", len(marbleGame.ActionLog), wantActions)
+		}
+		if len(marbleGame.Summary().Standings) != 2 {
+			t.Errorf("FAIL standings: got %+v, want both bots", marbleGame.Summary().Standings)
+		}
+	})
+}
+
+func TestBotAnswersHumanShot(t *testing.T) {
+	const roomId = 9301
+	room := newBotRoom(t, roomId, 2)
+	room.AddPlayerToRoom("human")
+	b, err := room.AddBot(bot.Medium)
+	if err != nil {
+		t.Fatalf("FAIL adding bot: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	// the bot is seated first, but waits for the human before it shoots
+	conn := dialGame(t, server.URL, roomId, "human")
+	defer conn.Close()
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return len(marbleGame.ActionLog) == 1 && len(marbleGame.TurnOrder) == 2
+	})
+
+	// right on top of the bot's marble is turned down, anywhere clear of it is fine
+	var botMarble, clear vector2.Vector2
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		frame := marbleGame.Frames[len(marbleGame.Frames)-1]
+		botMarble = frame.Marbles[0].Pos
+		human := marbleGame.Players["human"]
+		clear, _ = marbleGame.ClosestPlacement(human, human.Inventory[0], vector2.Vector2{X: 300, Y: 240}, frame)
+	})
+	for _, pos := range []vector2.Vector2{botMarble, clear} {
+		action, _ := json.Marshal(engine.Action{InventorySlot: 0, Pos: pos, Vel: pos})
+		message, _ := json.Marshal(lobby.ActionRequest{ActionString: string(action)})
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatalf("FAIL sending action: %v", err)
+		}
+		if pos == botMarble {
+			if got := expectActionError(t, conn).Code; got != engine.CodeOverlapsMarble {
+				t.Errorf("FAIL action on the bot's marble: got %s, want %s", got, engine.CodeOverlapsMarble)
+			}
+		}
+	}
+
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return len(marbleGame.ActionLog) == 3
+	})
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		for i, want := range []string{b.UserToken, "human", b.UserToken} {
+			if got := marbleGame.ActionLog[i].Action.UserToken; got != want {
+				t.Errorf("FAIL action %d: got %s, want %s", i, got, want)
+			}
+		}
+	})
+}
+
+// A clock the test moves by hand, timers fire on Advance
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) lobby.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.mu.Lock()
+	defer timer.clock.mu.Unlock()
+	wasRunning := !timer.stopped
+	timer.stopped = true
+	return wasRunning
+}
+
+// Moves the clock on by d and runs every timer that's come due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	due := []*fakeTimer{}
+	for _, timer := range c.timers {
+		if !timer.stopped && !c.now.Before(timer.at) {
+			timer.stopped = true
+			due = append(due, timer)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+// Waits for n timers to be waiting on the clock, for timers set off the game goroutine
+func (c *fakeClock) waitForTimers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		pending := 0
+		for _, timer := range c.timers {
+			if !timer.stopped {
+				pending++
+			}
+		}
+		c.mu.Unlock()
+		if pending == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("FAIL timed out waiting on %d timers, %d pending", n, pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBotsWaitOutBotDelay(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	room := lobby.NewRoom(9402, "bots")
+	room.SetMaxPlayers(2)
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.Clock = clock
+	room.GameHub.BotDelay = 10 * time.Second
+	go room.GameHub.Run()
+	for range 2 {
+		if _, err := room.AddBot(bot.Easy); err != nil {
+			t.Fatalf("FAIL adding bot: %v", err)
+		}
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	actionsPlayed := func() int {
+		var played int
+		room.GameHub.Do(func(marbleGame *engine.MarbleGame) { played = len(marbleGame.ActionLog) })
+		return played
+	}
+	for want := range 2 {
+		clock.waitForTimers(t, 1)
+		clock.Advance(9 * time.Second)
+		if got := actionsPlayed(); got != want {
+			t.Errorf("FAIL actions before BotDelay: got %d, want %d", got, want)
+		}
+		clock.Advance(time.Second)
+		waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+			return len(marbleGame.ActionLog) == want+1
+		})
+	}
+}
+
+func TestStaleBotPlansAreDropped(t *testing.T) {
+	const roomId = 9403
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	room := lobby.NewRoom(roomId, "bots")
+	room.SetMaxPlayers(2)
+	if err := room.SetTakebacks(1); err != nil {
+		t.Fatalf("FAIL setting takebacks: %v", err)
+	}
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.Clock = clock
+	room.GameHub.BotDelay = 10 * time.Second
+	go room.GameHub.Run()
+	room.AddPlayerToRoom("human")
+	b, err := room.AddBot(bot.Medium)
+	if err != nil {
+		t.Fatalf("FAIL adding bot: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn := dialGame(t, server.URL, roomId, "human")
+	defer conn.Close()
+	go drain(conn)
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.TurnOrder) == 2 })
+	clock.waitForTimers(t, 1)
+	clock.Advance(10 * time.Second)
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.ActionLog) == 1 })
+
+	send := func(request lobby.ActionRequest) {
+		t.Helper()
+		message, _ := json.Marshal(request)
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			t.Fatalf("FAIL sending: %v", err)
+		}
+	}
+	shoot := func(target vector2.Vector2) {
+		t.Helper()
+		var pos vector2.Vector2
+		room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+			human := marbleGame.Players["human"]
+			pos, _ = marbleGame.ClosestPlacement(human, human.Inventory[0], target, marbleGame.Frames[len(marbleGame.Frames)-1])
+		})
+		action, _ := json.Marshal(engine.Action{InventorySlot: 0, Pos: pos, Vel: pos})
+		send(lobby.ActionRequest{ActionString: string(action)})
+		waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.ActionLog) == 2 })
+	}
+
+	// against a bot the takeback is straight away, so the log is back to the same length before the first plan is due
+	shoot(vector2.Vector2{X: 300, Y: 240})
+	clock.waitForTimers(t, 1)
+	clock.Advance(5 * time.Second)
+	send(lobby.ActionRequest{Takeback: lobby.TakebackRequest})
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.ActionLog) == 1 })
+	shoot(vector2.Vector2{X: 200, Y: 200})
+	clock.waitForTimers(t, 2)
+
+	clock.Advance(5 * time.Second)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.ActionLog) != 2 {
+			t.Errorf("FAIL actions once the stale plan is due: got %d, want 2", len(marbleGame.ActionLog))
+		}
+	})
+
+	clock.Advance(5 * time.Second)
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool { return len(marbleGame.ActionLog) >= 3 })
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.ActionLog) != 3 || marbleGame.ActionLog[2].Action.UserToken != b.UserToken {
+			t.Errorf("FAIL actions once the fresh plan is due: got %d, want the bot's shot third", len(marbleGame.ActionLog))
+		}
+	})
+}
+
+func TestTurnClockSkipsAwayPlayers(t *testing.T) {
+	const roomId = 9400
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	room := lobby.NewRoom(roomId, "clock")
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.Clock = clock
+	go room.GameHub.Run()
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.SetTurnClock(30, 1); err != nil {
+		t.Fatalf("FAIL setting the turn clock: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+	player2 := dialGame(t, server.URL, roomId, "player2")
+	defer player2.Close()
+	go drain(player1)
+	go drain(player2)
+
+	// the clock starts once both are seated
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return len(marbleGame.TurnOrder) == 2 && !marbleGame.TurnDeadline.IsZero()
+	})
+
+	clock.Advance(29 * time.Second)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.ActionLog) != 0 {
+			t.Errorf("FAIL skipped before the deadline: got %d actions", len(marbleGame.ActionLog))
+		}
+	})
+
+	// player1 misses their turn, which is enough to be away
+	clock.Advance(time.Second)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.ActionLog) != 1 || !marbleGame.ActionLog[0].Skipped {
+			t.Fatalf("FAIL player1's turn should be skipped, got %+v", marbleGame.ActionLog)
+		}
+		if !marbleGame.Players["player1"].ShouldSkipMyTurns {
+			t.Errorf("FAIL player1 should be away")
+		}
+		if want := clock.Now().Add(30 * time.Second); !marbleGame.TurnDeadline.Equal(want) {
+			t.Errorf("FAIL player2's deadline: got %v, want %v", marbleGame.TurnDeadline, want)
+		}
+	})
+
+	// once player2 plays, away player1 is skipped straight away
+	action, _ := json.Marshal(engine.Action{
+		InventorySlot: 0,
+		Pos:           vector2.Vector2{X: 300, Y: 240},
+		Vel:           vector2.Vector2{X: 300, Y: 240},
+	})
+	message, _ := json.Marshal(lobby.ActionRequest{ActionString: string(action)})
+	if err := player2.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatalf("FAIL sending action: %v", err)
+	}
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return len(marbleGame.ActionLog) == 3
+	})
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		for i, want := range []bool{true, false, true} {
+			if got := marbleGame.ActionLog[i].Skipped; got != want {
+				t.Errorf("FAIL action %d skipped: got %v, want %v", i, got, want)
+			}
+		}
+		if got := marbleGame.TurnOrder[marbleGame.ActivePlayerIndex].UserToken; got != "player2" {
+			t.Errorf("FAIL active player: got %s, want %s", got, "player2")
+		}
+	})
+}
+
+// A player whose socket falls too far behind is dropped by the hub, and that has to count as disconnecting
+func TestLaggingPlayersLoseTheirSeat(t *testing.T) {
+	const roomId = 9404
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	room := lobby.NewRoom(roomId, "lag")
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.Clock = clock
+	go room.GameHub.Run()
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.SetLeaveRules(10, engine.LeaverMarblesRemove); err != nil {
+		t.Fatalf("FAIL setting leave rules: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+
+	// nothing reads player2's messages, so the first one sent overflows their buffer
+	lagging := &websockets.Client{Hub: room.GameHub, UserToken: "player2", Send: make(chan []byte)}
+	room.GameHub.Register <- lagging
+	room.GameHub.RegisterHandler(lagging)
+
+	expectPresence(t, player1, "player2", lobby.PresenceDisconnected)
+	clock.Advance(10 * time.Second)
+	expectPresence(t, player1, "player2", lobby.PresenceLeft)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.TurnOrder) != 1 || !marbleGame.Players["player2"].Left {
+			t.Errorf("FAIL player2 should have left, got %d seated", len(marbleGame.TurnOrder))
+		}
+	})
+}
+
+// Reads and throws away everything sent to conn, so the hub never blocks on it
+func drain(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Time{})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Reads envelopes off conn until one of the type and event arrives and matches, skipping the lines of HTML
+func expectEnvelope(t *testing.T, conn *websocket.Conn, messageType lobby.MessageType, event lobby.EventName, matches func(data json.RawMessage) bool) lobby.Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("FAIL waiting for a %s %s envelope: %v", messageType, event, err)
+		}
+		for _, line := range strings.Split(string(message), "\n") {
+			var envelope lobby.Envelope
+			if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &envelope) != nil {
+				continue
+			}
+			if envelope.Version != lobby.EnvelopeVersion {
+				t.Fatalf("FAIL envelope version: got %d, want %d", envelope.Version, lobby.EnvelopeVersion)
+			}
+			if envelope.Type == messageType && envelope.Event == event && (matches == nil || matches(envelope.Data)) {
+				return envelope
+			}
+		}
+	}
+}
+
+// Reads from conn until an action is turned down
+func expectActionError(t *testing.T, conn *websocket.Conn) engine.ActionError {
+	t.Helper()
+	var actionErr engine.ActionError
+	envelope := expectEnvelope(t, conn, lobby.MessageError, "", nil)
+	if err := json.Unmarshal(envelope.Data, &actionErr); err != nil {
+		t.Fatalf("FAIL unmarshalling action error: %v", err)
+	}
+	return actionErr
+}
+
+// Reads from conn until the presence of userToken changes to status
+func expectPresence(t *testing.T, conn *websocket.Conn, userToken string, status string) lobby.Presence {
+	t.Helper()
+	var presence lobby.Presence
+	expectEnvelope(t, conn, lobby.MessageEvent, lobby.EventPresence, func(data json.RawMessage) bool {
+		return json.Unmarshal(data, &presence) == nil && presence.UserToken == userToken && presence.Status == status
+	})
+	return presence
+}
+
+func TestDisconnectedPlayersKeepTheirSeat(t *testing.T) {
+	const roomId = 9401
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	room := lobby.NewRoom(roomId, "presence")
+	room.GameHub = lobby.NewGameHub(room)
+	room.GameHub.Clock = clock
+	go room.GameHub.Run()
+	room.AddPlayerToRoom("player1")
+	room.AddPlayerToRoom("player2")
+	if err := room.SetLeaveRules(10, engine.LeaverMarblesRemove); err != nil {
+		t.Fatalf("FAIL setting leave rules: %v", err)
+	}
+	if err := room.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	player1 := dialGame(t, server.URL, roomId, "player1")
+	defer player1.Close()
+	player2 := dialGame(t, server.URL, roomId, "player2")
+	waitForGame(t, room, 5*time.Second, func(marbleGame *engine.MarbleGame) bool {
+		return len(marbleGame.TurnOrder) == 2
+	})
+
+	// back within the grace period, they keep their seat
+	player2.Close()
+	presence := expectPresence(t, player1, "player2", lobby.PresenceDisconnected)
+	if want := clock.Now().Add(10 * time.Second).UnixMilli(); presence.RejoinBy != want {
+		t.Errorf("FAIL rejoin by: got %d, want %d", presence.RejoinBy, want)
+	}
+	player2 = dialGame(t, server.URL, roomId, "player2")
+	expectPresence(t, player1, "player2", lobby.PresenceBack)
+	clock.Advance(10 * time.Second)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.TurnOrder) != 2 {
+			t.Errorf("FAIL player2 should still be seated, got %d seated", len(marbleGame.TurnOrder))
+		}
+	})
+
+	// gone for longer, they leave the match and the turn passes on
+	player2.Close()
+	expectPresence(t, player1, "player2", lobby.PresenceDisconnected)
+	clock.Advance(10 * time.Second)
+	expectPresence(t, player1, "player2", lobby.PresenceLeft)
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.TurnOrder) != 1 || !marbleGame.Players["player2"].Left {
+			t.Errorf("FAIL player2 should have left, got %d seated", len(marbleGame.TurnOrder))
+		}
+		if last := marbleGame.ActionLog[len(marbleGame.ActionLog)-1]; !last.Left {
+			t.Errorf("FAIL the leave should be logged, got %+v", last)
+		}
+	})
+
+	// coming back now, they can only watch
+	player2 = dialGame(t, server.URL, roomId, "player2")
+	defer player2.Close()
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if len(marbleGame.TurnOrder) != 1 {
+			t.Errorf("FAIL a leaver shouldn't get their seat back, got %d seated", len(marbleGame.TurnOrder))
+		}
+	})
+
+	// leaving the room gives the seat up straight away, and with nobody left the match is over
+	if err := room.RemovePlayerFromRoom("player1"); err != nil {
+		t.Fatalf("FAIL removing player1 from the room: %v", err)
+	}
+	room.GameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame.State != engine.GameStateFinished {
+			t.Errorf("FAIL state: got %s, want %s", marbleGame.State, engine.GameStateFinished)
+		}
+	})
+}
@@ -1,9 +1,18 @@
 package lobby_test
 
 import (
+	"encoding/json"
+	"marblegame/bot"
+	"marblegame/engine"
 	"marblegame/lobby"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
 )
 
 func TestPlayerAdding(t *testing.T) {
@@ -86,3 +95,438 @@ func TestPlayerRemoval(t *testing.T) {
 		})
 	}
 }
+
+func TestStartGame(t *testing.T) {
+	l := lobby.NewRoom(123, "123")
+	l.SetMaxPlayers(3)
+
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	if l.Game.Config.PlayerLimit != 3 {
+		t.Errorf("FAIL PlayerLimit: got %d, want %d", l.Game.Config.PlayerLimit, 3)
+	}
+
+	l.SetMaxPlayers(4)
+	var playerLimit int
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { playerLimit = marbleGame.Config.PlayerLimit })
+	if playerLimit != 4 {
+		t.Errorf("FAIL PlayerLimit after resize: got %d, want %d", playerLimit, 4)
+	}
+
+	if err := l.StartGame(); err == nil {
+		t.Errorf("FAIL starting a second game should error")
+	}
+}
+
+func TestSetMaxPlayers(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		maxPlayers int
+		wantErr    bool
+		want       int
+	}{
+		{desc: "More room", maxPlayers: 4, want: 4},
+		{desc: "Just the players in it", maxPlayers: 2, want: 2},
+		{desc: "Fewer than the players in it", maxPlayers: 1, wantErr: true, want: 3},
+		{desc: "No room", maxPlayers: 0, wantErr: true, want: 3},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(134, "134")
+			l.SetMaxPlayers(3)
+			l.AddPlayerToRoom("player 1")
+			l.AddPlayerToRoom("player 2")
+
+			err := l.SetMaxPlayers(tC.maxPlayers)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if l.MaxPlayers != tC.want {
+				t.Errorf("FAIL %s max players: got %d, want %d", tC.desc, l.MaxPlayers, tC.want)
+			}
+		})
+	}
+}
+
+func TestMaxPlayersCommand(t *testing.T) {
+	const roomId = 135
+	l := lobby.NewRoom(roomId, "135")
+	l.AddPlayerToRoom("leader")
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/ws/room/135?userToken=leader", nil)
+	if err != nil {
+		t.Fatalf("FAIL dialing the room: %v", err)
+	}
+	defer conn.Close()
+
+	message, _ := json.Marshal(map[string]string{"message": "/maxplayers 4"})
+	if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatalf("FAIL sending command: %v", err)
+	}
+
+	// the room is rendered again for everyone in it
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("FAIL waiting for the room: %v", err)
+		}
+		if strings.Contains(string(message), "(1/4)") {
+			break
+		}
+	}
+}
+
+func TestDisbandClosesEverySocket(t *testing.T) {
+	const roomId = 136
+	l := lobby.NewRoom(roomId, "136")
+	l.AddPlayerToRoom("leader")
+	l.AddPlayerToRoom("player2")
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+
+	e := echo.New()
+	lobby.RoomRoutes(e)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	game := dialGame(t, server.URL, roomId, "player2")
+	defer game.Close()
+	room, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/ws/room/136?userToken=leader", nil)
+	if err != nil {
+		t.Fatalf("FAIL dialing the room: %v", err)
+	}
+	defer room.Close()
+
+	message, _ := json.Marshal(map[string]string{"message": "/disband"})
+	if err := room.WriteMessage(websocket.TextMessage, message); err != nil {
+		t.Fatalf("FAIL sending command: %v", err)
+	}
+
+	for name, conn := range map[string]*websocket.Conn{"room": room, "game": game} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if _, closed := err.(*websocket.CloseError); !closed {
+					t.Errorf("FAIL %s socket: got %v, want it closed", name, err)
+				}
+				break
+			}
+		}
+	}
+	if _, err := lobby.GetRoom(roomId); err == nil {
+		t.Errorf("FAIL the room should be gone")
+	}
+}
+
+func TestAddAndRemoveBots(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		run         func(l *lobby.Room) error
+		wantErr     bool
+		wantPlayers int
+		wantBots    int
+	}{
+		{
+			desc: "Add a bot",
+			run: func(l *lobby.Room) error {
+				_, err := l.AddBot(bot.Easy)
+				return err
+			},
+			wantPlayers: 2,
+			wantBots:    1,
+		},
+		{
+			desc: "Add a bot to a full room",
+			run: func(l *lobby.Room) error {
+				if _, err := l.AddBot(bot.Easy); err != nil {
+					return nil
+				}
+				_, err := l.AddBot(bot.Hard)
+				return err
+			},
+			wantErr:     true,
+			wantPlayers: 2,
+			wantBots:    1,
+		},
+		{
+			desc: "Remove a bot before the match",
+			run: func(l *lobby.Room) error {
+				b, err := l.AddBot(bot.Medium)
+				if err != nil {
+					return nil
+				}
+				return l.RemoveBot(b.UserToken)
+			},
+			wantPlayers: 1,
+			wantBots:    0,
+		},
+		{
+			desc: "Remove a bot playing in the match",
+			run: func(l *lobby.Room) error {
+				b, err := l.AddBot(bot.Medium)
+				if err != nil {
+					return nil
+				}
+				if err := l.StartGame(); err != nil {
+					return nil
+				}
+				return l.RemoveBot(b.UserToken)
+			},
+			wantErr:     true,
+			wantPlayers: 2,
+			wantBots:    1,
+		},
+		{
+			desc: "Remove a player who isn't a bot",
+			run: func(l *lobby.Room) error {
+				return l.RemoveBot("player 1")
+			},
+			wantErr:     true,
+			wantPlayers: 1,
+			wantBots:    0,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(124, "124")
+			l.MaxPlayers = 2
+			l.AddPlayerToRoom("player 1")
+
+			err := tC.run(l)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if len(l.Players) != tC.wantPlayers {
+				t.Errorf("FAIL %s players: got %v, want %d", tC.desc, l.Players, tC.wantPlayers)
+			}
+			var bots int
+			if l.GameHub != nil {
+				l.GameHub.Do(func(marbleGame *engine.MarbleGame) { bots = len(l.Bots) })
+			} else {
+				bots = len(l.Bots)
+			}
+			if bots != tC.wantBots {
+				t.Errorf("FAIL %s bots: got %d, want %d", tC.desc, bots, tC.wantBots)
+			}
+		})
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	l := lobby.NewRoom(125, "125")
+
+	if err := l.SetMode("golf"); err == nil {
+		t.Errorf("FAIL unknown mode should error")
+	}
+	if l.Mode != (engine.TargetMode{}) {
+		t.Errorf("FAIL mode after unknown: got %v, want %v", l.Mode, engine.TargetMode{})
+	}
+
+	if err := l.SetMode("target"); err != nil {
+		t.Fatalf("FAIL setting mode: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var mode engine.GameMode
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { mode = marbleGame.Mode() })
+	if mode != l.Mode {
+		t.Errorf("FAIL match mode: got %v, want %v", mode, l.Mode)
+	}
+}
+
+func TestSetMatchFormat(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		ends        int
+		bestOf      bool
+		targetScore int
+		wantErr     bool
+		want        string
+	}{
+		{desc: "Single end", ends: 1, want: "1 end"},
+		{desc: "Best of", ends: 5, bestOf: true, want: "best of 5 ends"},
+		{desc: "First to", ends: 3, targetScore: 30, want: "3 ends, first to 30"},
+		{desc: "No ends", ends: 0, wantErr: true, want: "1 end"},
+		{desc: "Negative target", ends: 2, targetScore: -1, wantErr: true, want: "1 end"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(126, "126")
+
+			err := l.SetMatchFormat(tC.ends, tC.bestOf, tC.targetScore)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if got := l.MatchFormat(); got != tC.want {
+				t.Errorf("FAIL %s format: got %q, want %q", tC.desc, got, tC.want)
+			}
+		})
+	}
+
+	l := lobby.NewRoom(127, "127")
+	if err := l.SetMatchFormat(5, true, 30); err != nil {
+		t.Fatalf("FAIL setting match format: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var config engine.MarbleGameConfig
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { config = marbleGame.Config })
+	if config.Ends != 5 || !config.BestOf || config.TargetScore != 30 {
+		t.Errorf("FAIL match config: got %d ends, best of %v, first to %d, want 5, true, 30", config.Ends, config.BestOf, config.TargetScore)
+	}
+}
+
+func TestSetTurnClock(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		seconds   float64
+		awayAfter int
+		wantErr   bool
+		want      string
+	}{
+		{desc: "No clock", seconds: 0, want: "off"},
+		{desc: "Clock", seconds: 30, want: "30s a turn"},
+		{desc: "Clock and away", seconds: 12.5, awayAfter: 3, want: "12.5s a turn, away after 3 missed"},
+		{desc: "Negative time", seconds: -1, wantErr: true, want: "off"},
+		{desc: "Negative misses", seconds: 30, awayAfter: -1, wantErr: true, want: "off"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(128, "128")
+
+			err := l.SetTurnClock(tC.seconds, tC.awayAfter)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if got := l.TurnClock(); got != tC.want {
+				t.Errorf("FAIL %s turn clock: got %q, want %q", tC.desc, got, tC.want)
+			}
+		})
+	}
+
+	l := lobby.NewRoom(129, "129")
+	if err := l.SetTurnClock(20, 2); err != nil {
+		t.Fatalf("FAIL setting turn clock: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var config engine.MarbleGameConfig
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { config = marbleGame.Config })
+	if config.TurnTime != 20 || config.MissedTurnsToAway != 2 {
+		t.Errorf("FAIL turn clock config: got %v seconds, away after %d, want 20, 2", config.TurnTime, config.MissedTurnsToAway)
+	}
+}
+
+func TestSetLeaveRules(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		seconds       float64
+		leaverMarbles string
+		wantErr       bool
+		want          string
+	}{
+		{desc: "Grace period", seconds: 45, leaverMarbles: engine.LeaverMarblesKeep, want: "45s to reconnect, their marbles keep scoring"},
+		{desc: "No grace period", seconds: 0, leaverMarbles: engine.LeaverMarblesRemove, want: "no time to reconnect, their marbles are taken off"},
+		{desc: "Negative grace period", seconds: -5, leaverMarbles: engine.LeaverMarblesKeep, wantErr: true, want: "30s to reconnect, their marbles stay but stop scoring"},
+		{desc: "Unknown rule", seconds: 30, leaverMarbles: "explode", wantErr: true, want: "30s to reconnect, their marbles stay but stop scoring"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(130, "130")
+
+			err := l.SetLeaveRules(tC.seconds, tC.leaverMarbles)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if got := l.LeaveRules(); got != tC.want {
+				t.Errorf("FAIL %s leave rules: got %q, want %q", tC.desc, got, tC.want)
+			}
+		})
+	}
+
+	l := lobby.NewRoom(131, "131")
+	if err := l.SetLeaveRules(5, engine.LeaverMarblesRemove); err != nil {
+		t.Fatalf("FAIL setting leave rules: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var config engine.MarbleGameConfig
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { config = marbleGame.Config })
+	if config.LeaveGrace != 5 || config.LeaverMarbles != engine.LeaverMarblesRemove {
+		t.Errorf("FAIL leave config: got %v seconds, %s, want 5, %s", config.LeaveGrace, config.LeaverMarbles, engine.LeaverMarblesRemove)
+	}
+}
+
+func TestSetTakebacks(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		takebacks int
+		wantErr   bool
+		want      string
+	}{
+		{desc: "Two a player", takebacks: 2, want: "2 a player"},
+		{desc: "Off", takebacks: 0, want: "off"},
+		{desc: "Negative", takebacks: -1, wantErr: true, want: "1 a player"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			l := lobby.NewRoom(132, "132")
+
+			err := l.SetTakebacks(tC.takebacks)
+			if (err != nil) != tC.wantErr {
+				t.Errorf("FAIL %s error: got %v, want error %v", tC.desc, err, tC.wantErr)
+			}
+			if got := l.TakebackLimit(); got != tC.want {
+				t.Errorf("FAIL %s takebacks: got %q, want %q", tC.desc, got, tC.want)
+			}
+		})
+	}
+
+	l := lobby.NewRoom(133, "133")
+	if err := l.SetTakebacks(3); err != nil {
+		t.Fatalf("FAIL setting takebacks: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var config engine.MarbleGameConfig
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { config = marbleGame.Config })
+	if config.TakebacksPerMatch != 3 {
+		t.Errorf("FAIL takebacks config: got %d, want 3", config.TakebacksPerMatch)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	l := lobby.NewRoom(128, "128")
+
+	if err := l.SetLevel("moon"); err == nil {
+		t.Errorf("FAIL unknown level should error")
+	}
+	if l.Level.Name != engine.OpenField.Name {
+		t.Errorf("FAIL level after unknown: got %s, want %s", l.Level.Name, engine.OpenField.Name)
+	}
+
+	if err := l.SetLevel("bumpers"); err != nil {
+		t.Fatalf("FAIL setting level: %v", err)
+	}
+	if err := l.StartGame(); err != nil {
+		t.Fatalf("FAIL starting game: %v", err)
+	}
+	var config engine.MarbleGameConfig
+	l.GameHub.Do(func(marbleGame *engine.MarbleGame) { config = marbleGame.Config })
+	if config.Level != "Bumpers" || len(config.Obstacles) != len(l.Level.Obstacles) {
+		t.Errorf("FAIL match level: got %s with %d obstacles, want %s with %d", config.Level, len(config.Obstacles), "Bumpers", len(l.Level.Obstacles))
+	}
+}
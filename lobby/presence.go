@@ -0,0 +1,133 @@
+package lobby
+
+import (
+	"fmt"
+	"marblegame/engine"
+	"marblegame/websockets"
+	"time"
+)
+
+// A player who disconnects mid-match keeps their seat for the config's LeaveGrace. If they reconnect by then
+// they carry on where they were, otherwise they leave the match, see engine.RemovePlayer.
+// Leaving the room gives the seat up straight away. Everyone is told as players come and go.
+
+const (
+	PresenceDisconnected = "disconnected" // their seat is held until RejoinBy
+	PresenceBack         = "back"         // they reconnected in time
+	PresenceLeft         = "left"         // they gave up their seat
+)
+
+type Presence struct {
+	UserToken string `json:"userToken"`
+	Status    string `json:"status"`
+	RejoinBy  int64  `json:"rejoinBy,omitempty"` // unix milliseconds, while they're disconnected
+}
+
+// A seat held for a disconnected player
+type heldSeat struct {
+	timer    Timer
+	rejoinBy time.Time
+}
+
+func (gh *GameHub) UnregisterHandler(c *websockets.Client) {
+	gh.Do(func(marbleGame *engine.MarbleGame) {
+		gh.connections[c.UserToken]--
+		if gh.connections[c.UserToken] > 0 {
+			// still connected on another socket
+			return
+		}
+		gh.holdSeat(marbleGame, c.UserToken)
+	})
+}
+
+// Whether the player still has a seat in a running match
+func hasSeat(marbleGame *engine.MarbleGame, userToken string) bool {
+	if marbleGame == nil || marbleGame.State == engine.GameStateFinished {
+		return false
+	}
+	player, seated := marbleGame.Players[userToken]
+	return seated && !player.Left
+}
+
+// Holds a disconnected player's seat for the config's LeaveGrace, then gives it up for them
+func (gh *GameHub) holdSeat(marbleGame *engine.MarbleGame, userToken string) {
+	if _, held := gh.heldSeats[userToken]; held || !hasSeat(marbleGame, userToken) {
+		return
+	}
+	grace := time.Duration(marbleGame.Config.LeaveGrace * float64(time.Second))
+	if grace <= 0 {
+		gh.forfeitSeat(marbleGame, userToken)
+		return
+	}
+
+	rejoinBy := gh.Clock.Now().Add(grace)
+	timer := gh.Clock.AfterFunc(grace, func() {
+		gh.Do(func(current *engine.MarbleGame) {
+			// they might have come back, or left and come back since
+			if held, exists := gh.heldSeats[userToken]; !exists || !held.rejoinBy.Equal(rejoinBy) {
+				return
+			}
+			delete(gh.heldSeats, userToken)
+			if current == marbleGame {
+				gh.forfeitSeat(current, userToken)
+			}
+		})
+	})
+	gh.heldSeats[userToken] = heldSeat{timer: timer, rejoinBy: rejoinBy}
+	gh.sendPresence(Presence{UserToken: userToken, Status: PresenceDisconnected, RejoinBy: rejoinBy.UnixMilli()})
+}
+
+// Gives a reconnecting player back the seat held for them
+func (gh *GameHub) reclaimSeat(userToken string) {
+	held, exists := gh.heldSeats[userToken]
+	if !exists {
+		return
+	}
+	held.timer.Stop()
+	delete(gh.heldSeats, userToken)
+	gh.sendPresence(Presence{UserToken: userToken, Status: PresenceBack})
+}
+
+// Takes the player out of the match for good, the turn only moves on if it was theirs
+func (gh *GameHub) forfeitSeat(marbleGame *engine.MarbleGame, userToken string) {
+	if held, exists := gh.heldSeats[userToken]; exists {
+		held.timer.Stop()
+		delete(gh.heldSeats, userToken)
+	}
+	if !hasSeat(marbleGame, userToken) {
+		return
+	}
+
+	active := marbleGame.TurnOrder[marbleGame.ActivePlayerIndex]
+	if err := marbleGame.RemovePlayer(userToken); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// the field can change with them gone, even when the turn doesn't
+	gh.moves++
+	gh.sendPresence(Presence{UserToken: userToken, Status: PresenceLeft})
+	// their seat can't be taken back, so neither can any shot before it
+	gh.cancelTakeback()
+
+	if marbleGame.State == engine.GameStateFinished || marbleGame.TurnOrder[marbleGame.ActivePlayerIndex] != active {
+		gh.afterAction(marbleGame)
+		return
+	}
+	gh.sendMarbleGameToClients(marbleGame)
+}
+
+func (gh *GameHub) sendPresence(presence Presence) {
+	gh.Broadcast <- marshalEnvelope(MessageEvent, EventPresence, presence)
+}
+
+// Catches a newly connected client up on whose seats are being held
+func (gh *GameHub) sendHeldSeats(c *websockets.Client) {
+	for userToken, held := range gh.heldSeats {
+		presence := Presence{
+			UserToken: userToken,
+			Status:    PresenceDisconnected,
+			RejoinBy:  held.rejoinBy.UnixMilli(),
+		}
+		gh.Direct <- websockets.DirectMessage{Client: c, Message: marshalEnvelope(MessageEvent, EventPresence, presence)}
+	}
+}
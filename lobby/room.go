@@ -7,22 +7,41 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"marblegame/bot"
+	"marblegame/engine"
 	"marblegame/websockets"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
 type Room struct {
 	*websockets.Hub
-	Id          string
-	Name        string
-	MaxPlayers  int
-	PartyLeader string
-	Players     []string
+	Id            string
+	Name          string
+	MaxPlayers    int                 // guarded by mu, see capacity
+	PartyLeader   string              // guarded by mu like Players, see IsLeader
+	Players       []string            // guarded by mu, once the room is served read it through PlayerList or HasPlayer
+	Game          *engine.MarbleGame  // only touch through GameHub.Do
+	GameHub       *GameHub            // set once by StartGame under mu, other goroutines read it through gameHub
+	Bots          map[string]*bot.Bot // by userToken, bots are in Players too. Once there's a GameHub, only change through GameHub.Do
+	Mode          engine.GameMode     // the rules the next match is played by
+	Ends          int                 // how many ends the next match lasts
+	BestOf        bool                // whether it's won on ends rather than points
+	TargetScore   int                 // finishes the match once someone reaches it, 0 to disable
+	Level         engine.Level        // the obstacles the next match is played around
+	TurnTime      float64             // seconds each turn of the next match lasts before it's skipped, 0 for no clock
+	AwayAfter     int                 // missed turns in a row before a player's turns are skipped right away, 0 for never
+	LeaveGrace    float64             // seconds a player who disconnects mid-match has to come back before they leave it
+	LeaverMarbles string              // what happens to a leaver's marbles on the field, see engine.LeaverMarbleRules
+	Takebacks     int                 // shots each player can take back in the next match, 0 for none
+	mu            sync.RWMutex        // HTTP handlers, the room's socket and the game goroutine all get at the fields it guards
 }
 
 var _ websockets.HubInterface = (*Room)(nil)
@@ -54,13 +73,17 @@ func (lh *Room) ReadPumpHandler(c *websockets.Client, message []byte) {
 
 		c.Hub.BroadcastChan() <- buffer.Bytes()
 	} else {
-		switch msg.Message {
+		command := strings.Fields(msg.Message)
+		switch command[0] {
 		case "/disband":
 			buffer := bytes.Buffer{}
 			ChatboxResponse("Room Leader disbanded the room", c.UserToken).Render(context.Background(), &buffer)
 			ReturnToLobbyResponse().Render(context.Background(), &buffer)
 			lh.Broadcast <- buffer.Bytes()
 			lh.CloseAllConnections()
+			if gameHub := lh.gameHub(); gameHub != nil {
+				gameHub.CloseAllConnections()
+			}
 			roomId, _ := strconv.Atoi(lh.Id)
 			delete(rooms, roomId)
 		case "/disconnect":
@@ -75,43 +98,270 @@ func (lh *Room) ReadPumpHandler(c *websockets.Client, message []byte) {
 			c.Send <- buffer.Bytes()
 
 			lh.RemovePlayerFromRoom(c.UserToken)
+		case "/start":
+			if !lh.IsLeader(c.UserToken) {
+				return
+			}
+			if err := lh.StartGame(); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader started the match", c.UserToken).Render(context.Background(), &buffer)
+			GoToGameResponse(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/mode":
+			// `/mode` lists the modes, `/mode target` picks one for the next match
+			if !lh.IsLeader(c.UserToken) {
+				return
+			}
+			message := "Room Leader set the mode to "
+			if len(command) == 1 {
+				names := []string{}
+				for _, mode := range engine.GameModes {
+					names = append(names, mode.Name())
+				}
+				message = "Modes are " + strings.Join(names, ", ") + ", the room is playing "
+			} else if err := lh.SetMode(command[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse(message+lh.Mode.Name(), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/level":
+			// `/level` lists the levels, `/level bumpers` picks one for the next match
+			if !lh.IsLeader(c.UserToken) {
+				return
+			}
+			message := "Room Leader set the level to "
+			if len(command) == 1 {
+				names := []string{}
+				for _, level := range engine.Levels {
+					names = append(names, level.Name)
+				}
+				message = "Levels are " + strings.Join(names, ", ") + ", the room is playing on "
+			} else if err := lh.SetLevel(command[1]); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse(message+lh.Level.Name, c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/maxplayers":
+			// `/maxplayers 4` lets four into the room, and into the match if one is running
+			if !lh.IsLeader(c.UserToken) || len(command) < 2 {
+				return
+			}
+			maxPlayers, err := strconv.Atoi(command[1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err := lh.SetMaxPlayers(maxPlayers); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader set max players to "+strconv.Itoa(maxPlayers), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/ends", "/bestof", "/firstto":
+			// `/ends 3` plays three ends for the most points, `/bestof 5` is won on ends, `/firstto 30` (or 0 to turn off) stops at a score
+			if !lh.IsLeader(c.UserToken) || len(command) < 2 {
+				return
+			}
+			n, err := strconv.Atoi(command[1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			switch command[0] {
+			case "/ends":
+				err = lh.SetMatchFormat(n, false, lh.TargetScore)
+			case "/bestof":
+				err = lh.SetMatchFormat(n, true, lh.TargetScore)
+			case "/firstto":
+				err = lh.SetMatchFormat(lh.Ends, lh.BestOf, n)
+			}
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader set the match to "+lh.MatchFormat(), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/turntime":
+			// `/turntime 30` gives everyone 30 seconds a turn, `/turntime 30 3` also skips anyone who misses 3 in a row until they're back, `/turntime 0` turns it off
+			if !lh.IsLeader(c.UserToken) || len(command) < 2 {
+				return
+			}
+			seconds, err := strconv.ParseFloat(command[1], 64)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			awayAfter := 0
+			if len(command) > 2 {
+				if awayAfter, err = strconv.Atoi(command[2]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			if err := lh.SetTurnClock(seconds, awayAfter); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader set the turn clock to "+lh.TurnClock(), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/leaving":
+			// `/leaving 30` gives disconnected players 30 seconds to come back, `/leaving 30 remove` also takes their marbles off the field
+			if !lh.IsLeader(c.UserToken) || len(command) < 2 {
+				return
+			}
+			seconds, err := strconv.ParseFloat(command[1], 64)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			leaverMarbles := lh.LeaverMarbles
+			if len(command) > 2 {
+				leaverMarbles = command[2]
+			}
+			if err := lh.SetLeaveRules(seconds, leaverMarbles); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader set leaving to "+lh.LeaveRules(), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/takebacks":
+			// `/takebacks 2` lets everyone take back 2 shots a match, `/takebacks 0` turns them off
+			if !lh.IsLeader(c.UserToken) || len(command) < 2 {
+				return
+			}
+			takebacks, err := strconv.Atoi(command[1])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err := lh.SetTakebacks(takebacks); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader set takebacks to "+lh.TakebackLimit(), c.UserToken).Render(context.Background(), &buffer)
+			CurrentRoom(lh).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/addbot":
+			// `/addbot` or `/addbot hard`
+			if !lh.IsLeader(c.UserToken) {
+				return
+			}
+			difficulty := bot.Medium
+			if len(command) > 1 {
+				var err error
+				if difficulty, err = bot.DifficultyByName(command[1]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			b, err := lh.AddBot(difficulty)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader added a "+difficulty.Name+" bot, "+b.UserToken[:4], c.UserToken).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
+		case "/removebot":
+			// `/removebot` takes out the last bot added, `/removebot bot2` a particular one
+			if !lh.IsLeader(c.UserToken) {
+				return
+			}
+			userToken := ""
+			for _, player := range lh.PlayerList() {
+				if _, isBot := lh.Bots[player]; isBot && (len(command) == 1 || strings.HasPrefix(player, command[1])) {
+					userToken = player
+				}
+			}
+			if err := lh.RemoveBot(userToken); err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			buffer := bytes.Buffer{}
+			ChatboxResponse("Room Leader removed "+userToken[:4], c.UserToken).Render(context.Background(), &buffer)
+			lh.Broadcast <- buffer.Bytes()
 		}
 	}
 }
 
 func (lh *Room) WritePumpHandler(c *websockets.Client, message []byte) error {
-	w, err := c.Conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
-	}
+	return c.WriteQueued(message)
+}
 
-	n := len(c.Send)
-	for range n {
-		message = append(message, []byte{'\n'}...)
-		message = append(message, <-c.Send...)
-	}
+// A copy of the players in the room, safe to read from any goroutine
+func (room *Room) PlayerList() []string {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return slices.Clone(room.Players)
+}
 
-	w.Write(message)
+func (room *Room) HasPlayer(userToken string) bool {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return slices.Contains(room.Players, userToken)
+}
 
-	if err := w.Close(); err != nil {
-		return err
-	}
+func (room *Room) IsLeader(userToken string) bool {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.PartyLeader == userToken
+}
 
-	return nil
+// The GameHub once StartGame has made one, nil before then
+func (room *Room) gameHub() *GameHub {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.GameHub
 }
 
 func (room *Room) AddPlayerToRoom(userToken string) error {
+	room.mu.Lock()
 	alreadyInRoom := slices.Contains(room.Players, userToken)
 	if alreadyInRoom {
+		room.mu.Unlock()
 		return nil
 	}
 
 	atMaxPlayers := len(room.Players) >= room.MaxPlayers
 
 	if atMaxPlayers {
+		room.mu.Unlock()
 		return errors.New("Player count already at max")
 	} else {
 		room.Players = append(room.Players, userToken)
+		if room.PartyLeader == "" {
+			room.PartyLeader = userToken
+		}
+		// unlocked before rendering, CurrentRoom reads the players too
+		room.mu.Unlock()
 
 		buffer := bytes.Buffer{}
 		CurrentRoom(room).Render(context.Background(), &buffer)
@@ -121,8 +371,10 @@ func (room *Room) AddPlayerToRoom(userToken string) error {
 }
 
 func (room *Room) RemovePlayerFromRoom(userToken string) error {
+	room.mu.Lock()
 	inRoom := slices.Contains(room.Players, userToken)
 	if !inRoom {
+		room.mu.Unlock()
 		return errors.New("Player already removed or not in room")
 	}
 
@@ -134,6 +386,19 @@ func (room *Room) RemovePlayerFromRoom(userToken string) error {
 	}
 
 	room.Players = updatedPlayerList
+	if room.PartyLeader == userToken {
+		room.PartyLeader = ""
+		if len(room.Players) > 0 {
+			room.PartyLeader = room.Players[0]
+		}
+	}
+	gameHub := room.GameHub
+	room.mu.Unlock()
+
+	// leaving the room gives up their seat in the match straight away
+	if gameHub != nil {
+		gameHub.Do(func(marbleGame *engine.MarbleGame) { gameHub.forfeitSeat(marbleGame, userToken) })
+	}
 
 	buffer := bytes.Buffer{}
 	CurrentRoom(room).Render(context.Background(), &buffer)
@@ -142,6 +407,272 @@ func (room *Room) RemovePlayerFromRoom(userToken string) error {
 	return nil
 }
 
+// Keeps the room's MaxPlayers in step with the game's PlayerLimit
+// it can't go below the players already in the room
+func (room *Room) SetMaxPlayers(maxPlayers int) error {
+	room.mu.Lock()
+	if maxPlayers < 1 {
+		room.mu.Unlock()
+		return errors.New("A room needs space for at least one player")
+	}
+	if maxPlayers < len(room.Players) {
+		room.mu.Unlock()
+		return errors.New("Room already has more players than that")
+	}
+	room.MaxPlayers = maxPlayers
+	gameHub := room.GameHub
+	room.mu.Unlock()
+
+	if gameHub != nil {
+		gameHub.Do(func(marbleGame *engine.MarbleGame) {
+			if marbleGame != nil {
+				marbleGame.Config.PlayerLimit = maxPlayers
+			}
+		})
+	}
+	return nil
+}
+
+// How many players the room holds, safe to read from any goroutine
+func (room *Room) capacity() int {
+	room.mu.RLock()
+	defer room.mu.RUnlock()
+	return room.MaxPlayers
+}
+
+// Picks the GameMode by name, it's used from the next match the room starts
+func (room *Room) SetMode(name string) error {
+	mode, err := engine.GameModeByName(name)
+	if err != nil {
+		return err
+	}
+	room.Mode = mode
+	return nil
+}
+
+// Picks the Level by name, it's used from the next match the room starts
+func (room *Room) SetLevel(name string) error {
+	level, err := engine.LevelByName(name)
+	if err != nil {
+		return err
+	}
+	room.Level = level
+	return nil
+}
+
+// Sets how the next match is decided, over a number of ends and optionally first to a score
+func (room *Room) SetMatchFormat(ends int, bestOf bool, targetScore int) error {
+	if ends < 1 {
+		return errors.New("A match needs at least one end")
+	}
+	if targetScore < 0 {
+		return errors.New("Target score can't be negative")
+	}
+	room.Ends = ends
+	room.BestOf = bestOf
+	room.TargetScore = targetScore
+	return nil
+}
+
+// Sets the turn clock for the next match, seconds per turn (0 for none) and missed turns before a player counts as away (0 for never)
+func (room *Room) SetTurnClock(seconds float64, awayAfter int) error {
+	if seconds < 0 {
+		return errors.New("Turn time can't be negative")
+	}
+	if awayAfter < 0 {
+		return errors.New("Missed turns can't be negative")
+	}
+	room.TurnTime = seconds
+	room.AwayAfter = awayAfter
+	return nil
+}
+
+// Describes the match format, like "best of 5 ends, first to 30"
+func (room *Room) MatchFormat() string {
+	format := "1 end"
+	if room.Ends > 1 {
+		format = strconv.Itoa(room.Ends) + " ends"
+	}
+	if room.BestOf {
+		format = "best of " + format
+	}
+	if room.TargetScore > 0 {
+		format += ", first to " + strconv.Itoa(room.TargetScore)
+	}
+	return format
+}
+
+// Describes the turn clock, like "30s a turn, away after 3 missed"
+func (room *Room) TurnClock() string {
+	if room.TurnTime <= 0 {
+		return "off"
+	}
+	clock := strconv.FormatFloat(room.TurnTime, 'f', -1, 64) + "s a turn"
+	if room.AwayAfter > 0 {
+		clock += ", away after " + strconv.Itoa(room.AwayAfter) + " missed"
+	}
+	return clock
+}
+
+// Sets what happens when a player leaves the next match: seconds they have to reconnect, and what happens to their marbles
+func (room *Room) SetLeaveRules(graceSeconds float64, leaverMarbles string) error {
+	if graceSeconds < 0 {
+		return errors.New("Grace period can't be negative")
+	}
+	if !engine.ValidLeaverMarbles(leaverMarbles) {
+		return errors.New("Leaver's marbles must be " + strings.Join(engine.LeaverMarbleRules, ", "))
+	}
+	room.LeaveGrace = graceSeconds
+	room.LeaverMarbles = leaverMarbles
+	return nil
+}
+
+// Describes the leave rules, like "30s to reconnect, their marbles stay but stop scoring"
+func (room *Room) LeaveRules() string {
+	rules := "no time to reconnect"
+	if room.LeaveGrace > 0 {
+		rules = strconv.FormatFloat(room.LeaveGrace, 'f', -1, 64) + "s to reconnect"
+	}
+	switch room.LeaverMarbles {
+	case engine.LeaverMarblesKeep:
+		rules += ", their marbles keep scoring"
+	case engine.LeaverMarblesNeutral:
+		rules += ", their marbles stay but stop scoring"
+	case engine.LeaverMarblesRemove:
+		rules += ", their marbles are taken off"
+	}
+	return rules
+}
+
+// Sets how many shots each player can take back in the next match
+func (room *Room) SetTakebacks(takebacks int) error {
+	if takebacks < 0 {
+		return errors.New("Takebacks can't be negative")
+	}
+	room.Takebacks = takebacks
+	return nil
+}
+
+// Describes the takeback limit, like "1 a player"
+func (room *Room) TakebackLimit() string {
+	if room.Takebacks <= 0 {
+		return "off"
+	}
+	return strconv.Itoa(room.Takebacks) + " a player"
+}
+
+// Creates a new MarbleGame for the room, along with the GameHub serving it
+// a finished match can be replaced by a rematch
+func (room *Room) StartGame() error {
+	room.mu.Lock()
+	if room.GameHub == nil {
+		room.GameHub = NewGameHub(room)
+		go room.GameHub.Run()
+	}
+	gameHub := room.GameHub
+	room.mu.Unlock()
+
+	var err error
+	gameHub.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame != nil && marbleGame.State != engine.GameStateFinished {
+			err = errors.New("Game already started")
+			return
+		}
+
+		room.Game = engine.NewMarbleGame()
+		room.Game.Config.PlayerLimit = room.capacity()
+		room.Game.Config.Mode = room.Mode.Name()
+		room.Game.Config.Ends = room.Ends
+		room.Game.Config.BestOf = room.BestOf
+		room.Game.Config.TargetScore = room.TargetScore
+		room.Game.Config.UseLevel(room.Level)
+		room.Game.Config.TurnTime = room.TurnTime
+		room.Game.Config.MissedTurnsToAway = room.AwayAfter
+		room.Game.Config.LeaveGrace = room.LeaveGrace
+		room.Game.Config.LeaverMarbles = room.LeaverMarbles
+		room.Game.Config.TakebacksPerMatch = room.Takebacks
+		// anything still being asked for was about the last match
+		gameHub.cancelTakeback()
+
+		// bots take their seats straight away, everyone else when they connect
+		for _, userToken := range room.PlayerList() {
+			if _, isBot := room.Bots[userToken]; isBot {
+				if _, err := room.Game.AddPlayer(userToken); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+		gameHub.startTurnClock(room.Game)
+		gameHub.playBotTurn(room.Game)
+	})
+
+	return err
+}
+
+// Adds a computer player to the room, and to the match if one is running
+func (room *Room) AddBot(difficulty bot.Difficulty) (*bot.Bot, error) {
+	userToken := fmt.Sprintf("bot%d-%s", len(room.Bots)+1, uuid.New().String()[:8])
+	b := bot.NewBot(userToken, difficulty, time.Now().UnixNano())
+
+	room.updateBots(func() { room.Bots[userToken] = b })
+	if err := room.AddPlayerToRoom(userToken); err != nil {
+		room.updateBots(func() { delete(room.Bots, userToken) })
+		return nil, err
+	}
+
+	if gameHub := room.gameHub(); gameHub != nil {
+		gameHub.Do(func(marbleGame *engine.MarbleGame) {
+			if marbleGame == nil || marbleGame.State == engine.GameStateFinished {
+				return
+			}
+			if _, err := marbleGame.AddPlayer(userToken); err != nil {
+				fmt.Println(err)
+				return
+			}
+			if marbleGame.TurnDeadline.IsZero() {
+				gameHub.startTurnClock(marbleGame)
+			}
+			gameHub.sendMarbleGameToClients(marbleGame)
+			gameHub.playBotTurn(marbleGame)
+		})
+	}
+
+	return b, nil
+}
+
+// Takes a bot out of the room, it can't leave a match it has a seat in until the match is over
+func (room *Room) RemoveBot(userToken string) error {
+	if _, isBot := room.Bots[userToken]; !isBot {
+		return errors.New("No such bot")
+	}
+
+	var err error
+	room.updateBots(func() {
+		if room.Game != nil && room.Game.State != engine.GameStateFinished {
+			if _, seated := room.Game.Players[userToken]; seated {
+				err = errors.New("Bot is playing in the match")
+				return
+			}
+		}
+		delete(room.Bots, userToken)
+	})
+	if err != nil {
+		return err
+	}
+
+	return room.RemovePlayerFromRoom(userToken)
+}
+
+// The GameHub reads Bots from the game goroutine, so once there is one, changes go through there too
+func (room *Room) updateBots(fn func()) {
+	gameHub := room.gameHub()
+	if gameHub == nil {
+		fn()
+		return
+	}
+	gameHub.Do(func(marbleGame *engine.MarbleGame) { fn() })
+}
+
 func (l *Room) ServeWS(c echo.Context) error {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
@@ -3,9 +3,11 @@ package lobby
 import (
 	"errors"
 	"fmt"
+	"marblegame/bot"
+	"marblegame/engine"
+	"marblegame/views"
 	"marblegame/websockets"
 	"net/http"
-	"slices"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
@@ -28,12 +30,19 @@ func GetRoom(roomId int) (*Room, error) {
 func NewRoom(roomId int, name string) *Room {
 	h := websockets.NewHub()
 	newRoom := &Room{
-		Hub:         h,
-		Id:          strconv.Itoa(roomId),
-		Name:        name,
-		MaxPlayers:  2,
-		PartyLeader: "",
-		Players:     []string{},
+		Hub:           h,
+		Id:            strconv.Itoa(roomId),
+		Name:          name,
+		MaxPlayers:    2,
+		PartyLeader:   "",
+		Players:       []string{},
+		Bots:          make(map[string]*bot.Bot),
+		Mode:          engine.TargetMode{},
+		Level:         engine.OpenField,
+		Ends:          1,
+		LeaveGrace:    30,
+		LeaverMarbles: engine.LeaverMarblesNeutral,
+		Takebacks:     1,
 	}
 
 	rooms[roomId] = newRoom
@@ -84,10 +93,68 @@ func RoomRoutes(e *echo.Echo) {
 		roomId, _ := strconv.Atoi(c.Param("roomId"))
 		myRoom, _ := GetRoom(roomId)
 
-		if ok := slices.Contains(myRoom.Players, c.QueryParam("userToken")); !ok {
+		if ok := myRoom.HasPlayer(c.QueryParam("userToken")); !ok {
 			return c.String(http.StatusUnauthorized, "You're not allowed in this room")
 		}
 
 		return myRoom.ServeWS(c)
 	})
+	// Brings user to the match their room is playing
+	e.GET("/room/:roomId/game", func(c echo.Context) error {
+		userToken, _ := c.Cookie("userToken")
+		roomId, _ := strconv.Atoi(c.Param("roomId"))
+
+		myRoom, err := GetRoom(roomId)
+		if err != nil {
+			return c.String(http.StatusNotFound, "Room does not exist")
+		}
+		if myRoom.gameHub() == nil {
+			return c.Redirect(http.StatusSeeOther, "/room/"+myRoom.Id)
+		}
+
+		return views.MarbleGame(userToken.Value, myRoom.Id).Render(c.Request().Context(), c.Response().Writer)
+	})
+
+	// Downloads the room's match as a replay, which can be re-simulated with engine.Replay.Rebuild
+	e.GET("/room/:roomId/replay", func(c echo.Context) error {
+		roomId, _ := strconv.Atoi(c.Param("roomId"))
+		myRoom, err := GetRoom(roomId)
+		if err != nil {
+			return c.String(http.StatusNotFound, "Room does not exist")
+		}
+		gameHub := myRoom.gameHub()
+		if gameHub == nil {
+			return c.String(http.StatusNotFound, "Room has not started a game")
+		}
+
+		var replay engine.Replay
+		started := false
+		gameHub.Do(func(marbleGame *engine.MarbleGame) {
+			// the GameHub is up just before the room's first match is
+			if marbleGame != nil {
+				replay = marbleGame.Replay()
+				started = true
+			}
+		})
+		if !started {
+			return c.String(http.StatusNotFound, "Room has not started a game")
+		}
+
+		return c.JSON(http.StatusOK, replay)
+	})
+
+	// WebSocket to play the room's match
+	e.GET("/ws/room/:roomId/game", func(c echo.Context) error {
+		roomId, _ := strconv.Atoi(c.Param("roomId"))
+		myRoom, err := GetRoom(roomId)
+		if err != nil {
+			return c.String(http.StatusNotFound, "Room does not exist")
+		}
+		gameHub := myRoom.gameHub()
+		if gameHub == nil {
+			return c.String(http.StatusNotFound, "Room has not started a game")
+		}
+
+		return gameHub.ServeWS(c)
+	})
 }
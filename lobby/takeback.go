@@ -0,0 +1,154 @@
+package lobby
+
+import (
+	"fmt"
+	"marblegame/engine"
+	"marblegame/websockets"
+	"slices"
+)
+
+// A player asks to take back their last shot, and it's only taken back once every other player at the table agrees,
+// see engine.TakeBack. Bots always agree, so against bots alone it's taken back straight away.
+// Anyone refusing ends the request, and so does the game moving on before everyone has answered.
+
+// What players send as an ActionRequest's "takeback"
+const (
+	TakebackRequest = "request"
+	TakebackApprove = "approve"
+	TakebackDecline = "decline"
+)
+
+const (
+	TakebackRequested = "requested" // waiting on the players in WaitingOn
+	TakebackApproved  = "approved"  // the shot was taken back
+	TakebackDeclined  = "declined"  // someone refused
+	TakebackCancelled = "cancelled" // the game moved on before everyone answered
+)
+
+const (
+	CodeTakebackPending   engine.ActionErrorCode = "takebackPending"
+	CodeNoTakebackRequest engine.ActionErrorCode = "noTakebackRequest"
+)
+
+type Takeback struct {
+	UserToken string   `json:"userToken"` // who asked
+	Status    string   `json:"status"`
+	WaitingOn []string `json:"waitingOn,omitempty"` // players yet to answer, while it's requested
+}
+
+// The takeback being asked for, only touched on the game goroutine
+type takebackRequest struct {
+	userToken string
+	waitingOn []string
+}
+
+func (gh *GameHub) handleTakeback(c *websockets.Client, answer string) {
+	gh.Do(func(marbleGame *engine.MarbleGame) {
+		if marbleGame == nil {
+			return
+		}
+		marbleGame.PlayerIsBack(c.UserToken)
+
+		switch answer {
+		case TakebackRequest:
+			gh.requestTakeback(c, marbleGame)
+		case TakebackApprove, TakebackDecline:
+			gh.answerTakeback(c, marbleGame, answer == TakebackApprove)
+		}
+	})
+}
+
+func (gh *GameHub) requestTakeback(c *websockets.Client, marbleGame *engine.MarbleGame) {
+	if gh.takeback != nil {
+		gh.sendActionError(c, &engine.ActionError{Code: CodeTakebackPending, Message: "A takeback is already being asked for"})
+		return
+	}
+	if err := marbleGame.CanTakeBack(c.UserToken); err != nil {
+		gh.sendActionError(c, err)
+		return
+	}
+
+	request := &takebackRequest{userToken: c.UserToken}
+	for _, player := range marbleGame.TurnOrder {
+		if _, isBot := gh.Room.Bots[player.UserToken]; !isBot && player.UserToken != c.UserToken {
+			request.waitingOn = append(request.waitingOn, player.UserToken)
+		}
+	}
+	if len(request.waitingOn) == 0 {
+		gh.applyTakeback(marbleGame, request)
+		return
+	}
+
+	gh.takeback = request
+	message := withToast(
+		marshalEnvelope(MessageEvent, EventTakeback, request.event(TakebackRequested)),
+		displayName(marbleGame, c.UserToken)+" asks to take back their last shot",
+	)
+	gh.BroadcastEncoded <- message
+}
+
+func (gh *GameHub) answerTakeback(c *websockets.Client, marbleGame *engine.MarbleGame, approved bool) {
+	request := gh.takeback
+	if request == nil || !slices.Contains(request.waitingOn, c.UserToken) {
+		gh.sendActionError(c, &engine.ActionError{Code: CodeNoTakebackRequest, Message: "No takeback to answer"})
+		return
+	}
+
+	if !approved {
+		gh.takeback = nil
+		message := withToast(
+			marshalEnvelope(MessageEvent, EventTakeback, request.event(TakebackDeclined)),
+			displayName(marbleGame, c.UserToken)+" refused to let "+displayName(marbleGame, request.userToken)+" take back their shot",
+		)
+		gh.BroadcastEncoded <- message
+		return
+	}
+
+	request.waitingOn = slices.DeleteFunc(request.waitingOn, func(userToken string) bool { return userToken == c.UserToken })
+	if len(request.waitingOn) > 0 {
+		gh.Broadcast <- marshalEnvelope(MessageEvent, EventTakeback, request.event(TakebackRequested))
+		return
+	}
+	gh.takeback = nil
+	gh.applyTakeback(marbleGame, request)
+}
+
+// Takes the shot back and sends out the rewound game like any other turn
+func (gh *GameHub) applyTakeback(marbleGame *engine.MarbleGame, request *takebackRequest) {
+	if err := marbleGame.TakeBack(request.userToken); err != nil {
+		fmt.Println(err)
+		gh.Broadcast <- marshalEnvelope(MessageEvent, EventTakeback, request.event(TakebackCancelled))
+		return
+	}
+	message := withToast(
+		marshalEnvelope(MessageEvent, EventTakeback, request.event(TakebackApproved)),
+		displayName(marbleGame, request.userToken)+" took back their last shot",
+	)
+	gh.BroadcastEncoded <- message
+	gh.afterAction(marbleGame)
+}
+
+// Drops the takeback being asked for, if there is one, as the game it was asked about has moved on
+func (gh *GameHub) cancelTakeback() {
+	if gh.takeback == nil {
+		return
+	}
+	gh.Broadcast <- marshalEnvelope(MessageEvent, EventTakeback, gh.takeback.event(TakebackCancelled))
+	gh.takeback = nil
+}
+
+// Catches a newly connected client up on the takeback being asked for
+func (gh *GameHub) sendPendingTakeback(c *websockets.Client) {
+	if gh.takeback == nil {
+		return
+	}
+	gh.Direct <- websockets.DirectMessage{Client: c, Message: marshalEnvelope(MessageEvent, EventTakeback, gh.takeback.event(TakebackRequested))}
+}
+
+func (request *takebackRequest) event(status string) Takeback {
+	takeback := Takeback{UserToken: request.userToken, Status: status}
+	if status == TakebackRequested {
+		takeback.WaitingOn = slices.Clone(request.waitingOn)
+	}
+	return takeback
+}
@@ -1,16 +1,19 @@
 package routes
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"marblegame/websockets"
+	"strconv"
 
-	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
 )
 
 type CursorHub struct {
-	websockets.Hub
+	*websockets.Hub
 	Id          string
 	Name        string
 	MaxPlayers  int
@@ -20,12 +23,14 @@ type CursorHub struct {
 
 var _ websockets.HubInterface = (*CursorHub)(nil)
 
+type CursorUpdate struct {
+	UserToken string `json:"userToken"`
+	MouseX    string `json:"mouseX"`
+	MouseY    string `json:"mouseY"`
+}
+
 func (ch *CursorHub) ReadPumpHandler(c *websockets.Client, message []byte) {
-	var r struct {
-		UserToken string `json:"userToken"`
-		MouseX    string `json:"mouseX"`
-		MouseY    string `json:"mouseY"`
-	}
+	var r CursorUpdate
 
 	err := json.Unmarshal(message, &r)
 	if err != nil {
@@ -41,7 +46,7 @@ func (ch *CursorHub) ReadPumpHandler(c *websockets.Client, message []byte) {
 		return
 	}
 
-	ch.Broadcast <- byteSlice
+	ch.BroadcastEncoded <- websockets.EncodedMessage{JSON: byteSlice, Binary: r.encodeBinary()}
 }
 
 func (ch *CursorHub) WritePumpHandler(c *websockets.Client, message []byte) error {
@@ -51,27 +56,107 @@ func (ch *CursorHub) WritePumpHandler(c *websockets.Client, message []byte) erro
 		message = <-c.Send
 	}
 
-	var r struct {
-		UserToken string `json:"userToken"`
-		MouseX    string `json:"mouseX"`
-		MouseY    string `json:"mouseY"`
-	}
+	var r CursorUpdate
 
-	err := json.Unmarshal(message, &r)
+	var err error
+	if c.Encoding == websockets.EncodingBinary {
+		err = r.decodeBinary(message)
+	} else {
+		err = json.Unmarshal(message, &r)
+	}
 	if err != nil {
 		return errors.New("couldn't unmarshal :-(")
 	}
 
 	if r.UserToken != c.UserToken {
-		w, err := c.Conn.NextWriter(websocket.TextMessage)
-		if err != nil {
-			return err
+		return c.WriteQueued(message)
+	}
+
+	return nil
+}
+
+// Binary cursor updates are a BinaryKindCursor byte, the userToken as a uvarint length and its bytes,
+// then mouseX and mouseY as varints
+// returns nil if the mouse coordinates aren't whole numbers, so binary clients get the JSON instead
+func (r CursorUpdate) encodeBinary() []byte {
+	x, errX := strconv.Atoi(r.MouseX)
+	y, errY := strconv.Atoi(r.MouseY)
+	if errX != nil || errY != nil {
+		return nil
+	}
+
+	b := []byte{websockets.BinaryKindCursor}
+	b = binary.AppendUvarint(b, uint64(len(r.UserToken)))
+	b = append(b, r.UserToken...)
+	b = binary.AppendVarint(b, int64(x))
+	b = binary.AppendVarint(b, int64(y))
+	return b
+}
+
+// Reads a cursor update in either of the forms a binary client can be sent
+func (r *CursorUpdate) decodeBinary(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("Empty cursor update")
+	}
+
+	switch data[0] {
+	case websockets.BinaryKindJSON:
+		return json.Unmarshal(data[1:], r)
+	case websockets.BinaryKindCursor:
+		data = data[1:]
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return errors.New("Truncated cursor update")
+		}
+		data = data[n:]
+		userToken := string(data[:length])
+		data = data[length:]
+
+		x, n := binary.Varint(data)
+		if n <= 0 {
+			return errors.New("Truncated cursor update")
 		}
-		w.Write(message)
-		if err := w.Close(); err != nil {
-			return err
+		y, m := binary.Varint(data[n:])
+		if m <= 0 {
+			return errors.New("Truncated cursor update")
 		}
+
+		r.UserToken = userToken
+		r.MouseX = strconv.FormatInt(x, 10)
+		r.MouseY = strconv.FormatInt(y, 10)
+		return nil
+	default:
+		return errors.New("Not a cursor update")
+	}
+}
+
+func (ch *CursorHub) ServeWS(c echo.Context) error {
+	upgrader := websockets.NewUpgrader()
+
+	userToken := c.QueryParam("userToken")
+	if userToken == "" {
+		return errors.New("no userToken")
 	}
 
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	client := &websockets.Client{
+		Hub:       ch,
+		UserToken: userToken,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		Encoding:  websockets.NegotiateEncoding(c, conn),
+	}
+
+	ch.Register <- client
+
+	go client.WritePump()
+	go client.ReadPump()
+
+	ch.RegisterHandler(client)
+
 	return nil
 }
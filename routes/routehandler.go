@@ -1,9 +1,8 @@
 package routes
 
 import (
-	"marblegame/engine"
 	"marblegame/lobby"
-	"marblegame/views"
+	"marblegame/websockets"
 	"net/http"
 	"time"
 
@@ -11,26 +10,18 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var marbleGame = engine.NewMarbleGame()
-
 func MarbleGameRouteHandler(e *echo.Echo) {
-	cursorHub := CursorHub{}
+	cursorHub := &CursorHub{Hub: websockets.NewHub()}
 	go cursorHub.Run()
 
 	e.GET("/ws/cursor", func(c echo.Context) error {
 		return cursorHub.ServeWS(c)
 	})
 
-	gameHub := GameHub{}
-	go gameHub.Run()
-	e.GET("/ws/game", func(c echo.Context) error {
-		return gameHub.ServeWS(c)
-	})
-
 	lobby.RoomRoutes(e)
 
 	e.GET("/", func(c echo.Context) error {
-		userToken, err := c.Cookie("userToken")
+		_, err := c.Cookie("userToken")
 		if err != nil {
 			// client does not have a userToken cookie, make one for them
 			// TODO: refresh or re-add cookie regardless
@@ -39,8 +30,8 @@ func MarbleGameRouteHandler(e *echo.Echo) {
 			cookie.Value = uuid.New().String()
 			cookie.Expires = time.Now().Add(1000 * 24 * time.Hour)
 			c.SetCookie(cookie)
-			return views.MarbleGame(cookie.Value).Render(c.Request().Context(), c.Response().Writer)
 		}
-		return views.MarbleGame(userToken.Value).Render(c.Request().Context(), c.Response().Writer)
+		// every match is played inside a room, so start off in the lobby
+		return c.Redirect(http.StatusSeeOther, "/lobby")
 	})
 }
@@ -13,6 +13,7 @@ import "./p5.sound.min.js";
 import "./howler.js";
 
 import * as draggable from "./draggable.js";
+import { ENVELOPE_VERSION, decodeWireGame } from "./wire.js";
 
 function getCookie(name) {
   const cookies = document.cookie.split("; ");
@@ -56,6 +57,28 @@ let gameForm;
 /** @type {M.MarbleGame} */
 let game;
 
+/** @type {M.MatchSummary | null} */
+let matchSummary = null;
+
+// players whose seats are held while they're disconnected, by userToken
+/** @type {Object.<string, M.Presence>} */
+let disconnected = {};
+
+// why the last action was turned down, shown for a few seconds
+/** @type {M.ActionError | null} */
+let actionError = null;
+let actionErrorAt = 0;
+const actionErrorShownMs = 3000;
+
+// the server's prediction of the shot being aimed, see GameHub.sendPreview
+/** @type {M.MarbleGame | null} */
+let preview = null;
+/** @type {Object.<string, number> | null} */
+let previewScoreChanges = null;
+let previewSentAt = 0;
+// the server drops previews sent faster than this anyway
+const previewIntervalMs = 100;
+
 /** @typedef {{userToken: string, x: number, y: number}} CursorPosition */
 /** @type {CursorPosition[]} */
 let opponentCursorPositionHistory = [];
@@ -82,9 +105,18 @@ let worldViewOffset = {
 
 /** @type {Boolean} */
 let isMyTurn = false;
+/** @type {Boolean} */
+let isAiming = false;
 
 let frameIndex = -1;
 
+// spin put on the next shot with the arrow keys, each from -1 to 1
+let spin = {
+  side: 0,
+  top: 0,
+};
+const spinStep = 0.25;
+
 let marblePlaceholder;
 let powerPlaceholder;
 
@@ -154,6 +186,9 @@ function mySketch(s) {
       );
 
       drawGameField(s);
+      drawScoringZones(s);
+      drawLaunchZone(s);
+      drawObstacles(s);
       drawOpponentCursor(s, opponentCursorPositionHistory);
 
       // draw marbles
@@ -175,6 +210,11 @@ function mySketch(s) {
       s.translate(0, 0, 600);
       drawPlayerScores(s, game);
       drawInventory(s);
+      drawSpin(s);
+      if (matchSummary && frameIndex == -1) {
+        drawMatchSummary(s, matchSummary);
+      }
+      drawActionError(s);
 
       if (isMyTurn) {
         const player = game.players[userToken];
@@ -182,6 +222,9 @@ function mySketch(s) {
         if (s.mouseIsPressed && s.mouseButton == s.LEFT) {
           // draw the placeholder ball with a line
           if (player.inventory.length > 0) {
+            if (preview) {
+              drawPreview(s, preview, previewScoreChanges);
+            }
             s.push();
             const mousePressedScreenCoords = worldCoordsToScreenCoords(
               s,
@@ -204,7 +247,9 @@ function mySketch(s) {
             const diffX = mouseWorldCoords.x - mousePressedWorldCoords.x;
             const diffY = mouseWorldCoords.y - mousePressedWorldCoords.y;
             let powerMagnitude = Math.sqrt(diffX * diffX + diffY * diffY);
-            const maxPower = 215;
+            const maxPower =
+              game.players[userToken].inventory[selectedInventorySlot].physics
+                .maxLaunchSpeed || game.config.physics.maxLaunchSpeed;
             if (powerMagnitude > maxPower) {
               powerMagnitude = maxPower;
             }
@@ -308,6 +353,9 @@ function mySketch(s) {
       selectedInventorySlot--;
     }
     const player = game.players[userToken];
+    if (!player) {
+      return false;
+    }
     const inventoryLength = player.inventory.length;
     if (selectedInventorySlot < 0) {
       selectedInventorySlot = inventoryLength - 1;
@@ -324,10 +372,33 @@ function mySketch(s) {
       worldViewOffset.x += event.movementX;
       worldViewOffset.y += event.movementY;
     }
+    if (s.mouseButton == s.LEFT && isMyTurn) {
+      sendPreview();
+    }
+  };
+
+  s.keyPressed = function () {
+    const clamp = (/** @type {number} */ v) => Math.max(-1, Math.min(v, 1));
+    if (s.keyCode == s.LEFT_ARROW) {
+      spin.side = clamp(spin.side - spinStep);
+    } else if (s.keyCode == s.RIGHT_ARROW) {
+      spin.side = clamp(spin.side + spinStep);
+    } else if (s.keyCode == s.UP_ARROW) {
+      spin.top = clamp(spin.top + spinStep);
+    } else if (s.keyCode == s.DOWN_ARROW) {
+      spin.top = clamp(spin.top - spinStep);
+    } else {
+      return;
+    }
+    if (isAiming && isMyTurn) {
+      sendPreview();
+    }
+    return false;
   };
 
   s.mousePressed = function () {
     if (s.mouseButton == s.LEFT) {
+      isAiming = true;
       mousePressedWorldCoords.x = Math.round(mouseWorldCoords.x);
       mousePressedWorldCoords.y = Math.round(mouseWorldCoords.y);
       marblePlaceholder.pressed(mouseWorldCoords);
@@ -341,26 +412,54 @@ function mySketch(s) {
       marblePlaceholder.released(mouseWorldCoords);
       powerPlaceholder.released(mouseWorldCoords);
 
-      const action = {
-        userToken: userToken,
-        pos: {
-          X: mousePressedWorldCoords.x,
-          Y: mousePressedWorldCoords.y,
-        },
-        vel: {
-          X: Math.round(mouseWorldCoords.x),
-          Y: Math.round(mouseWorldCoords.y),
-        },
-        inventorySlot: selectedInventorySlot,
-      };
+      isAiming = false;
+      preview = null;
+      previewScoreChanges = null;
 
+      window.document.getElementById("preview").value = "";
+      window.document.getElementById("chat").value = "";
+      window.document.getElementById("takeback").value = "";
       const actionInput = window.document.getElementById("action");
-      actionInput.value = JSON.stringify(action);
+      actionInput.value = JSON.stringify(aimedAction());
       gameForm.dispatchEvent(new Event("sendit"));
     }
   };
 }
 
+/** @returns {M.Action} */
+function aimedAction() {
+  return {
+    userToken: userToken,
+    pos: {
+      X: mousePressedWorldCoords.x,
+      Y: mousePressedWorldCoords.y,
+    },
+    vel: {
+      X: Math.round(mouseWorldCoords.x),
+      Y: Math.round(mouseWorldCoords.y),
+    },
+    inventorySlot: selectedInventorySlot,
+    sideSpin: spin.side,
+    topSpin: spin.top,
+  };
+}
+
+// Asks the server what the shot being aimed would do, at most once every previewIntervalMs
+function sendPreview() {
+  const now = Date.now();
+  if (now - previewSentAt < previewIntervalMs) {
+    return;
+  }
+  previewSentAt = now;
+
+  window.document.getElementById("action").value = "";
+  window.document.getElementById("chat").value = "";
+  window.document.getElementById("takeback").value = "";
+  const previewInput = window.document.getElementById("preview");
+  previewInput.value = JSON.stringify(aimedAction());
+  gameForm.dispatchEvent(new Event("sendit"));
+}
+
 function drawDashedLine(s, x1, y1, x2, y2, dashLength, gap) {
   let distance = s.dist(x1, y1, x2, y2);
   let dashCount = Math.floor(distance / (dashLength + gap));
@@ -417,31 +516,241 @@ addEventListener("htmx:wsBeforeMessage", (event) => {
     }
   }
   if (elt == gameForm) {
-    // got updates on game state
+    // queued messages get batched into one ws message, one per line
+    // lines of HTML are toasts, htmx swaps those in by itself
+    for (const line of message.split("\n")) {
+      if (line.startsWith("{")) {
+        handleGameMessage(JSON.parse(line));
+      }
+    }
+  }
+});
 
-    // reset inventorySlot
-    selectedInventorySlot = 0;
+/**
+ * @param {M.Envelope} envelope
+ */
+function handleGameMessage(envelope) {
+  console.log(envelope);
 
-    /** @type {M.MarbleGame} */
-    const json = JSON.parse(message);
-    console.log(json);
-    game = json;
+  if (envelope.v != ENVELOPE_VERSION) {
+    console.warn(
+      `expected envelope version ${ENVELOPE_VERSION}, got ${envelope.v}`,
+    );
+  }
 
-    // check if it's my turn
-    isMyTurn = json.turnOrder[json.activePlayerIndex].userToken == userToken;
+  switch (envelope.type) {
+    case "state":
+      handleGameState(envelope.data);
+      break;
+    case "error":
+      actionError = envelope.data;
+      actionErrorAt = Date.now();
+      break;
+    case "event":
+      handleGameEvent(envelope.event, envelope.data);
+      break;
+    case "turn-change":
+    case "chat":
+      // the state before a turn-change already says whose turn it is, and chat shows up as a toast
+      break;
+  }
+}
 
-    // now playback all that jazz
-    frameIndex = 0;
+/**
+ * @param {"preview" | "presence" | "matchSummary" | "takeback"} event
+ * @param {M.PreviewResponse | M.Presence | M.MatchSummary | M.Takeback} data
+ */
+function handleGameEvent(event, data) {
+  switch (event) {
+    case "presence":
+      if (data.status == "disconnected") {
+        disconnected[data.userToken] = data;
+      } else {
+        delete disconnected[data.userToken];
+      }
+      break;
+    case "matchSummary":
+      // the match is over
+      matchSummary = data;
+      break;
+    case "takeback":
+      showTakebackPrompt(data);
+      break;
+    case "preview":
+      // only worth drawing while still aiming
+      if (isAiming) {
+        preview = decodeWireGame(data.preview);
+        previewScoreChanges = data.scoreChanges ?? null;
+      }
+      break;
   }
-});
+}
+
+/**
+ * Asks us to allow or refuse a takeback, while the server is waiting on our answer
+ * @param {M.Takeback} takeback
+ */
+function showTakebackPrompt(takeback) {
+  const prompt = window.document.getElementById("takeback-prompt");
+  if (
+    takeback.status != "requested" ||
+    !takeback.waitingOn?.includes(userToken)
+  ) {
+    prompt.classList.add("hidden");
+    return;
+  }
+  const name =
+    game?.players[takeback.userToken]?.displayName ??
+    takeback.userToken.slice(0, 4);
+  window.document.getElementById("takeback-prompt-text").textContent =
+    `${name} wants to take back their last shot `;
+  prompt.classList.remove("hidden");
+}
+
+/**
+ * @param {M.WireGame} json
+ */
+function handleGameState(json) {
+
+  // reset inventorySlot
+  selectedInventorySlot = 0;
+
+  game = decodeWireGame(json);
+  preview = null;
+  previewScoreChanges = null;
+  if (game.state != "finished") {
+    matchSummary = null;
+  }
+
+  // check if it's my turn
+  isMyTurn =
+    game.state != "finished" &&
+    game.turnOrder.length > 0 &&
+    game.turnOrder[game.activePlayerIndex].userToken == userToken;
+
+  // only offer a takeback to players who have one left
+  const me = game.players[userToken];
+  window.document
+    .getElementById("takeback-button")
+    .classList.toggle(
+      "hidden",
+      game.state == "finished" ||
+        !me ||
+        me.left ||
+        me.takebacks >= game.config.takebacksPerMatch,
+    );
+
+  // now playback all that jazz
+  frameIndex = 0;
+}
+
+/**
+ * Draws a faint trail for every marble the preview moves, and a ghost of where each one stops
+ * @param {p5} s
+ * @param {M.MarbleGame} preview
+ * @param {Object.<string, number> | null} scoreChanges only sent in practice mode
+ */
+function drawPreview(s, preview, scoreChanges) {
+  /** @type {Object.<number, M.Marble[]>} */
+  const paths = {};
+  for (const frame of preview.frames) {
+    for (const marble of frame.marbles) {
+      (paths[marble.id] ??= []).push(marble);
+    }
+  }
+
+  s.push();
+  s.noFill();
+  for (const path of Object.values(paths)) {
+    const first = path[0];
+    const last = path[path.length - 1];
+    if (first.pos.X == last.pos.X && first.pos.Y == last.pos.Y) {
+      continue;
+    }
+    const color = marbleColor(s, last);
+    color.setAlpha(120);
+    s.stroke(color);
+    s.strokeWeight(2);
+    s.beginShape();
+    for (const marble of path) {
+      const screenCoords = worldCoordsToScreenCoords(
+        s,
+        marble.pos.X,
+        marble.pos.Y,
+      );
+      s.vertex(screenCoords.x, screenCoords.y);
+    }
+    s.endShape();
+    s.strokeWeight(1);
+    const lastScreenCoords = worldCoordsToScreenCoords(
+      s,
+      last.pos.X,
+      last.pos.Y,
+    );
+    s.circle(lastScreenCoords.x, lastScreenCoords.y, last.type.radius * 2);
+  }
+
+  if (scoreChanges) {
+    const change = scoreChanges[userToken] ?? 0;
+    s.fill(255);
+    s.stroke("black");
+    s.textAlign(s.CENTER);
+    s.text(`${change >= 0 ? "+" : ""}${change}`, s.mouseX, s.mouseY - 20);
+  }
+  s.pop();
+}
+
+/**
+ * @param {p5} s
+ * @param {M.MatchSummary} summary
+ */
+function drawMatchSummary(s, summary) {
+  s.push();
+  s.translate(s.width / 2, s.height / 2 - 60);
+  s.textAlign(s.CENTER);
+  s.fill(255);
+  s.stroke("black");
+  s.strokeWeight(1);
+  s.textSize(24);
+  if (summary.isTie) {
+    s.text("It's a tie!", 0, 0);
+  } else if (summary.winners.includes(userToken)) {
+    s.text("You win!", 0, 0);
+  } else {
+    s.text(`${summary.winners[0].slice(0, 4)} wins!`, 0, 0);
+  }
+  s.textSize(14);
+  let offset = 30;
+  for (const standing of summary.standings) {
+    s.text(
+      `#${standing.rank} ${standing.userToken == userToken ? "(you)" : standing.displayName}: ${standing.score} pts, ${standing.turnsTaken} turns, best marble ${standing.bestMarbleScore}${standing.left ? " (left)" : ""}`,
+      0,
+      offset,
+    );
+    offset += 18;
+  }
+  s.pop();
+}
 
 /**
  * @param {p5} s
  * @param {M.MarbleGame} game
  */
 function drawPlayerScores(s, game) {
+  const playsInEnds = game.config.ends > 1;
+  const hammer =
+    game.hammer || game.turnOrder[game.turnOrder.length - 1]?.userToken;
+
   let offset = 0;
   for (const [playerUserToken, player] of Object.entries(game.players)) {
+    // points from each finished end, then the hammer in modes that use it
+    let ends = "";
+    if (playsInEnds) {
+      ends = ` (${game.ends.map((end) => end.scores[playerUserToken] ?? 0).join(", ")})`;
+      if (playerUserToken == hammer && game.config.mode != "Bocce") {
+        ends += " hammer";
+      }
+    }
     s.push();
     const color = s.color(`hsb(${player.hue},50%,100%)`);
     s.fill(color);
@@ -453,13 +762,61 @@ function drawPlayerScores(s, game) {
     s.textAlign(s.CENTER);
     s.translate(s.width / 2, 30);
     s.text(
-      `${game.turnOrder[game.activePlayerIndex].userToken == playerUserToken ? "> " : ""}${playerUserToken == userToken ? "(you)" : player.userToken.slice(0, 4)}: ${player.score}`,
+      `${game.turnOrder[game.activePlayerIndex]?.userToken == playerUserToken ? "> " : ""}${playerUserToken == userToken ? "(you)" : player.userToken.slice(0, 4)}: ${player.score}${ends}${presenceLabel(player)}`,
       0,
       offset,
     );
     s.pop();
     offset -= 12;
   }
+
+  if (playsInEnds) {
+    s.push();
+    s.fill(255);
+    s.stroke("black");
+    s.textAlign(s.CENTER);
+    s.text(
+      `End ${game.round} of ${game.config.ends}${game.config.bestOf ? ", best of" : ""}`,
+      s.width / 2,
+      30 + offset,
+    );
+    s.pop();
+    offset -= 12;
+  }
+
+  // the server skips the turn once it runs out, this is just the countdown
+  if (game.turnDeadline && game.state != "finished") {
+    const secondsLeft = Math.max(
+      0,
+      Math.ceil((game.turnDeadline - Date.now()) / 1000),
+    );
+    s.push();
+    s.fill(secondsLeft <= 5 ? "red" : 255);
+    s.stroke("black");
+    s.textAlign(s.CENTER);
+    s.text(`${secondsLeft}s left`, s.width / 2, 30 + offset);
+    s.pop();
+  }
+}
+
+/**
+ * Whether the player has left, is disconnected or is away, "" when they're here
+ * @param {M.Player} player
+ * @returns {string}
+ */
+function presenceLabel(player) {
+  if (player.left) {
+    return " (left)";
+  }
+  const held = disconnected[player.userToken];
+  if (held) {
+    const secondsLeft = Math.max(
+      0,
+      Math.ceil(((held.rejoinBy ?? 0) - Date.now()) / 1000),
+    );
+    return ` (disconnected, ${secondsLeft}s)`;
+  }
+  return player.shouldSkipMyTurns ? " (away)" : "";
 }
 
 /**
@@ -519,7 +876,7 @@ function drawMarbles(s, frame) {
       marble.rot[2],
       marble.rot[3],
     ]);
-    if (marble.score == 0) {
+    if (marble.score == 0 && marble.owner) {
       shaderProgram.setUniform("uOpacity", 0.5);
     } else {
       shaderProgram.setUniform("uOpacity", 1.0);
@@ -564,8 +921,7 @@ function drawMarbles(s, frame) {
     s.resetShader();
 
     s.push();
-    const playerColor = s.color(`hsb(${marble.owner.hue},50%,100%)`);
-    s.stroke(playerColor);
+    s.stroke(marbleColor(s, marble));
     s.translate(marbleScreenCoords.x, marbleScreenCoords.y, 500);
     s.noFill();
     if (marble.collided) {
@@ -573,6 +929,10 @@ function drawMarbles(s, frame) {
     } else {
       s.circle(0, 0, marble.type.radius * 2);
     }
+    // marbles with an ability get a second ring
+    if (marble.type.ability) {
+      s.circle(0, 0, marble.type.radius * 1.4);
+    }
     s.textAlign(s.CENTER);
     if (marble.score != 0) {
       s.fill(0);
@@ -594,6 +954,18 @@ function drawMarbles(s, frame) {
   }
 }
 
+/**
+ * The owner's color, or white for neutral marbles like the jack
+ * @param {p5} s
+ * @param {M.Marble} marble
+ */
+function marbleColor(s, marble) {
+  if (!marble.owner) {
+    return s.color(255);
+  }
+  return s.color(`hsb(${marble.owner.hue},50%,100%)`);
+}
+
 /**
  * @param {p5} s
  */
@@ -607,19 +979,197 @@ function drawGameField(s) {
   s.translate(center.x, center.y);
   s.noFill();
   s.stroke(100);
-  s.circle(0, 0, game.config.scoringZoneRadius * 2);
-  s.circle(0, 0, game.config.bullseyeZoneRadius * 2);
-  s.rectMode(s.CENTER);
-  s.rect(0, 0, game.config.width, game.config.height);
+  const arena = game.config.arena;
+  if (arena.shape == "circle") {
+    s.circle(0, 0, Math.min(game.config.width, game.config.height));
+  } else if (arena.shape == "polygon") {
+    s.beginShape();
+    for (const p of arena.points) {
+      s.vertex(p.X - game.config.width / 2, p.Y - game.config.height / 2);
+    }
+    s.endShape(s.CLOSE);
+  } else {
+    // a stadium is a rectangle rounded off as far as it goes
+    const corners =
+      arena.shape == "stadium"
+        ? Math.min(game.config.width, game.config.height) / 2
+        : 0;
+    s.rectMode(s.CENTER);
+    s.rect(0, 0, game.config.width, game.config.height, corners);
+  }
+  s.pop();
+}
+
+/**
+ * Every scoring zone with its bullseye, rings show where their bands change
+ * @param {p5} s
+ */
+function drawScoringZones(s) {
+  // in Bocce the jack is the target
+  if (game.config.mode == "Bocce") {
+    return;
+  }
+  for (const zone of game.config.scoringZones ?? []) {
+    s.push();
+    s.noFill();
+    s.stroke(100);
+    const center = worldCoordsToScreenCoords(s, zone.center.X, zone.center.Y);
+    if (zone.shape == "ring") {
+      s.circle(center.x, center.y, zone.radius * 2);
+      const bands =
+        zone.curve == "stepped"
+          ? zone.steps
+          : zone.curve == "table"
+            ? zone.table.length
+            : 1;
+      s.stroke(70);
+      for (let i = 1; i < bands; i++) {
+        const r =
+          zone.bullseyeRadius +
+          ((zone.radius - zone.bullseyeRadius) * i) / bands;
+        s.circle(center.x, center.y, r * 2);
+      }
+      s.stroke(100);
+    } else if (zone.shape == "rectangle") {
+      s.rectMode(s.CENTER);
+      s.rect(center.x, center.y, zone.size.X, zone.size.Y);
+    } else if (zone.shape == "polygon") {
+      s.beginShape();
+      for (const p of zone.points) {
+        const corner = worldCoordsToScreenCoords(s, p.X, p.Y);
+        s.vertex(corner.x, corner.y);
+      }
+      s.endShape(s.CLOSE);
+    }
+    if (zone.bullseyeRadius > 0) {
+      s.circle(center.x, center.y, zone.bullseyeRadius * 2);
+    }
+    s.pop();
+  }
+}
+
+/**
+ * Where I can put my marbles down, nothing when I can place anywhere
+ * @param {p5} s
+ */
+function drawLaunchZone(s) {
+  const player = game.players[userToken];
+  const zones = game.config.launchZones ?? [];
+  if (!player || zones.length == 0) {
+    return;
+  }
+  const zone = zones[player.id % zones.length];
+  s.push();
+  s.noStroke();
+  s.fill(s.color(`hsba(${player.hue},50%,100%,0.12)`));
+  if (zone.shape == "strip") {
+    const { width, height } = game.config;
+    const [x, y, w, h] = {
+      left: [0, 0, zone.depth, height],
+      right: [width - zone.depth, 0, zone.depth, height],
+      top: [0, 0, width, zone.depth],
+      bottom: [0, height - zone.depth, width, zone.depth],
+    }[zone.edge];
+    const corner = worldCoordsToScreenCoords(s, x, y);
+    s.rect(corner.x, corner.y, w, h);
+  } else if (zone.shape == "arc") {
+    const center = worldCoordsToScreenCoords(s, zone.center.X, zone.center.Y);
+    const from = s.radians(zone.from);
+    let to = s.radians(zone.to);
+    if (to <= from) {
+      to += s.TWO_PI;
+    }
+    // the outer edge one way and the inner edge back
+    s.beginShape();
+    for (let i = 0; i <= 32; i++) {
+      const a = from + ((to - from) * i) / 32;
+      const r = zone.radius + zone.depth;
+      s.vertex(center.x + Math.cos(a) * r, center.y + Math.sin(a) * r);
+    }
+    for (let i = 32; i >= 0; i--) {
+      const a = from + ((to - from) * i) / 32;
+      s.vertex(
+        center.x + Math.cos(a) * zone.radius,
+        center.y + Math.sin(a) * zone.radius,
+      );
+    }
+    s.endShape(s.CLOSE);
+  } else if (zone.shape == "polygon") {
+    s.beginShape();
+    for (const p of zone.points) {
+      const corner = worldCoordsToScreenCoords(s, p.X, p.Y);
+      s.vertex(corner.x, corner.y);
+    }
+    s.endShape(s.CLOSE);
+  }
+  s.pop();
+}
+
+/**
+ * Why my last action was turned down, until it's been up for actionErrorShownMs
+ * @param {p5} s
+ */
+function drawActionError(s) {
+  if (!actionError || Date.now() - actionErrorAt > actionErrorShownMs) {
+    return;
+  }
+  s.push();
+  s.fill(255, 80, 80);
+  s.noStroke();
+  s.textAlign(s.CENTER);
+  const bottom = worldCoordsToScreenCoords(
+    s,
+    game.config.width / 2,
+    game.config.height - 20,
+  );
+  s.text(actionError.message, bottom.x, bottom.y);
   s.pop();
 }
 
+/**
+ * The level's bumpers, walls and polygons, bouncier ones drawn brighter
+ * @param {p5} s
+ */
+function drawObstacles(s) {
+  for (const obstacle of game.config.obstacles ?? []) {
+    s.push();
+    s.stroke(120 + obstacle.restitution * 120);
+    s.strokeWeight(2);
+    s.fill(60);
+    if (obstacle.kind == "bumper") {
+      const center = worldCoordsToScreenCoords(
+        s,
+        obstacle.pos.X,
+        obstacle.pos.Y,
+      );
+      s.circle(center.x, center.y, obstacle.radius * 2);
+    } else if (obstacle.kind == "wall") {
+      const [a, b] = obstacle.points.map((p) =>
+        worldCoordsToScreenCoords(s, p.X, p.Y),
+      );
+      s.line(a.x, a.y, b.x, b.y);
+    } else if (obstacle.kind == "polygon") {
+      s.beginShape();
+      for (const p of obstacle.points) {
+        const corner = worldCoordsToScreenCoords(s, p.X, p.Y);
+        s.vertex(corner.x, corner.y);
+      }
+      s.endShape(s.CLOSE);
+    }
+    s.pop();
+  }
+}
+
 /**
  * @param {p5} s
  */
 function drawInventory(s) {
   // const you = game.players.find((p) => p.userToken == userToken);
   const you = game.players[userToken];
+  if (!you) {
+    // spectating
+    return;
+  }
   let offset = 0;
   for (let i = 0; i < you.inventory.length; i++) {
     const marbleType = you.inventory[i];
@@ -636,4 +1186,25 @@ function drawInventory(s) {
   }
 }
 
+/**
+ * Where the next shot gets hit, as a dot on a marble in the bottom right corner
+ * @param {p5} s
+ */
+function drawSpin(s) {
+  if (!game.players[userToken]) {
+    // spectating
+    return;
+  }
+  const radius = 20;
+  s.push();
+  s.translate(s.width - radius - 10, s.height - radius - 10);
+  s.stroke(100);
+  s.fill(255, 255, 255, 50);
+  s.circle(0, 0, radius * 2);
+  s.noStroke();
+  s.fill(255);
+  s.circle(spin.side * radius * 0.7, -spin.top * radius * 0.7, 6);
+  s.pop();
+}
+
 new window.p5(mySketch);
@@ -4,19 +4,110 @@
  * @property {Object.<string, Player>} players - A map of player IDs to Player objects.
  * @property {MarbleGameFrame[]} frames - The history of game frames.
  * @property {MarbleGameConfig} config - The configuration settings of the game.
+ * @property {Player[]} turnOrder - The order players take their turns in.
+ * @property {number} activePlayerIndex - Index into turnOrder of whose turn it is.
+ * @property {"waiting"|"inProgress"|"finished"} state - Where the match is in its lifecycle.
+ * @property {number} round - The end being played, counting from 1.
+ * @property {End[]} ends - Finished ends, with each player's points in them.
+ * @property {Object.<string, number>} totals - By userToken, points banked from the finished ends.
+ * @property {string} hammer - userToken of who throws last this end, "" for the last in turnOrder.
+ * @property {number} turnDeadline - Unix milliseconds when the active player's turn runs out, 0 with no turn clock.
+ */
+
+/**
+ * One finished end of a match.
+ * @typedef {Object} End
+ * @property {Object.<string, number>} scores - By userToken, the points each player took in the end.
+ * @property {string} winner - userToken of who took the most points, "" for a tie.
+ * @property {number} actions - How many actions had been played when it finished.
  */
 
 /**
  * Configuration settings for the marble game.
  * @typedef {Object} MarbleGameConfig
+ * @property {string} mode - Name of the game mode the match is played by, e.g. "Target".
  * @property {number} playerLimit - Maximum number of players allowed.
- * @property {number} scoringZoneRadius - The radius of the scoring zone.
- * @property {number} scoringZoneMaxScore - The maximum score possible in the scoring zone.
- * @property {number} scoringZoneMinScore - The minimum score possible in the scoring zone.
- * @property {number} bullseyeZoneRadius - The radius of the bullseye zone.
- * @property {number} bullseyeZoneScore - The score for hitting the bullseye zone.
+ * @property {ScoringZone[]} scoringZones - Where marbles score, the first zone a marble touches counts.
  * @property {number} width
  * @property {number} height
+ * @property {number} targetScore - Ends the match once reached, 0 to disable.
+ * @property {number} ends - How many ends a match lasts, it can finish sooner on targetScore or bestOf.
+ * @property {boolean} bestOf - Won on ends rather than points, over once someone has won most of the ends.
+ * @property {number} previewFrames - How many frames of a shot previews show, 0 for the whole outcome (practice mode).
+ * @property {string} level - The name of the level the obstacles came from.
+ * @property {Obstacle[]} obstacles - Fixed geometry marbles bounce off.
+ * @property {LaunchZone[]} launchZones - Where each seat places its marbles, by player id wrapping round, empty for anywhere.
+ * @property {Arena} arena - The shape of the walls round the field.
+ * @property {Physics} physics - How every marble moves, unless its type says otherwise.
+ * @property {number} turnTime - Seconds a player has to take their turn before it's skipped, 0 for no clock.
+ * @property {number} missedTurnsToAway - Missed turns in a row before a player's turns are skipped right away, 0 for never.
+ * @property {number} leaveGrace - Seconds a disconnected player keeps their seat, 0 to forfeit it straight away.
+ * @property {"keep"|"neutral"|"remove"} leaverMarbles - What happens to a leaver's marbles on the field.
+ * @property {number} takebacksPerMatch - Shots each player can take back, 0 for none.
+ */
+
+/**
+ * How a marble bounces, slows down and gets launched, on a MarbleType any 0 falls back to the config's.
+ * @typedef {Object} Physics
+ * @property {number} restitution - Share of speed kept bouncing off anything, from 0 to 1.
+ * @property {number} rollingFriction - Share of speed kept every 0.1 time units.
+ * @property {number} slidingFriction - Speed lost every time unit, on top of the rolling friction.
+ * @property {number} restThreshold - Marbles slower than this come to rest.
+ * @property {number} maxLaunchSpeed - Launches are clamped to this speed.
+ */
+
+/**
+ * The boundary marbles are kept inside, fitted to the width x height field.
+ * @typedef {Object} Arena
+ * @property {"rectangle" | "circle" | "stadium" | "polygon"} shape
+ * @property {Vector2[]} points - A polygon's corners in order.
+ */
+
+/**
+ * An area marbles score in, more the closer they get to its center.
+ * @typedef {Object} ScoringZone
+ * @property {"ring" | "rectangle" | "polygon"} shape
+ * @property {Vector2} center - Where scores are measured from.
+ * @property {number} radius - A ring's outer radius.
+ * @property {Vector2} size - A rectangle's width and height, centered on center.
+ * @property {Vector2[]} points - A polygon's corners in order.
+ * @property {"linear" | "stepped" | "table"} curve - How the score falls off towards the edge.
+ * @property {number} maxScore - Next to the bullseye.
+ * @property {number} minScore - At the edge.
+ * @property {number} steps - How many rings a stepped curve has.
+ * @property {number[]} table - A table curve's scores, one per band from the middle outwards.
+ * @property {number} bullseyeRadius - 0 for no bullseye.
+ * @property {number} bullseyeScore
+ */
+
+/**
+ * Level geometry, it never moves.
+ * @typedef {Object} Obstacle
+ * @property {"bumper" | "wall" | "polygon"} kind
+ * @property {Vector2} pos - A bumper's center.
+ * @property {number} radius - A bumper's radius.
+ * @property {Vector2[]} points - A wall's two ends, or a polygon's corners in order.
+ * @property {number} restitution - The share of speed a marble keeps bouncing off it.
+ */
+
+/**
+ * Where a player can put their marble down, its center has to be inside.
+ * @typedef {Object} LaunchZone
+ * @property {"strip" | "arc" | "polygon"} shape
+ * @property {"left" | "right" | "top" | "bottom"} edge - The side of the field a strip runs along.
+ * @property {number} depth - How far a strip reaches into the field, or how thick an arc is.
+ * @property {Vector2} center - An arc's center.
+ * @property {number} radius - An arc's inner radius.
+ * @property {number} from - An arc's start, in degrees clockwise on screen from +X.
+ * @property {number} to - An arc's end, the same as from for a whole ring.
+ * @property {Vector2[]} points - A polygon's corners in order.
+ */
+
+/**
+ * Why the server turned down an action or preview.
+ * @typedef {Object} ActionError
+ * @property {"gameOver" | "invalidPlayer" | "notYourTurn" | "noSlot" | "slotOutOfRange" | "modeRule" | "outsideLaunchZone" | "overlapsWall" | "overlapsObstacle" | "overlapsMarble"} code
+ * @property {string} message - Ready to show the player.
  */
 
 /**
@@ -28,11 +119,17 @@
 /**
  * Represents a player in the game.
  * @typedef {Object} Player
+ * @property {number} id - Stable for the whole match, in the order players joined.
  * @property {string} userToken - A unique token for the player (not serialized in JSON).
  * @property {string} displayName - The player's display name.
  * @property {number} score - The player's current score.
  * @property {number} hue - The player's color hue.
  * @property {boolean} isTheirTurn - Whether it is currently the player's turn.
+ * @property {boolean} shouldSkipMyTurns - Away, their turns are skipped until they play again.
+ * @property {boolean} left - Left the match, they keep their points but have no seat in turnOrder.
+ * @property {number} turnsTaken - How many turns the player has played.
+ * @property {number} bestMarbleScore - The best score a single marble of theirs has reached.
+ * @property {number} takebacks - Shots they've taken back this match.
  * @property {MarbleType[]} inventory - The player's inventory of marble types.
  */
 
@@ -43,11 +140,14 @@
  * @property {Vector2} pos - The position of the marble.
  * @property {Vector2} vel - The velocity of the marble.
  * @property {string} userToken - The token of the user performing the action.
+ * @property {number} sideSpin - From -1 to 1, bends the shot to the right, or to the left when negative.
+ * @property {number} topSpin - From -1 to 1, follows through after a hit, or draws back when negative.
  */
 
 /**
  * Represents a marble in the game.
  * @typedef {Object} Marble
+ * @property {number} id - Stable for the whole match.
  * @property {Vector2} pos - The position of the marble.
  * @property {Vector2} vel - The velocity of the marble.
  * @property {number[]} rot - The rotation of the marble.
@@ -65,6 +165,129 @@
  * @property {string} description - A description of the marble type.
  * @property {number} radius - The radius of the marble.
  * @property {number} mass - The mass of the marble.
+ * @property {boolean} neutral - Thrown without an owner, like the jack in Bocce.
+ * @property {"" | "Explosive" | "Sticky" | "Anchor" | "Ghost" | "Splitter"} ability - What it does besides bouncing, "" for a plain marble.
+ * @property {Physics} physics - Overrides the config's physics where set.
+ */
+
+/**
+ * A player's final placing in a finished match.
+ * @typedef {Object} Standing
+ * @property {number} rank - Tied players share the same rank.
+ * @property {string} userToken
+ * @property {string} displayName
+ * @property {number} score
+ * @property {number} turnsTaken
+ * @property {number} bestMarbleScore
+ * @property {number} endsWon
+ * @property {boolean} left - Left the match, they're ranked after everyone still seated.
+ */
+
+/**
+ * A player coming or going mid-match, see lobby/presence.go.
+ * @typedef {Object} Presence
+ * @property {string} userToken
+ * @property {"disconnected"|"back"|"left"} status
+ * @property {number} [rejoinBy] - Unix milliseconds their seat is held until, while they're disconnected.
+ */
+
+/**
+ * The end-of-match summary.
+ * @typedef {Object} MatchSummary
+ * @property {Standing[]} standings - Players ordered by rank.
+ * @property {string[]} winners - userTokens of everyone ranked first.
+ * @property {boolean} isTie
+ */
+
+/**
+ * The compact game state the server sends, see engine/wire.go for the format.
+ * @typedef {Object} WireGame
+ * @property {number} v - The wire format version.
+ * @property {WirePlayer[]} players
+ * @property {MarbleType[]} marbleTypes - Marbles and inventories reference these by index.
+ * @property {MarbleGameConfig} config
+ * @property {number[]} turnOrder - Player ids.
+ * @property {number} activePlayerIndex - Index into turnOrder.
+ * @property {"waiting"|"inProgress"|"finished"} state
+ * @property {number} round
+ * @property {End[]} ends
+ * @property {Object.<string, number>} totals
+ * @property {string} hammer
+ * @property {number} turnDeadline - Unix milliseconds, 0 with no turn clock.
+ * @property {WireMarble[]} keyframe - The first frame in full.
+ * @property {WireDelta[]} deltas - One per following frame.
+ */
+
+/**
+ * @typedef {Object} WirePlayer
+ * @property {number} id
+ * @property {string} userToken
+ * @property {string} displayName
+ * @property {number} score
+ * @property {number} hue
+ * @property {boolean} shouldSkipMyTurns
+ * @property {boolean} left
+ * @property {number} turnsTaken
+ * @property {number} bestMarbleScore
+ * @property {number} takebacks - Shots they've taken back this match.
+ * @property {number[]} inventory - Indexes into marbleTypes.
+ */
+
+/**
+ * @typedef {Object} WireMarble
+ * @property {number} id
+ * @property {number} type - Index into marbleTypes.
+ * @property {number} owner - Player id, -1 for no owner.
+ * @property {number} x - In 1/100ths.
+ * @property {number} y - In 1/100ths.
+ * @property {number[]} rot - Quaternion in 1/10000ths.
+ * @property {number} score
+ * @property {boolean} [collided]
+ */
+
+/**
+ * @typedef {Object} WireDelta
+ * @property {number[][]} [m] - [marbleId, dx, dy, dRot0, dRot1, dRot2, dRot3, dScore, collided], trailing zeros trimmed.
+ * @property {WireMarble[]} [add] - Marbles that appeared this frame.
+ * @property {number[]} [rm] - Ids of marbles that disappeared this frame.
+ */
+
+/**
+ * Wraps everything the game websocket sends, see lobby/envelope.go.
+ * @typedef {Object} Envelope
+ * @property {number} v - The envelope version, ENVELOPE_VERSION in wire.js.
+ * @property {"state" | "error" | "event" | "turn-change" | "chat"} type
+ * @property {"preview" | "presence" | "matchSummary" | "takeback"} [event] - Only with type "event".
+ * @property {WireGame | ActionError | PreviewResponse | Presence | MatchSummary | Takeback | TurnChange | ChatMessage} data
+ */
+
+/**
+ * Sent after every action, skipped turn or forfeited seat while the match goes on.
+ * @typedef {Object} TurnChange
+ * @property {string} userToken - Whose turn it is now.
+ * @property {number} round - The end being played, counting from 1.
+ * @property {number} turnDeadline - Unix milliseconds when it runs out, 0 with no turn clock.
+ */
+
+/**
+ * A player asking to take back their last shot, and how the table answered, see lobby/takeback.go.
+ * @typedef {Object} Takeback
+ * @property {string} userToken - Who asked.
+ * @property {"requested"|"approved"|"declined"|"cancelled"} status
+ * @property {string[]} [waitingOn] - Players yet to answer, while it's requested.
+ */
+
+/**
+ * @typedef {Object} ChatMessage
+ * @property {string} userToken
+ * @property {string} message
+ */
+
+/**
+ * The server's prediction of a shot that hasn't been played yet.
+ * @typedef {Object} PreviewResponse
+ * @property {WireGame} preview - The predicted frames, cut down to config.previewFrames.
+ * @property {Object.<string, number>} [scoreChanges] - By userToken, only sent with the whole outcome.
  */
 
 /**
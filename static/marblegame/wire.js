@@ -0,0 +1,228 @@
+/** @import * as M from './marblegametypes' */
+
+// Rebuilds the full game state from the compact wire format the server sends.
+// The format is documented in engine/wire.go, keep the two in step.
+
+export const WIRE_FORMAT_VERSION = 1;
+
+const POSITION_SCALE = 100;
+const ROTATION_SCALE = 10000;
+
+/**
+ * @param {M.WireGame} wireGame
+ * @returns {M.MarbleGame}
+ */
+export function decodeWireGame(wireGame) {
+  if (wireGame.v !== WIRE_FORMAT_VERSION) {
+    throw new Error(
+      `unsupported wire format version ${wireGame.v}, expected ${WIRE_FORMAT_VERSION}`,
+    );
+  }
+
+  /** @type {Object.<number, M.Player>} */
+  const playersById = {};
+  /** @type {Object.<string, M.Player>} */
+  const players = {};
+  for (const wp of wireGame.players) {
+    const player = {
+      ...wp,
+      inventory: wp.inventory.map((i) => wireGame.marbleTypes[i]),
+    };
+    playersById[wp.id] = player;
+    players[wp.userToken] = player;
+  }
+
+  /** @param {M.WireMarble} wm */
+  const copyWireMarble = (wm) => ({ ...wm, rot: [...wm.rot] });
+
+  /**
+   * @param {M.WireMarble} wm
+   * @returns {M.Marble}
+   */
+  const decodeMarble = (wm) => ({
+    id: wm.id,
+    pos: { X: wm.x / POSITION_SCALE, Y: wm.y / POSITION_SCALE },
+    vel: { X: 0, Y: 0 },
+    rot: wm.rot.map((r) => r / ROTATION_SCALE),
+    score: wm.score,
+    type: wireGame.marbleTypes[wm.type],
+    collided: !!wm.collided,
+    highlightColor: "",
+    owner: wm.owner == -1 ? null : playersById[wm.owner],
+  });
+
+  let current = wireGame.keyframe.map(copyWireMarble);
+  /** @type {M.MarbleGameFrame[]} */
+  const frames = [{ marbles: current.map(decodeMarble) }];
+
+  for (const delta of wireGame.deltas) {
+    for (const record of delta.m ?? []) {
+      const wm = current.find((m) => m.id == record[0]);
+      const field = (n) => record[n] ?? 0;
+      wm.x += field(1);
+      wm.y += field(2);
+      for (let r = 0; r < 4; r++) {
+        wm.rot[r] += field(3 + r);
+      }
+      wm.score += field(7);
+      wm.collided = field(8) == 1;
+    }
+    const removed = delta.rm ?? [];
+    current = current.filter((m) => !removed.includes(m.id));
+    current.push(...(delta.add ?? []).map(copyWireMarble));
+    frames.push({ marbles: current.map(decodeMarble) });
+  }
+
+  return {
+    players: players,
+    frames: frames,
+    config: wireGame.config,
+    turnOrder: wireGame.turnOrder.map((id) => playersById[id]),
+    activePlayerIndex: wireGame.activePlayerIndex,
+    state: wireGame.state,
+    round: wireGame.round,
+    ends: wireGame.ends ?? [],
+    totals: wireGame.totals ?? {},
+    hammer: wireGame.hammer,
+    turnDeadline: wireGame.turnDeadline ?? 0,
+  };
+}
+
+// Every message on the game websocket is an envelope around its data, the schema is in lobby/envelope.go.
+export const ENVELOPE_VERSION = 1;
+
+// Binary messages, for clients that connect with ?encoding=binary or the marblegame.binary subprotocol.
+// The first byte is the kind, see websockets/encoding.go, and the layout of a game is in engine/wirebinary.go.
+
+export const BINARY_SUBPROTOCOL = "marblegame.binary";
+
+export const BINARY_KIND_JSON = 0;
+export const BINARY_KIND_GAME = 1;
+export const BINARY_KIND_CURSOR = 2;
+
+class BinaryReader {
+  /** @param {Uint8Array} bytes */
+  constructor(bytes) {
+    this.bytes = bytes;
+    this.offset = 0;
+  }
+
+  byte() {
+    if (this.offset >= this.bytes.length) {
+      throw new Error("truncated binary message");
+    }
+    return this.bytes[this.offset++];
+  }
+
+  // plain arithmetic rather than bitwise, which would cut values down to 32 bits
+  uvarint() {
+    let value = 0;
+    let scale = 1;
+    for (;;) {
+      const b = this.byte();
+      value += (b & 0x7f) * scale;
+      if (b < 0x80) {
+        return value;
+      }
+      scale *= 128;
+    }
+  }
+
+  varint() {
+    const u = this.uvarint();
+    return u % 2 == 0 ? u / 2 : -(u + 1) / 2;
+  }
+
+  /** @param {number} n */
+  take(n) {
+    if (this.offset + n > this.bytes.length) {
+      throw new Error("truncated binary message");
+    }
+    const slice = this.bytes.subarray(this.offset, this.offset + n);
+    this.offset += n;
+    return slice;
+  }
+
+  string() {
+    return new TextDecoder().decode(this.take(this.uvarint()));
+  }
+
+  /** @param {() => any} item */
+  list(item) {
+    const items = [];
+    const n = this.uvarint();
+    for (let i = 0; i < n; i++) {
+      items.push(item());
+    }
+    return items;
+  }
+}
+
+/**
+ * @param {BinaryReader} r
+ * @returns {M.WireGame}
+ */
+function readBinaryWireGame(r) {
+  const v = r.uvarint();
+  const header = JSON.parse(r.string());
+
+  /** @returns {M.WireMarble} */
+  const readMarble = () => {
+    const [id, type, owner, x, y, r0, r1, r2, r3, score] = Array.from(
+      { length: 10 },
+      () => r.varint(),
+    );
+    return {
+      id,
+      type,
+      owner,
+      x,
+      y,
+      rot: [r0, r1, r2, r3],
+      score,
+      collided: r.byte() == 1,
+    };
+  };
+
+  const keyframe = r.list(readMarble);
+  const deltas = r.list(() => ({
+    m: r.list(() => r.list(() => r.varint())),
+    add: r.list(readMarble),
+    rm: r.list(() => r.varint()),
+  }));
+
+  return { v, ...header, keyframe, deltas };
+}
+
+/**
+ * Decodes one binary message into the same objects the JSON messages parse into,
+ * so a game comes back as a M.MarbleGame
+ * @param {ArrayBuffer} buffer
+ * @returns {{kind: number, message: any}}
+ */
+export function decodeBinaryMessage(buffer) {
+  const r = new BinaryReader(new Uint8Array(buffer));
+  const kind = r.byte();
+  switch (kind) {
+    case BINARY_KIND_JSON:
+      return {
+        kind,
+        message: JSON.parse(
+          new TextDecoder().decode(r.take(r.bytes.length - 1)),
+        ),
+      };
+    case BINARY_KIND_GAME:
+      return { kind, message: decodeWireGame(readBinaryWireGame(r)) };
+    case BINARY_KIND_CURSOR:
+      return {
+        kind,
+        message: {
+          userToken: r.string(),
+          mouseX: String(r.varint()),
+          mouseY: String(r.varint()),
+        },
+      };
+    default:
+      throw new Error(`unknown binary message kind ${kind}`);
+  }
+}
@@ -97,7 +97,7 @@ func MarbleGameLogin() templ.Component {
 	})
 }
 
-func MarbleGame(userToken string) templ.Component {
+func MarbleGame(userToken string, roomId string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -148,15 +148,15 @@ func MarbleGame(userToken string) templ.Component {
 				return templ_7745c5c3_Err
 			}
 			var templ_7745c5c3_Var8 string
-			templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs("/ws/game?userToken=" + userToken)
+			templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs("/ws/room/" + roomId + "/game?userToken=" + userToken)
 			if templ_7745c5c3_Err != nil {
-				return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/marblegame.templ`, Line: 57, Col: 50}
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/marblegame.templ`, Line: 57, Col: 70}
 			}
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "\" hx-trigger=\"sendit\" ws-send class=\"hidden\"><input id=\"action\" name=\"action\" class=\"w-full bg-transparent\" placeholder=\"action\"> <button _=\"on click send sendit to #game-form\">send</button></form><div id=\"toast\" class=\"absolute right-0 bottom-0 p-4\"></div></div>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "\" hx-trigger=\"sendit\" ws-send class=\"hidden\"><input id=\"action\" name=\"action\" class=\"w-full bg-transparent\" placeholder=\"action\"> <input id=\"preview\" name=\"preview\" class=\"hidden\"> <input id=\"chat\" name=\"chat\" class=\"hidden\"> <input id=\"takeback\" name=\"takeback\" class=\"hidden\"> <button _=\"on click send sendit to #game-form\">send</button></form><div class=\"absolute bottom-0 left-0 p-4 flex flex-col\"><div id=\"takeback-prompt\" class=\"hidden\"><span id=\"takeback-prompt-text\"></span> <button _=\"\n\t\t\t\t\t\ton click\n\t\t\t\t\t\t\tset the value of #action to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #preview to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #chat to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #takeback to &#39;approve&#39;\n\t\t\t\t\t\t\tsend sendit to #game-form\n\t\t\t\t\t\tend\n\t\t\t\t\t\t\">Allow</button> <button _=\"\n\t\t\t\t\t\ton click\n\t\t\t\t\t\t\tset the value of #action to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #preview to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #chat to &#39;&#39;\n\t\t\t\t\t\t\tset the value of #takeback to &#39;decline&#39;\n\t\t\t\t\t\t\tsend sendit to #game-form\n\t\t\t\t\t\tend\n\t\t\t\t\t\t\">Refuse</button></div><button id=\"takeback-button\" class=\"hidden\" _=\"\n\t\t\t\t\ton click\n\t\t\t\t\t\tset the value of #action to &#39;&#39;\n\t\t\t\t\t\tset the value of #preview to &#39;&#39;\n\t\t\t\t\t\tset the value of #chat to &#39;&#39;\n\t\t\t\t\t\tset the value of #takeback to &#39;request&#39;\n\t\t\t\t\t\tsend sendit to #game-form\n\t\t\t\t\tend\n\t\t\t\t\t\">Take back my shot</button><form id=\"chatbox-form\" _=\"\n\t\t\t\t\ton submit\n\t\t\t\t\t\thalt the event\n\t\t\t\t\t\tset the value of #action to &#39;&#39;\n\t\t\t\t\t\tset the value of #preview to &#39;&#39;\n\t\t\t\t\t\tset the value of #takeback to &#39;&#39;\n\t\t\t\t\t\tset the value of #chat to the value of #chatbox-input\n\t\t\t\t\t\tsend sendit to #game-form\n\t\t\t\t\t\tset the value of #chatbox-input to &#39;&#39;\n\t\t\t\t\tend\n\t\t\t\t\t\"><input id=\"chatbox-input\" autocomplete=\"off\" maxlength=\"200\" class=\"bg-transparent\" placeholder=\"Press Enter to chat...\"></form></div><div id=\"toast\" class=\"absolute right-0 bottom-0 p-4\"></div></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
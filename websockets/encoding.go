@@ -0,0 +1,88 @@
+package websockets
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// How a Client wants its messages, JSON unless it asks for binary
+type Encoding int
+
+const (
+	EncodingJSON Encoding = iota
+	EncodingBinary
+)
+
+// Clients can ask for binary with this subprotocol, or with ?encoding=binary
+const BinarySubprotocol = "marblegame.binary"
+
+// The first byte of every binary message says what the rest of it is
+const (
+	BinaryKindJSON   byte = iota // a JSON message, for anything without a binary encoding
+	BinaryKindGame               // an engine.WireGame, see WireGame.MarshalBinary
+	BinaryKindCursor             // a cursor update, see routes.CursorHub
+)
+
+// A message in both encodings, so each Client gets the one it asked for
+type EncodedMessage struct {
+	JSON   []byte
+	Binary []byte // if nil, binary Clients get the JSON wrapped as BinaryKindJSON
+}
+
+func (m EncodedMessage) For(c *Client) []byte {
+	if c.Encoding != EncodingBinary {
+		return m.JSON
+	}
+	if m.Binary == nil {
+		return append([]byte{BinaryKindJSON}, m.JSON...)
+	}
+	return m.Binary
+}
+
+func NewUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024, // maybe change this to be larger since going to send tons of game frame data
+		Subprotocols:    []string{BinarySubprotocol},
+	}
+}
+
+// Picks the Encoding for a connection made with NewUpgrader
+func NegotiateEncoding(c echo.Context, conn *websocket.Conn) Encoding {
+	if conn.Subprotocol() == BinarySubprotocol || c.QueryParam("encoding") == "binary" {
+		return EncodingBinary
+	}
+	return EncodingJSON
+}
+
+// Writes a message and whatever else is queued up behind it,
+// JSON Clients get them as one text message split by newlines, binary Clients get one binary message each
+func (c *Client) WriteQueued(message []byte) error {
+	if c.Encoding == EncodingBinary {
+		if err := c.Conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+			return err
+		}
+		n := len(c.Send)
+		for range n {
+			if err := c.Conn.WriteMessage(websocket.BinaryMessage, <-c.Send); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	// the same message is shared by every client, so write queued ones out rather than appending to it
+	w.Write(message)
+	n := len(c.Send)
+	for range n {
+		w.Write([]byte{'\n'})
+		w.Write(<-c.Send)
+	}
+
+	return w.Close()
+}
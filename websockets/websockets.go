@@ -14,9 +14,19 @@ import (
 type Hub struct {
 	Clients                  map[*Client]bool
 	Broadcast                chan []byte
+	BroadcastEncoded         chan EncodedMessage
+	Direct                   chan DirectMessage
 	Register                 chan *Client
 	Unregister               chan *Client
 	ReadPumpDebounceDuration time.Duration
+	closeAll                 chan struct{}
+}
+
+// A message for a single Client, sent through the Hub so it can't race the Client being unregistered
+type DirectMessage struct {
+	Client  *Client
+	Message []byte
+	Binary  []byte // optional, see EncodedMessage
 }
 
 var _ HubInterface = (*Hub)(nil)
@@ -25,9 +35,12 @@ func NewHub() *Hub {
 	return &Hub{
 		Clients:                  make(map[*Client]bool),
 		Broadcast:                make(chan []byte),
+		BroadcastEncoded:         make(chan EncodedMessage),
+		Direct:                   make(chan DirectMessage),
 		Register:                 make(chan *Client),
 		Unregister:               make(chan *Client),
 		ReadPumpDebounceDuration: 0,
+		closeAll:                 make(chan struct{}),
 	}
 }
 
@@ -72,39 +85,62 @@ func (h *Hub) Run() {
 		case client := <-h.Unregister:
 			// triggers whenever unregister channel gets something
 			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
-				deceasedClient := &Client{
-					UserToken: client.UserToken,
+				h.drop(client)
+			}
+		case direct := <-h.Direct:
+			// triggers whenever direct channel gets something
+			if _, ok := h.Clients[direct.Client]; ok {
+				select {
+				case direct.Client.Send <- EncodedMessage{JSON: direct.Message, Binary: direct.Binary}.For(direct.Client):
+				default:
+					fmt.Println("failed to put message into client send channel")
+					h.drop(direct.Client)
 				}
-				time.AfterFunc(
-					100*time.Millisecond,
-					func() { h.UnregisterHandler(deceasedClient) },
-				)
 			}
 		case message := <-h.Broadcast:
 			// triggers whenever broadcast channel gets something
 			// fmt.Println("broadcasting from Hub")
+			h.broadcast(EncodedMessage{JSON: message})
+		case message := <-h.BroadcastEncoded:
+			h.broadcast(message)
+		case <-h.closeAll:
 			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				// successfully put message into client send channel
-				default:
-					// failed to put message into client send channel
-					fmt.Println("failed to put message into client send channel")
-					close(client.Send)
-					delete(h.Clients, client)
-				}
+				h.drop(client)
 			}
 		}
 	}
 }
 
-func (h *Hub) ServeWS(c echo.Context) error {
-	upgrader := websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024, // maybe change this to be larger since going to send tons of game frame data
+func (h *Hub) broadcast(message EncodedMessage) {
+	for client := range h.Clients {
+		select {
+		case client.Send <- message.For(client):
+		// successfully put message into client send channel
+		default:
+			// failed to put message into client send channel
+			fmt.Println("failed to put message into client send channel")
+			h.drop(client)
+		}
+	}
+}
+
+// Takes a client off the hub, whether it disconnected or fell too far behind, so either way it gets unregistered
+func (h *Hub) drop(client *Client) {
+	delete(h.Clients, client)
+	close(client.Send)
+	deceasedClient := &Client{
+		UserToken: client.UserToken,
 	}
+	// through the client's Hub, so hubs embedding this one get to handle it
+	hub := client.Hub
+	time.AfterFunc(
+		100*time.Millisecond,
+		func() { hub.UnregisterHandler(deceasedClient) },
+	)
+}
+
+func (h *Hub) ServeWS(c echo.Context) error {
+	upgrader := NewUpgrader()
 
 	userToken := c.QueryParam("userToken")
 	if userToken == "" {
@@ -121,6 +157,7 @@ func (h *Hub) ServeWS(c echo.Context) error {
 		UserToken: userToken,
 		Conn:      conn,
 		Send:      make(chan []byte, 256),
+		Encoding:  NegotiateEncoding(c, conn),
 	}
 
 	h.Register <- client
@@ -133,26 +170,28 @@ func (h *Hub) ServeWS(c echo.Context) error {
 	return nil
 }
 
-// Unregisters all clients
+// Unregisters all clients, through Run as that's the only place Clients can be touched
 func (h *Hub) CloseAllConnections() {
-	for client := range h.Clients {
-		h.Unregister <- client
-	}
+	h.closeAll <- struct{}{}
 }
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
 )
 
+// The most a client can send in one message, anything bigger closes their socket
+// room for a full chat message of 4 byte runes, or JSON escaped control characters, along with htmx's headers
+const MaxMessageSize = 4096
+
 // A Client connects a ws connection to its Hub
 type Client struct {
 	Hub       HubInterface
 	UserToken string
 	Conn      *websocket.Conn
 	Send      chan []byte
+	Encoding  Encoding
 }
 
 // ReadPump pumps messages from the websocket connection to the hub
@@ -164,7 +203,7 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadLimit(MaxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(appData string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 